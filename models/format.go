@@ -0,0 +1,48 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is an output format for query results
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatJSONMeta Format = "json_meta" // {"meta": [...], "data": [...], "rows": n, "elapsed_ms": n}
+	FormatNDJSON   Format = "ndjson"
+	FormatCSV      Format = "csv"
+	FormatTSV      Format = "tsv"
+	FormatParquet  Format = "parquet"
+	FormatArrow    Format = "arrow"
+)
+
+// ParseFormat validates a format name. A blank name means JSON.
+func ParseFormat(name string) (Format, error) {
+	format := Format(strings.ToLower(strings.TrimSpace(name)))
+	switch format {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatJSONMeta, FormatNDJSON, FormatCSV, FormatTSV, FormatParquet, FormatArrow:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported format %q", name)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv"
+	case FormatTSV:
+		return "text/tab-separated-values"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	case FormatArrow:
+		return "application/vnd.apache.arrow.stream"
+	default:
+		return "application/json"
+	}
+}
@@ -1,7 +1,17 @@
 package models
 
 type Column struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	JSONType string `json:"-"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// The JSON type of the column's values: string, int, float or bool
+	JSONType string `json:"json_type,omitempty"`
+}
+
+// Table describes a table in a destination. Rows and Bytes are nil when the
+// destination does not report them.
+type Table struct {
+	Name  string `json:"name"`
+	Rows  *int64 `json:"rows,omitempty"`
+	Bytes *int64 `json:"bytes,omitempty"`
 }
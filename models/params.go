@@ -0,0 +1,191 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamType is the type of a bound query parameter
+type ParamType string
+
+const (
+	ParamString    ParamType = "string"
+	ParamInt       ParamType = "int"
+	ParamFloat     ParamType = "float"
+	ParamTimestamp ParamType = "timestamp"
+	ParamList      ParamType = "list"
+)
+
+// Param is a value bound to a {name} placeholder in a query. Value is a
+// string, int64, float64, time.Time or, for lists, a []Param whose elements
+// all have the same scalar type.
+type Param struct {
+	Type  ParamType
+	Value any
+}
+
+// Params are named query parameters
+type Params map[string]Param
+
+// ParseParam converts text, such as a URL query value, to a parameter of the given type.
+// List elements are separated by commas.
+func ParseParam(t ParamType, text string) (Param, error) {
+	switch t {
+	case ParamString:
+		return Param{Type: t, Value: text}, nil
+	case ParamInt:
+		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid int %q", text)
+		}
+		return Param{Type: t, Value: i}, nil
+	case ParamFloat:
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid float %q", text)
+		}
+		return Param{Type: t, Value: f}, nil
+	case ParamTimestamp:
+		ts, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(text))
+		if err != nil {
+			return Param{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339", text)
+		}
+		return Param{Type: t, Value: ts.UTC()}, nil
+	}
+	return Param{}, fmt.Errorf("unsupported parameter type %q", t)
+}
+
+// ParseListParam converts comma-separated text to a list of elementType
+func ParseListParam(elementType ParamType, text string) (Param, error) {
+	var list []Param
+	for _, item := range strings.Split(text, ",") {
+		p, err := ParseParam(elementType, item)
+		if err != nil {
+			return Param{}, err
+		}
+		list = append(list, p)
+	}
+	return Param{Type: ParamList, Value: list}, nil
+}
+
+// ElementType is the type of a list's elements, or the type of a scalar
+func (p Param) ElementType() ParamType {
+	if list, ok := p.Value.([]Param); ok && len(list) > 0 {
+		return list[0].Type
+	}
+	return p.Type
+}
+
+// UnmarshalJSON accepts a bare value, whose type is inferred, or an object
+// such as {"type": "timestamp", "value": "2024-01-02T03:04:05Z"}.
+func (p *Param) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var raw any
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	param, err := paramFromJSON(raw)
+	if err != nil {
+		return err
+	}
+
+	*p = param
+	return nil
+}
+
+func paramFromJSON(raw any) (Param, error) {
+	switch v := raw.(type) {
+	case string:
+		return Param{Type: ParamString, Value: v}, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return Param{Type: ParamInt, Value: i}, nil
+		}
+		return ParseParam(ParamFloat, v.String())
+	case []any:
+		return listFromJSON(v)
+	case map[string]any:
+		t, _ := v["type"].(string)
+		return typedParamFromJSON(ParamType(t), v["value"])
+	}
+	return Param{}, fmt.Errorf("unsupported parameter value %v", raw)
+}
+
+func typedParamFromJSON(t ParamType, value any) (Param, error) {
+	switch v := value.(type) {
+	case string:
+		if t == ParamList {
+			return Param{}, errors.New("list parameter value must be an array")
+		}
+		return ParseParam(t, v)
+	case json.Number:
+		if t == ParamString || t == ParamTimestamp || t == ParamList {
+			return Param{}, fmt.Errorf("%s parameter value cannot be a number", t)
+		}
+		return ParseParam(t, v.String())
+	case []any:
+		if t != ParamList {
+			return Param{}, fmt.Errorf("%s parameter value cannot be an array", t)
+		}
+		return listFromJSON(v)
+	}
+	return Param{}, fmt.Errorf("unsupported %s parameter value %v", t, value)
+}
+
+func listFromJSON(values []any) (Param, error) {
+	if len(values) == 0 {
+		return Param{}, errors.New("list parameters cannot be empty")
+	}
+
+	list := make([]Param, len(values))
+	for i, value := range values {
+		p, err := paramFromJSON(value)
+		if err != nil {
+			return Param{}, err
+		}
+		if p.Type == ParamList {
+			return Param{}, errors.New("list parameters cannot contain lists")
+		}
+		list[i] = p
+	}
+
+	// Promote a mix of ints and floats to floats
+	hasFloat := false
+	for _, p := range list {
+		hasFloat = hasFloat || p.Type == ParamFloat
+	}
+	for i, p := range list {
+		if hasFloat && p.Type == ParamInt {
+			list[i] = Param{Type: ParamFloat, Value: float64(p.Value.(int64))}
+		}
+	}
+
+	for _, p := range list {
+		if p.Type != list[0].Type {
+			return Param{}, errors.New("list parameter elements must all have the same type")
+		}
+	}
+
+	return Param{Type: ParamList, Value: list}, nil
+}
+
+// MarshalJSON always writes the typed object form so the type survives a round trip
+func (p Param) MarshalJSON() ([]byte, error) {
+	value := p.Value
+	if ts, ok := value.(time.Time); ok {
+		value = ts.Format(time.RFC3339Nano)
+	}
+
+	return json.Marshal(struct {
+		Type  ParamType `json:"type"`
+		Value any       `json:"value"`
+	}{p.Type, value})
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParamJSON(t *testing.T) {
+	var params Params
+	err := json.Unmarshal([]byte(`{
+		"country": "US",
+		"limit": 10,
+		"ratio": 0.5,
+		"since": {"type": "timestamp", "value": "2024-01-02T03:04:05Z"},
+		"ids": [1, 2.5],
+		"price": {"type": "float", "value": 3}
+	}`), &params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Params{
+		"country": {ParamString, "US"},
+		"limit":   {ParamInt, int64(10)},
+		"ratio":   {ParamFloat, 0.5},
+		"since":   {ParamTimestamp, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		"price":   {ParamFloat, 3.0},
+	}
+	for name, want := range expected {
+		if got := params[name]; got.Type != want.Type || got.Value != want.Value {
+			t.Errorf("%s: expected %v; got %v", name, want, got)
+		}
+	}
+
+	ids := params["ids"].Value.([]Param)
+	if params["ids"].Type != ParamList || ids[0] != (Param{ParamFloat, 1.0}) || ids[1] != (Param{ParamFloat, 2.5}) {
+		t.Errorf("ids: got %v", params["ids"])
+	}
+
+	// Round trip through the typed form
+	b, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Params
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["since"] != params["since"] || decoded["limit"] != params["limit"] {
+		t.Errorf("Round trip changed params: %s", b)
+	}
+
+	for _, invalid := range []string{`[]`, `[1, "a"]`, `[[1]]`, `{"type": "int", "value": "x"}`, `{"type": "list", "value": "x"}`, `true`} {
+		var p Param
+		if err := json.Unmarshal([]byte(invalid), &p); err == nil {
+			t.Errorf("Expected %s to be invalid", invalid)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package models
+
+// RejectsTable is the table which holds the rows of table that could not be
+// loaded, with the error, the key of the file they came from and the original JSON
+func RejectsTable(table string) string {
+	return table + "__rejects"
+}
+
+// RejectsColumns are the columns of a rejects table, besides __row_id
+var RejectsColumns = []SchemaColumn{
+	{Name: "rejected_at", Type: ColumnType{Kind: KindTimestamp}},
+	{Name: "error", Type: ColumnType{Kind: KindString}},
+	{Name: "source_key", Type: ColumnType{Kind: KindString}},
+	{Name: "data", Type: ColumnType{Kind: KindString}},
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColumnKind is a column type which each destination maps to its own type
+type ColumnKind string
+
+const (
+	KindString         ColumnKind = "string"
+	KindInt            ColumnKind = "int"
+	KindFloat          ColumnKind = "float"
+	KindBool           ColumnKind = "bool"
+	KindTimestamp      ColumnKind = "timestamp"
+	KindDate           ColumnKind = "date"
+	KindDecimal        ColumnKind = "decimal"
+	KindUUID           ColumnKind = "uuid"
+	KindJSON           ColumnKind = "json"
+	KindArray          ColumnKind = "array"
+	KindLowCardinality ColumnKind = "low_cardinality_string"
+)
+
+// Decimals are limited to the smallest maximum precision of the destinations
+const MaxDecimalPrecision = 38
+
+// ColumnType is a declared column type, written as text such as "timestamp",
+// "decimal(10,2)" or "array(string)"
+type ColumnType struct {
+	Kind ColumnKind
+
+	// For decimals
+	Precision int
+	Scale     int
+
+	// For arrays
+	Element *ColumnType
+}
+
+// ParseColumnType parses the text form of a column type
+func ParseColumnType(text string) (ColumnType, error) {
+	t := strings.ToLower(strings.Join(strings.Fields(text), ""))
+
+	name, args, hasArgs := strings.Cut(t, "(")
+	if hasArgs {
+		if !strings.HasSuffix(args, ")") {
+			return ColumnType{}, fmt.Errorf("invalid column type %q", text)
+		}
+		args = strings.TrimSuffix(args, ")")
+	}
+
+	kind := ColumnKind(name)
+	switch kind {
+	case KindString, KindInt, KindFloat, KindBool, KindTimestamp, KindDate, KindUUID, KindJSON, KindLowCardinality:
+		if hasArgs {
+			return ColumnType{}, fmt.Errorf("column type %s does not take arguments", kind)
+		}
+		return ColumnType{Kind: kind}, nil
+
+	case KindDecimal:
+		if !hasArgs {
+			return ColumnType{Kind: kind, Precision: 18, Scale: 3}, nil
+		}
+
+		p, s, _ := strings.Cut(args, ",")
+		precision, err := strconv.Atoi(p)
+		if err != nil || precision < 1 || precision > MaxDecimalPrecision {
+			return ColumnType{}, fmt.Errorf("decimal precision must be between 1 and %d", MaxDecimalPrecision)
+		}
+		scale := 0
+		if s != "" {
+			scale, err = strconv.Atoi(s)
+			if err != nil || scale < 0 || scale > precision {
+				return ColumnType{}, fmt.Errorf("decimal scale must be between 0 and the precision")
+			}
+		}
+		return ColumnType{Kind: kind, Precision: precision, Scale: scale}, nil
+
+	case KindArray:
+		if !hasArgs {
+			return ColumnType{}, fmt.Errorf("array type needs an element type, as in array(string)")
+		}
+
+		element, err := ParseColumnType(args)
+		if err != nil {
+			return ColumnType{}, err
+		}
+		if element.Kind == KindArray || element.Kind == KindJSON {
+			return ColumnType{}, fmt.Errorf("arrays cannot contain %s", element.Kind)
+		}
+		return ColumnType{Kind: kind, Element: &element}, nil
+	}
+
+	return ColumnType{}, fmt.Errorf("unsupported column type %q", text)
+}
+
+func (t ColumnType) String() string {
+	switch t.Kind {
+	case KindDecimal:
+		return fmt.Sprintf("decimal(%d,%d)", t.Precision, t.Scale)
+	case KindArray:
+		return fmt.Sprintf("array(%s)", t.Element)
+	}
+	return string(t.Kind)
+}
+
+func (t ColumnType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *ColumnType) UnmarshalText(text []byte) error {
+	parsed, err := ParseColumnType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// SchemaColumn is a column whose type has been declared ahead of inserts
+type SchemaColumn struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+
+	// Numbers in a timestamp or date column are Unix times in milliseconds
+	// rather than seconds
+	EpochMillis bool `json:"epoch_millis,omitempty"`
+}
+
+// SchemaPolicy decides what happens when a file has values which do not fit
+// the type of an existing column
+type SchemaPolicy string
+
+const (
+	// Leave the column alone and load the file as is, as before policies existed
+	SchemaPolicyNone SchemaPolicy = "none"
+	// Change the column to a type which holds both, as in int to float to string
+	SchemaPolicyWiden SchemaPolicy = "widen"
+	// Load the values into a sibling column named after their type, as in price__string
+	SchemaPolicySidecar SchemaPolicy = "sidecar"
+	// Fail the load
+	SchemaPolicyReject SchemaPolicy = "reject"
+)
+
+// ParseSchemaPolicy reads a destination's schema_evolution setting. The default
+// is to change nothing, so that columns are only altered if the user opts in.
+func ParseSchemaPolicy(text string) (SchemaPolicy, error) {
+	policy := SchemaPolicy(strings.ToLower(strings.TrimSpace(text)))
+	switch policy {
+	case "":
+		return SchemaPolicyNone, nil
+	case SchemaPolicyNone, SchemaPolicyWiden, SchemaPolicySidecar, SchemaPolicyReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unsupported schema_evolution policy %q", text)
+}
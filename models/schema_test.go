@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestParseColumnType(t *testing.T) {
+	valid := map[string]string{
+		"string":                 "string",
+		" Timestamp ":            "timestamp",
+		"decimal":                "decimal(18,3)",
+		"DECIMAL(10, 2)":         "decimal(10,2)",
+		"decimal(5)":             "decimal(5,0)",
+		"array(int)":             "array(int)",
+		"array(decimal(9,2))":    "array(decimal(9,2))",
+		"low_cardinality_string": "low_cardinality_string",
+		"uuid":                   "uuid",
+	}
+	for text, want := range valid {
+		got, err := ParseColumnType(text)
+		if err != nil || got.String() != want {
+			t.Errorf("%q: expected %s; got %s, %v", text, want, got, err)
+		}
+	}
+
+	invalid := []string{"", "varchar", "decimal(40,2)", "decimal(5,6)", "array", "array(array(int))", "string(10)", "array(int"}
+	for _, text := range invalid {
+		if _, err := ParseColumnType(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestParseSchemaPolicy(t *testing.T) {
+	valid := map[string]SchemaPolicy{
+		"":         SchemaPolicyNone,
+		"none":     SchemaPolicyNone,
+		"widen":    SchemaPolicyWiden,
+		"Sidecar ": SchemaPolicySidecar,
+		"reject":   SchemaPolicyReject,
+	}
+	for text, want := range valid {
+		got, err := ParseSchemaPolicy(text)
+		if err != nil || got != want {
+			t.Errorf("%q: expected %s; got %s, %v", text, want, got, err)
+		}
+	}
+
+	if _, err := ParseSchemaPolicy("truncate"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
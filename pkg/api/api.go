@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
@@ -28,6 +29,7 @@ type ScratchDataAPIStruct struct {
 	snow               *snowflake.Node
 	googleOauthConfig  *oauth2.Config
 	tokenAuth          *jwtauth.JWTAuth
+	cursorKey          []byte
 	config             config.API
 }
 
@@ -52,6 +54,10 @@ func NewScratchDataAPI(
 		return nil, err
 	}
 
+	// Page cursors are signed with a key derived from the JWT key, so that
+	// every API server accepts the cursors of the others
+	cursorKey := sha256.Sum256([]byte("cursor:" + conf.Crypto.JWTPrivateKey))
+
 	return &ScratchDataAPIStruct{
 		storageServices:    storageServices,
 		destinationManager: destinationManager,
@@ -59,6 +65,7 @@ func NewScratchDataAPI(
 		snow:               snow,
 		config:             conf.API,
 		tokenAuth:          jwtauth.New("RS256", privateKey, nil),
+		cursorKey:          cursorKey[:],
 		googleOauthConfig: &oauth2.Config{
 			RedirectURL:  conf.Dashboard.GoogleRedirectURL,
 			ClientID:     conf.Dashboard.GoogleClientID,
@@ -0,0 +1,396 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+const arrowBatchSize = 4096
+
+// ArrowDecoder converts Arrow record batches to JSON objects, one row at a time.
+// Values keep their source types where JSON allows it: integers and decimals are
+// written as exact numbers, timestamps as RFC 3339 strings in UTC, dates as
+// YYYY-MM-DD, lists as arrays and structs and maps as objects.
+type ArrowDecoder struct {
+	reader array.RecordReader
+	record arrow.Record
+	row    int
+
+	closers []io.Closer
+}
+
+func newArrowDecoder(reader array.RecordReader, closers ...io.Closer) *ArrowDecoder {
+	return &ArrowDecoder{reader: reader, closers: closers}
+}
+
+// NewArrowStreamDecoder reads the Arrow IPC streaming format without buffering the body
+func NewArrowStreamDecoder(r io.Reader) (*ArrowDecoder, error) {
+	reader, err := ipc.NewReader(r, ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		return nil, err
+	}
+	return newArrowDecoder(reader), nil
+}
+
+// NewArrowFileDecoder reads the Arrow IPC file format. The file format needs random
+// access, so the body is first spooled to a temporary file.
+func NewArrowFileDecoder(r io.Reader) (*ArrowDecoder, error) {
+	spool, err := spoolToTempFile(r, "scratchdata_arrow")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := ipc.NewFileReader(spool, ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		spool.Close()
+		return nil, err
+	}
+
+	return newArrowDecoder(&arrowFileRecordReader{reader: reader}, spool), nil
+}
+
+// NewParquetDecoder reads a Parquet file. Parquet keeps its metadata in the footer,
+// so the body is first spooled to a temporary file.
+func NewParquetDecoder(ctx context.Context, r io.Reader) (*ArrowDecoder, error) {
+	spool, err := spoolToTempFile(r, "scratchdata_parquet")
+	if err != nil {
+		return nil, err
+	}
+
+	parquetReader, err := file.NewParquetReader(spool)
+	if err != nil {
+		spool.Close()
+		return nil, err
+	}
+
+	// Closing parquetReader would only close the spool file, so the spool is the only closer
+	props := pqarrow.ArrowReadProperties{BatchSize: arrowBatchSize}
+	fileReader, err := pqarrow.NewFileReader(parquetReader, props, memory.DefaultAllocator)
+	if err != nil {
+		spool.Close()
+		return nil, err
+	}
+
+	recordReader, err := fileReader.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		spool.Close()
+		return nil, err
+	}
+
+	return newArrowDecoder(recordReader, spool), nil
+}
+
+func (d *ArrowDecoder) Schema() *arrow.Schema {
+	return d.reader.Schema()
+}
+
+func (d *ArrowDecoder) Next() (string, error) {
+	for d.record == nil || d.row >= int(d.record.NumRows()) {
+		if !d.reader.Next() {
+			if err := d.reader.Err(); err != nil && err != io.EOF {
+				return "", err
+			}
+			return "", io.EOF
+		}
+
+		d.record = d.reader.Record()
+		d.row = 0
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, col := range d.record.Columns() {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(`"`)
+		b.WriteString(util.JsonEscape(d.record.ColumnName(i)))
+		b.WriteString(`":`)
+		writeArrowValue(&b, col, d.row)
+	}
+	b.WriteString("}")
+
+	d.row++
+	return b.String(), nil
+}
+
+func (d *ArrowDecoder) Close() error {
+	d.reader.Release()
+
+	var rc error
+	for _, closer := range d.closers {
+		if err := closer.Close(); err != nil {
+			rc = err
+		}
+	}
+	return rc
+}
+
+// ArrowColumns maps the fields of an Arrow schema to column types, so that new
+// columns are created with the source's types rather than inferred from JSON.
+// Struct fields are named as the flatteners name them, joined with underscores.
+// Lists, maps, binary and time of day fields are left to be inferred.
+func ArrowColumns(schema *arrow.Schema) []models.SchemaColumn {
+	columns := []models.SchemaColumn{}
+	for _, field := range schema.Fields() {
+		columns = appendArrowColumns(columns, field.Name, field.Type)
+	}
+	return columns
+}
+
+func appendArrowColumns(columns []models.SchemaColumn, name string, dataType arrow.DataType) []models.SchemaColumn {
+	var columnType models.ColumnType
+	switch t := dataType.(type) {
+	case *arrow.BooleanType:
+		columnType.Kind = models.KindBool
+	case *arrow.Int8Type, *arrow.Int16Type, *arrow.Int32Type, *arrow.Int64Type,
+		*arrow.Uint8Type, *arrow.Uint16Type, *arrow.Uint32Type:
+		columnType.Kind = models.KindInt
+	case *arrow.Uint64Type:
+		// Values above the largest signed 64-bit integer do not fit an int column
+		columnType = models.ColumnType{Kind: models.KindDecimal, Precision: 20}
+	case *arrow.Float16Type, *arrow.Float32Type, *arrow.Float64Type:
+		columnType.Kind = models.KindFloat
+	case arrow.DecimalType:
+		if t.GetPrecision() > models.MaxDecimalPrecision {
+			return columns
+		}
+		columnType = models.ColumnType{Kind: models.KindDecimal, Precision: int(t.GetPrecision()), Scale: int(t.GetScale())}
+	case *arrow.StringType, *arrow.LargeStringType:
+		columnType.Kind = models.KindString
+	case *arrow.TimestampType:
+		columnType.Kind = models.KindTimestamp
+	case *arrow.Date32Type, *arrow.Date64Type:
+		columnType.Kind = models.KindDate
+	case *arrow.DictionaryType:
+		return appendArrowColumns(columns, name, t.ValueType)
+	case *arrow.StructType:
+		for _, field := range t.Fields() {
+			columns = appendArrowColumns(columns, name+"_"+field.Name, field.Type)
+		}
+		return columns
+	default:
+		return columns
+	}
+
+	if !util.ValidColumnName(name) {
+		return columns
+	}
+	return append(columns, models.SchemaColumn{Name: name, Type: columnType})
+}
+
+func writeArrowString(b *strings.Builder, s string) {
+	b.WriteString(`"`)
+	b.WriteString(util.JsonEscape(s))
+	b.WriteString(`"`)
+}
+
+func writeArrowFloat(b *strings.Builder, f float64) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		b.WriteString("null")
+		return
+	}
+	b.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// writeArrowValue writes the value at row i of arr as a JSON literal
+func writeArrowValue(b *strings.Builder, arr arrow.Array, i int) {
+	if arr.IsNull(i) {
+		b.WriteString("null")
+		return
+	}
+
+	switch a := arr.(type) {
+	case *array.Boolean:
+		b.WriteString(strconv.FormatBool(a.Value(i)))
+	case *array.Int8:
+		b.WriteString(strconv.FormatInt(int64(a.Value(i)), 10))
+	case *array.Int16:
+		b.WriteString(strconv.FormatInt(int64(a.Value(i)), 10))
+	case *array.Int32:
+		b.WriteString(strconv.FormatInt(int64(a.Value(i)), 10))
+	case *array.Int64:
+		b.WriteString(strconv.FormatInt(a.Value(i), 10))
+	case *array.Uint8:
+		b.WriteString(strconv.FormatUint(uint64(a.Value(i)), 10))
+	case *array.Uint16:
+		b.WriteString(strconv.FormatUint(uint64(a.Value(i)), 10))
+	case *array.Uint32:
+		b.WriteString(strconv.FormatUint(uint64(a.Value(i)), 10))
+	case *array.Uint64:
+		// Written as a decimal string, like coerced decimal values
+		writeArrowString(b, strconv.FormatUint(a.Value(i), 10))
+	case *array.Float16:
+		writeArrowFloat(b, float64(a.Value(i).Float32()))
+	case *array.Float32:
+		writeArrowFloat(b, float64(a.Value(i)))
+	case *array.Float64:
+		writeArrowFloat(b, a.Value(i))
+	case *array.Decimal128:
+		// Quoted so that JSON parsers do not round them to floats
+		writeArrowString(b, a.Value(i).ToString(a.DataType().(*arrow.Decimal128Type).Scale))
+	case *array.Decimal256:
+		writeArrowString(b, a.Value(i).ToString(a.DataType().(*arrow.Decimal256Type).Scale))
+	case *array.String:
+		writeArrowString(b, a.Value(i))
+	case *array.LargeString:
+		writeArrowString(b, a.Value(i))
+	case *array.Binary:
+		writeArrowString(b, base64.StdEncoding.EncodeToString(a.Value(i)))
+	case *array.LargeBinary:
+		writeArrowString(b, base64.StdEncoding.EncodeToString(a.Value(i)))
+	case *array.FixedSizeBinary:
+		writeArrowString(b, base64.StdEncoding.EncodeToString(a.Value(i)))
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		writeArrowString(b, a.Value(i).ToTime(unit).UTC().Format(time.RFC3339Nano))
+	case *array.Date32:
+		writeArrowString(b, a.Value(i).ToTime().Format(time.DateOnly))
+	case *array.Date64:
+		writeArrowString(b, a.Value(i).ToTime().Format(time.DateOnly))
+	case *array.Time32:
+		unit := a.DataType().(*arrow.Time32Type).Unit
+		writeArrowString(b, a.Value(i).ToTime(unit).Format("15:04:05.999999999"))
+	case *array.Time64:
+		unit := a.DataType().(*arrow.Time64Type).Unit
+		writeArrowString(b, a.Value(i).ToTime(unit).Format("15:04:05.999999999"))
+	case *array.Map:
+		// Maps become objects, so keys are always written as strings
+		start, end := a.ValueOffsets(i)
+		keys := a.Keys()
+		items := a.Items()
+		b.WriteString("{")
+		for j := start; j < end; j++ {
+			if j > start {
+				b.WriteString(",")
+			}
+			writeArrowString(b, keys.ValueStr(int(j)))
+			b.WriteString(":")
+			writeArrowValue(b, items, int(j))
+		}
+		b.WriteString("}")
+	case array.ListLike:
+		start, end := a.ValueOffsets(i)
+		values := a.ListValues()
+		b.WriteString("[")
+		for j := start; j < end; j++ {
+			if j > start {
+				b.WriteString(",")
+			}
+			writeArrowValue(b, values, int(j))
+		}
+		b.WriteString("]")
+	case *array.Struct:
+		structType := a.DataType().(*arrow.StructType)
+		b.WriteString("{")
+		for f := 0; f < a.NumField(); f++ {
+			if f > 0 {
+				b.WriteString(",")
+			}
+			writeArrowString(b, structType.Field(f).Name)
+			b.WriteString(":")
+			writeArrowValue(b, a.Field(f), i)
+		}
+		b.WriteString("}")
+	case *array.Dictionary:
+		writeArrowValue(b, a.Dictionary(), a.GetValueIndex(i))
+	default:
+		writeArrowString(b, arr.ValueStr(i))
+	}
+}
+
+// arrowFileRecordReader adapts ipc.FileReader, which reads records by index,
+// to the array.RecordReader interface
+type arrowFileRecordReader struct {
+	reader *ipc.FileReader
+	record arrow.Record
+	next   int
+	err    error
+}
+
+func (r *arrowFileRecordReader) Retain() {}
+
+func (r *arrowFileRecordReader) Release() {
+	if r.record != nil {
+		r.record.Release()
+		r.record = nil
+	}
+	r.reader.Close()
+}
+
+func (r *arrowFileRecordReader) Schema() *arrow.Schema {
+	return r.reader.Schema()
+}
+
+func (r *arrowFileRecordReader) Next() bool {
+	if r.record != nil {
+		r.record.Release()
+		r.record = nil
+	}
+
+	if r.next >= r.reader.NumRecords() {
+		return false
+	}
+
+	r.record, r.err = r.reader.RecordAt(r.next)
+	r.next++
+	return r.err == nil
+}
+
+func (r *arrowFileRecordReader) Record() arrow.Record {
+	return r.record
+}
+
+func (r *arrowFileRecordReader) Err() error {
+	return r.err
+}
+
+// tempFile removes itself from disk when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); removeErr != nil {
+		log.Error().Err(removeErr).Str("path", f.Name()).Msg("Unable to remove temp file")
+	}
+	return err
+}
+
+// spoolToTempFile copies r to a temporary file and rewinds it
+func spoolToTempFile(r io.Reader, pattern string) (tempFile, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return tempFile{}, err
+	}
+
+	spool := tempFile{f}
+	if _, err := io.Copy(f, r); err != nil {
+		spool.Close()
+		return tempFile{}, err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		spool.Close()
+		return tempFile{}, err
+	}
+
+	return spool, nil
+}
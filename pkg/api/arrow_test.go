@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+)
+
+func testArrowRecord() arrow.Record {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "ts", Type: &arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "UTC"}, Nullable: true},
+		{Name: "price", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String)},
+		{Name: "user", Type: arrow.StructOf(arrow.Field{Name: "name", Type: arrow.BinaryTypes.String})},
+		{Name: "hits", Type: arrow.PrimitiveTypes.Uint64},
+	}, nil)
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6_000_000, time.UTC)
+
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{9007199254740993, 2}, nil)
+	b.Field(1).(*array.TimestampBuilder).Append(arrow.Timestamp(ts.UnixMilli()))
+	b.Field(1).(*array.TimestampBuilder).AppendNull()
+	b.Field(2).(*array.Decimal128Builder).AppendValues([]decimal128.Num{decimal128.FromI64(1999), decimal128.FromI64(-5)}, nil)
+
+	tags := b.Field(3).(*array.ListBuilder)
+	tags.Append(true)
+	tags.ValueBuilder().(*array.StringBuilder).AppendValues([]string{"a", "b"}, nil)
+	tags.Append(true)
+
+	user := b.Field(4).(*array.StructBuilder)
+	user.AppendValues([]bool{true, true})
+	user.FieldBuilder(0).(*array.StringBuilder).AppendValues([]string{"alice", `"bob"`}, nil)
+
+	b.Field(5).(*array.Uint64Builder).AppendValues([]uint64{math.MaxUint64, 3}, nil)
+
+	return b.NewRecord()
+}
+
+var expectedArrowRows = []string{
+	`{"id":9007199254740993,"ts":"2024-01-02T03:04:05.006Z","price":"19.99","tags":["a","b"],"user":{"name":"alice"},"hits":"18446744073709551615"}`,
+	`{"id":2,"ts":null,"price":"-0.05","tags":[],"user":{"name":"\"bob\""},"hits":"3"}`,
+}
+
+func checkArrowRows(t *testing.T, decoder *ArrowDecoder) {
+	defer decoder.Close()
+
+	for _, expected := range expectedArrowRows {
+		row, err := decoder.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row != expected {
+			t.Errorf("Expected %s; got %s", expected, row)
+		}
+	}
+
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Fatalf("Expected EOF; got %v", err)
+	}
+}
+
+func TestArrowStreamDecoder(t *testing.T) {
+	record := testArrowRecord()
+	defer record.Release()
+
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(record.Schema()))
+	if err := w.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	decoder, err := NewArrowStreamDecoder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArrowRows(t, decoder)
+}
+
+func TestParquetDecoder(t *testing.T) {
+	record := testArrowRecord()
+	defer record.Release()
+
+	table := array.NewTableFromRecords(record.Schema(), []arrow.Record{record})
+	defer table.Release()
+
+	var buf bytes.Buffer
+	if err := pqarrow.WriteTable(table, &buf, 1024, nil, pqarrow.DefaultWriterProps()); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := NewParquetDecoder(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArrowRows(t, decoder)
+}
+
+func TestArrowColumns(t *testing.T) {
+	record := testArrowRecord()
+	defer record.Release()
+
+	columns := ArrowColumns(record.Schema())
+
+	// Lists are left to be inferred, and struct fields are flattened
+	expected := []string{"id int", "ts timestamp", "price decimal(10,2)", "user_name string", "hits decimal(20,0)"}
+	if len(columns) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, columns)
+	}
+	for i, column := range columns {
+		if got := column.Name + " " + column.Type.String(); got != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], got)
+		}
+	}
+}
@@ -35,6 +35,7 @@ func (a *ScratchDataAPIStruct) AuthMiddleware(next http.Handler) http.Handler {
 				dbInt = int64(-1)
 			}
 			ctx := context.WithValue(r.Context(), "databaseId", dbInt)
+			ctx = context.WithValue(ctx, "isAdmin", true)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		} else {
 			// Otherwise, this API key is specific to a user
@@ -47,14 +48,38 @@ func (a *ScratchDataAPIStruct) AuthMiddleware(next http.Handler) http.Handler {
 			}
 
 			ctx := context.WithValue(r.Context(), "databaseId", keyDetails.DestinationID)
+			ctx = context.WithValue(ctx, "maxExecutionSeconds", keyDetails.MaxExecutionSeconds)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 	})
 }
 
 func (a *ScratchDataAPIStruct) AuthGetDatabaseID(ctx context.Context) int64 {
-	dbId := ctx.Value("databaseId").(uint)
-	return int64(dbId)
+	// Admin keys pick a destination with a query param, which is -1 if missing
+	switch dbId := ctx.Value("databaseId").(type) {
+	case uint:
+		return int64(dbId)
+	case int64:
+		return dbId
+	}
+	return -1
+}
+
+// AuthIsAdmin is true for requests made with an admin API key
+func (a *ScratchDataAPIStruct) AuthIsAdmin(ctx context.Context) bool {
+	isAdmin, _ := ctx.Value("isAdmin").(bool)
+	return isAdmin
+}
+
+// RequireAdmin rejects requests which were not made with an admin API key
+func (a *ScratchDataAPIStruct) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.AuthIsAdmin(r.Context()) {
+			http.Error(w, "This endpoint requires an admin API key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (a *ScratchDataAPIStruct) Login(w http.ResponseWriter, r *http.Request) {
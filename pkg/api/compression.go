@@ -0,0 +1,157 @@
+package api
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Used when api.max_decompressed_bytes is not set
+const defaultMaxDecompressedBytes = 1 << 30
+
+var ErrBodyTooLarge = errors.New("decompressed request body is too large")
+var ErrInvalidEncoding = errors.New("invalid compressed request body")
+var ErrUnsupportedEncoding = errors.New("unsupported Content-Encoding")
+
+// Content types which are compressed when the client sends Accept-Encoding
+var compressibleQueryTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/csv",
+	"text/tab-separated-values",
+	"application/vnd.apache.arrow.stream",
+}
+
+func (a *ScratchDataAPIStruct) maxDecompressedBytes() int64 {
+	if a.config.MaxDecompressedBytes > 0 {
+		return a.config.MaxDecompressedBytes
+	}
+	return defaultMaxDecompressedBytes
+}
+
+// DecompressBody transparently decodes gzip, zstd and snappy request bodies
+// based on the Content-Encoding header. Reads fail with ErrBodyTooLarge once
+// the decompressed body exceeds api.max_decompressed_bytes.
+func (a *ScratchDataAPIStruct) DecompressBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if encoding == "" || encoding == "identity" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := newDecompressedBody(encoding, r.Body, a.maxDecompressedBytes())
+		if errors.Is(err, ErrUnsupportedEncoding) {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		} else if err != nil {
+			http.Error(w, ErrInvalidEncoding.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.Body = body
+		r.ContentLength = -1
+		r.Header.Del("Content-Encoding")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewQueryCompressor compresses query results with zstd, gzip or deflate,
+// depending on the request's Accept-Encoding header
+func NewQueryCompressor() *middleware.Compressor {
+	compressor := middleware.NewCompressor(flate.DefaultCompression, compressibleQueryTypes...)
+	compressor.SetEncoder("zstd", func(w io.Writer, level int) io.Writer {
+		encoder, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil
+		}
+		return encoder
+	})
+	return compressor
+}
+
+// rawBody remembers whether the underlying request body failed, so that
+// errors from the decompressor can be told apart from network errors
+type rawBody struct {
+	r   io.Reader
+	err error
+}
+
+func (b *rawBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+type decompressedBody struct {
+	raw       *rawBody
+	body      io.Closer
+	decoder   io.Reader
+	close     func()
+	remaining int64
+}
+
+func newDecompressedBody(encoding string, body io.ReadCloser, limit int64) (*decompressedBody, error) {
+	raw := &rawBody{r: body}
+	d := &decompressedBody{raw: raw, body: body, remaining: limit, close: func() {}}
+
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(raw)
+		if err != nil {
+			return nil, err
+		}
+		d.decoder = reader
+		d.close = func() { reader.Close() }
+	case "zstd":
+		reader, err := zstd.NewReader(raw, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		d.decoder = reader
+		d.close = reader.Close
+	case "snappy", "x-snappy-framed":
+		d.decoder = snappy.NewReader(raw)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+
+	return d, nil
+}
+
+func (d *decompressedBody) Read(p []byte) (int, error) {
+	// Read one byte past the limit so we can tell whether it was exceeded
+	if int64(len(p)) > d.remaining+1 {
+		p = p[:d.remaining+1]
+	}
+
+	n, err := d.decoder.Read(p)
+	if int64(n) > d.remaining {
+		n = int(d.remaining)
+		d.remaining = 0
+		return n, ErrBodyTooLarge
+	}
+	d.remaining -= int64(n)
+
+	if err != nil && err != io.EOF && d.raw.err == nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidEncoding, err)
+	}
+
+	return n, err
+}
+
+func (d *decompressedBody) Close() error {
+	d.close()
+	return d.body.Close()
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(data))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressedBody(t *testing.T) {
+	data := strings.Repeat(`{"a":1}`+"\n", 100)
+
+	var zstdBuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zstdBuf)
+	zw.Write([]byte(data))
+	zw.Close()
+
+	bodies := map[string][]byte{
+		"gzip": gzipBytes(t, data),
+		"zstd": zstdBuf.Bytes(),
+	}
+
+	for encoding, compressed := range bodies {
+		body, err := newDecompressedBody(encoding, io.NopCloser(bytes.NewReader(compressed)), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if string(out) != data {
+			t.Fatalf("%s: body did not round trip", encoding)
+		}
+	}
+}
+
+func TestDecompressedBodyLimit(t *testing.T) {
+	compressed := gzipBytes(t, strings.Repeat("a", 10_000))
+
+	body, err := newDecompressedBody("gzip", io.NopCloser(bytes.NewReader(compressed)), 9_999)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := io.ReadAll(body)
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("Expected ErrBodyTooLarge; got %v", err)
+	}
+	if len(out) != 9_999 {
+		t.Fatalf("Expected 9999 bytes before the limit; got %d", len(out))
+	}
+}
+
+func TestDecompressedBodyCorrupt(t *testing.T) {
+	compressed := gzipBytes(t, strings.Repeat("a", 10_000))
+	compressed = compressed[:len(compressed)-4]
+
+	body, err := newDecompressedBody("gzip", io.NopCloser(bytes.NewReader(compressed)), 1_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.ReadAll(body); !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("Expected ErrInvalidEncoding; got %v", err)
+	}
+
+	if _, err := newDecompressedBody("br", io.NopCloser(bytes.NewReader(compressed)), 1); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Fatalf("Expected ErrUnsupportedEncoding; got %v", err)
+	}
+}
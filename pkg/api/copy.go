@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	dbModels "github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	queueModels "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+// CopyRequest copies a table, or the result of a query, from the destination
+// chosen with destination_id to TargetID. TargetTable defaults to Table, and
+// is required when copying a query.
+type CopyRequest struct {
+	TargetID    int64         `json:"target_id"`
+	Table       string        `json:"table"`
+	Query       string        `json:"query"`
+	Params      models.Params `json:"params"`
+	TargetTable string        `json:"target_table"`
+}
+
+type CopyJobResponse struct {
+	ID           string                  `json:"id"`
+	Status       dbModels.QueryJobStatus `json:"status"`
+	SourceID     int64                   `json:"source_id"`
+	TargetID     int64                   `json:"target_id"`
+	Table        string                  `json:"target_table"`
+	Exported     bool                    `json:"exported"`
+	Rows         int64                   `json:"rows"`
+	LoadedRows   int64                   `json:"loaded_rows"`
+	Chunks       int                     `json:"chunks"`
+	LoadedChunks int                     `json:"loaded_chunks"`
+	Error        string                  `json:"error,omitempty"`
+	CreatedAt    time.Time               `json:"created_at"`
+	StartedAt    *time.Time              `json:"started_at,omitempty"`
+	FinishedAt   *time.Time              `json:"finished_at,omitempty"`
+}
+
+func (a *ScratchDataAPIStruct) copyJobResponse(r *http.Request, job dbModels.CopyJob) CopyJobResponse {
+	response := CopyJobResponse{
+		ID:         job.UUID,
+		Status:     job.Status,
+		SourceID:   job.SourceID,
+		TargetID:   job.TargetID,
+		Table:      job.Table,
+		Exported:   job.Exported,
+		Rows:       job.Rows,
+		LoadedRows: job.LoadedRows,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+
+	// Chunks are deleted once the job has finished
+	chunks, err := a.storageServices.Database.GetCopyChunks(r.Context(), job.ID)
+	if err != nil {
+		log.Error().Err(err).Str("job_id", job.UUID).Msg("Unable to get copy chunks")
+	}
+	response.Chunks = len(chunks)
+	for _, chunk := range chunks {
+		if chunk.LoadedAt != nil {
+			response.LoadedChunks++
+		}
+	}
+
+	return response
+}
+
+// copyJob loads the job named in the URL, writing a 404 if it does not exist
+func (a *ScratchDataAPIStruct) copyJob(w http.ResponseWriter, r *http.Request) (dbModels.CopyJob, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return dbModels.CopyJob{}, false
+	}
+
+	job, ok := a.storageServices.Database.GetCopyJob(r.Context(), id)
+	if !ok {
+		http.Error(w, "Copy job not found", http.StatusNotFound)
+		return dbModels.CopyJob{}, false
+	}
+
+	return job, true
+}
+
+// CreateCopyJob queues a copy to run on a worker and returns its ID immediately
+func (a *ScratchDataAPIStruct) CreateCopyJob(w http.ResponseWriter, r *http.Request) {
+	sourceID := a.AuthGetDatabaseID(r.Context())
+	if sourceID < 0 {
+		http.Error(w, "destination_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var request CopyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := request.Query
+	switch {
+	case request.Table != "" && request.Query != "":
+		http.Error(w, "Only one of table or query may be set", http.StatusBadRequest)
+		return
+	case request.Table != "":
+		if !util.ValidTableName(request.Table) {
+			http.Error(w, "Invalid table name", http.StatusBadRequest)
+			return
+		}
+		query = "SELECT * FROM " + request.Table
+		if request.TargetTable == "" {
+			request.TargetTable = request.Table
+		}
+	case request.Query == "":
+		http.Error(w, "One of table or query is required", http.StatusBadRequest)
+		return
+	}
+
+	if !util.ValidTableName(request.TargetTable) {
+		http.Error(w, "Invalid or missing target_table", http.StatusBadRequest)
+		return
+	}
+	if request.TargetID == sourceID && request.TargetTable == request.Table {
+		http.Error(w, "The target table is the table being copied", http.StatusBadRequest)
+		return
+	}
+	if _, err := a.destinationManager.Destination(r.Context(), request.TargetID); err != nil {
+		http.Error(w, "Invalid target_id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := dbModels.CopyJob{
+		SourceID: sourceID,
+		TargetID: request.TargetID,
+		Query:    query,
+		Params:   request.Params,
+		Table:    request.TargetTable,
+	}
+	if err := a.storageServices.Database.CreateCopyJob(r.Context(), &job); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := queueModels.CopyJobMessage{JobID: job.UUID, DestinationID: job.TargetID, Table: job.Table}
+	if _, err := a.storageServices.Database.Enqueue(dbModels.CopyData, message); err != nil {
+		log.Error().Err(err).Str("job_id", job.UUID).Msg("Unable to enqueue copy job")
+
+		job.Status = dbModels.JobFailed
+		job.Error = "Unable to queue job"
+		a.storageServices.Database.UpdateCopyJob(r.Context(), &job, dbModels.JobQueued)
+
+		http.Error(w, "Unable to queue job", http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, a.copyJobResponse(r, job))
+}
+
+func (a *ScratchDataAPIStruct) GetCopyJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.copyJob(w, r)
+	if !ok {
+		return
+	}
+
+	render.JSON(w, r, a.copyJobResponse(r, job))
+}
+
+// CancelCopyJob stops a copy. Chunks which were already loaded stay in the target.
+func (a *ScratchDataAPIStruct) CancelCopyJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.copyJob(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	job.Status = dbModels.JobCancelled
+	job.FinishedAt = &now
+
+	updated, err := a.storageServices.Database.UpdateCopyJob(r.Context(), &job, dbModels.JobQueued, dbModels.JobRunning)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !updated {
+		http.Error(w, "Copy job has already finished", http.StatusConflict)
+		return
+	}
+
+	render.JSON(w, r, a.copyJobResponse(r, job))
+}
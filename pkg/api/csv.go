@@ -0,0 +1,341 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/scratchdata/scratchdata/pkg/util"
+	"github.com/tidwall/gjson"
+)
+
+var ErrInvalidCSV = errors.New("invalid CSV record")
+
+// DelimitedOptions control how CSV and TSV bodies are parsed
+type DelimitedOptions struct {
+	Delimiter rune
+
+	// Quote character, or 0 to disable quoting
+	Quote rune
+
+	// Whether the first record holds column names. Otherwise columns
+	// are named column0, column1, ...
+	Header bool
+
+	// Fields equal to this token become JSON null
+	Null    string
+	HasNull bool
+
+	// Convert numeric and boolean fields to JSON numbers and booleans.
+	// Numbers with leading zeros are kept as strings.
+	InferTypes bool
+}
+
+func singleRune(s string) (rune, error) {
+	if s == `\t` {
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || size != len(s) || r == '\n' || r == '\r' {
+		return 0, fmt.Errorf("%#q must be a single character", s)
+	}
+	return r, nil
+}
+
+// ParseDelimitedOptions reads options from the query string, falling back to
+// the "header" parameter of the Content-Type (RFC 4180) and the defaults for
+// the given media type
+func ParseDelimitedOptions(mediaType string, mediaParams map[string]string, query url.Values) (DelimitedOptions, error) {
+	opts := DelimitedOptions{
+		Delimiter:  ',',
+		Quote:      '"',
+		Header:     mediaParams["header"] != "absent",
+		InferTypes: true,
+	}
+
+	if mediaType == "text/tab-separated-values" {
+		opts.Delimiter = '\t'
+	}
+
+	var err error
+	if query.Has("delimiter") {
+		if opts.Delimiter, err = singleRune(query.Get("delimiter")); err != nil {
+			return opts, fmt.Errorf("delimiter: %w", err)
+		}
+	}
+
+	if query.Has("quote") {
+		if query.Get("quote") == "" {
+			opts.Quote = 0
+		} else if opts.Quote, err = singleRune(query.Get("quote")); err != nil {
+			return opts, fmt.Errorf("quote: %w", err)
+		}
+	}
+
+	if opts.Quote == opts.Delimiter {
+		return opts, errors.New("quote and delimiter must be different")
+	}
+
+	if query.Has("header") {
+		if opts.Header, err = strconv.ParseBool(query.Get("header")); err != nil {
+			return opts, fmt.Errorf("header: %w", err)
+		}
+	}
+
+	if query.Has("null") {
+		opts.Null = query.Get("null")
+		opts.HasNull = true
+	}
+
+	if query.Has("infer_types") {
+		if opts.InferTypes, err = strconv.ParseBool(query.Get("infer_types")); err != nil {
+			return opts, fmt.Errorf("infer_types: %w", err)
+		}
+	}
+
+	return opts, nil
+}
+
+// DelimitedDecoder converts CSV or TSV records to JSON objects, one record at a time
+type DelimitedDecoder struct {
+	reader  *bufio.Reader
+	opts    DelimitedOptions
+	columns []string
+	started bool
+
+	// Whether a leading byte order mark has been looked for
+	bomChecked bool
+}
+
+func NewDelimitedDecoder(r io.Reader, opts DelimitedOptions) *DelimitedDecoder {
+	return &DelimitedDecoder{
+		reader: bufio.NewReaderSize(r, 64*1024),
+		opts:   opts,
+	}
+}
+
+type delimitedField struct {
+	value  string
+	quoted bool
+}
+
+// readRecord reads fields up to the next unquoted line break
+func (d *DelimitedDecoder) readRecord() ([]delimitedField, error) {
+	var fields []delimitedField
+	var field strings.Builder
+	inQuotes := false
+	quoted := false
+	size := 0
+	tooLong := false
+
+	endField := func() {
+		fields = append(fields, delimitedField{value: field.String(), quoted: quoted})
+		field.Reset()
+		quoted = false
+	}
+
+	for {
+		r, n, err := d.reader.ReadRune()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, ErrInvalidCSV
+			}
+			if len(fields) == 0 && field.Len() == 0 && !quoted {
+				return nil, io.EOF
+			}
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		size += n
+		if size > maxNDJSONLineBytes {
+			// Keep parsing to find the end of the record, but stop buffering
+			tooLong = true
+			field.Reset()
+		}
+
+		if inQuotes {
+			if r == d.opts.Quote {
+				next, _, err := d.reader.ReadRune()
+				if err == nil && next == d.opts.Quote {
+					if !tooLong {
+						field.WriteRune(r)
+					}
+					continue
+				} else if err == nil {
+					d.reader.UnreadRune()
+				}
+				inQuotes = false
+				continue
+			}
+
+			if !tooLong {
+				field.WriteRune(r)
+			}
+			continue
+		}
+
+		// A carriage return ending the record is dropped, even after a quoted field
+		if r == '\r' {
+			next, _, err := d.reader.ReadRune()
+			if err == io.EOF || (err == nil && next == '\n') {
+				break
+			} else if err == nil {
+				d.reader.UnreadRune()
+			}
+		}
+
+		if r == '\n' {
+			break
+		} else if r == d.opts.Delimiter {
+			endField()
+		} else if d.opts.Quote != 0 && r == d.opts.Quote && field.Len() == 0 && !quoted {
+			inQuotes = true
+			quoted = true
+		} else if !tooLong {
+			field.WriteRune(r)
+		}
+	}
+
+	endField()
+
+	if tooLong {
+		return nil, ErrLineTooLong
+	}
+
+	return fields, nil
+}
+
+// headerColumns names the columns after the header. Empty names are numbered
+// as without a header, and repeated names get a suffix (id, id_2) so that
+// each value has its own key.
+func headerColumns(fields []delimitedField) []string {
+	columns := make([]string, len(fields))
+	seen := map[string]bool{}
+	for i, f := range fields {
+		base := f.value
+		if base == "" {
+			base = "column" + strconv.Itoa(i)
+		}
+		name := base
+		for n := 2; seen[name]; n++ {
+			name = base + "_" + strconv.Itoa(n)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	return columns
+}
+
+func (d *DelimitedDecoder) column(i int) string {
+	if i < len(d.columns) {
+		return d.columns[i]
+	}
+	return "column" + strconv.Itoa(i)
+}
+
+// jsonValue converts a single field to a JSON literal
+func (d *DelimitedDecoder) jsonValue(f delimitedField) string {
+	if d.opts.HasNull && !f.quoted && f.value == d.opts.Null {
+		return "null"
+	}
+
+	if d.opts.InferTypes && !f.quoted {
+		if looksNumeric(f.value) {
+			return f.value
+		}
+
+		switch f.value {
+		case "true", "TRUE", "True":
+			return "true"
+		case "false", "FALSE", "False":
+			return "false"
+		}
+	}
+
+	return `"` + util.JsonEscape(f.value) + `"`
+}
+
+// looksNumeric is true for strings which are valid JSON numbers. Values with
+// leading zeros such as zip codes are not treated as numbers.
+func looksNumeric(s string) bool {
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return false
+	}
+
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return false
+	}
+
+	parsed := gjson.Parse(s)
+	return gjson.Valid(s) && parsed.Type == gjson.Number && parsed.Raw == s
+}
+
+// utf8BOM is written at the start of CSV files by Excel, among others
+const utf8BOM = "\xEF\xBB\xBF"
+
+// skipBOM drops a UTF-8 byte order mark from the start of the body, so that
+// it does not become part of the first column name
+func (d *DelimitedDecoder) skipBOM() error {
+	d.bomChecked = true
+	prefix, err := d.reader.Peek(len(utf8BOM))
+	if string(prefix) == utf8BOM {
+		_, err = d.reader.Discard(len(utf8BOM))
+		return err
+	}
+	if err == io.EOF || errors.Is(err, bufio.ErrBufferFull) {
+		return nil
+	}
+	return err
+}
+
+func (d *DelimitedDecoder) Next() (string, error) {
+	if !d.bomChecked {
+		if err := d.skipBOM(); err != nil {
+			return "", err
+		}
+	}
+
+	for {
+		fields, err := d.readRecord()
+		if err != nil {
+			return "", err
+		}
+
+		// Skip blank lines
+		if len(fields) == 1 && fields[0].value == "" && !fields[0].quoted {
+			continue
+		}
+
+		if !d.started {
+			d.started = true
+			if d.opts.Header {
+				d.columns = headerColumns(fields)
+				continue
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString("{")
+		for i, f := range fields {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(`"`)
+			b.WriteString(util.JsonEscape(d.column(i)))
+			b.WriteString(`":`)
+			b.WriteString(d.jsonValue(f))
+		}
+		b.WriteString("}")
+
+		return b.String(), nil
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, decoder RecordDecoder) []string {
+	rc := []string{}
+	for {
+		line, err := decoder.Next()
+		if err == io.EOF {
+			return rc
+		}
+		if err != nil {
+			rc = append(rc, err.Error())
+			continue
+		}
+		rc = append(rc, line)
+	}
+}
+
+func TestDelimitedDecoder(t *testing.T) {
+	input := "zip,name,amount,active,note\r\n" +
+		"02134,\"Smith, J\",12.5,true,\r\n" +
+		"\n" +
+		"94107,\"say \"\"hi\"\"\",-3,FALSE,NULL\r\n" +
+		"10001,\"multi\nline\",7,x,\"NULL\""
+
+	opts, err := ParseDelimitedOptions("text/csv", nil, url.Values{"null": {"NULL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAll(t, NewDelimitedDecoder(strings.NewReader(input), opts))
+	expected := []string{
+		`{"zip":"02134","name":"Smith, J","amount":12.5,"active":true,"note":""}`,
+		`{"zip":94107,"name":"say \"hi\"","amount":-3,"active":false,"note":null}`,
+		`{"zip":10001,"name":"multi\nline","amount":7,"active":"x","note":"NULL"}`,
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records; got %d: %v", len(expected), len(records), records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("record %d: expected %#q; got %#q", i, expected[i], records[i])
+		}
+	}
+}
+
+func TestDelimitedDecoderCRLFQuotedLastField(t *testing.T) {
+	input := "a,b\r\n1,\"x\"\r\n2,\"y\r\"\r\n3,\"z\"\r"
+
+	opts, err := ParseDelimitedOptions("text/csv", nil, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAll(t, NewDelimitedDecoder(strings.NewReader(input), opts))
+	expected := []string{
+		`{"a":1,"b":"x"}`,
+		`{"a":2,"b":"y\r"}`,
+		`{"a":3,"b":"z"}`,
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records; got %d: %v", len(expected), len(records), records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("record %d: expected %#q; got %#q", i, expected[i], records[i])
+		}
+	}
+}
+
+func TestDelimitedDecoderBOM(t *testing.T) {
+	opts, err := ParseDelimitedOptions("text/csv", nil, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"\xEF\xBB\xBFid,name\r\n1,a\r\n": {`{"id":1,"name":"a"}`},
+		"\xEF\xBB\xBF":                   {},
+	}
+	for input, expected := range tests {
+		records := readAll(t, NewDelimitedDecoder(strings.NewReader(input), opts))
+		if strings.Join(records, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%q: expected %v; got %v", input, expected, records)
+		}
+	}
+}
+
+func TestDelimitedDecoderHeaderNames(t *testing.T) {
+	opts, err := ParseDelimitedOptions("text/csv", nil, url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := "id,,id,id_2,id\n1,2,3,4,5\n"
+	records := readAll(t, NewDelimitedDecoder(strings.NewReader(input), opts))
+	expected := `{"id":1,"column1":2,"id_2":3,"id_2_2":4,"id_3":5}`
+
+	if len(records) != 1 || records[0] != expected {
+		t.Fatalf("Expected %v; got %v", expected, records)
+	}
+}
+
+func TestDelimitedDecoderOptions(t *testing.T) {
+	query := url.Values{"header": {"false"}, "quote": {"'"}, "infer_types": {"false"}}
+	opts, err := ParseDelimitedOptions("text/tab-separated-values", nil, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAll(t, NewDelimitedDecoder(strings.NewReader("1\t'a\tb'\n'unterminated"), opts))
+	expected := []string{
+		`{"column0":"1","column1":"a\tb"}`,
+		ErrInvalidCSV.Error(),
+	}
+
+	if strings.Join(records, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Expected %v; got %v", expected, records)
+	}
+
+	if _, err := ParseDelimitedOptions("text/csv", nil, url.Values{"delimiter": {"ab"}}); err == nil {
+		t.Fatal("Expected error for multi-character delimiter")
+	}
+}
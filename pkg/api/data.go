@@ -2,18 +2,28 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/storage/cache"
+	"github.com/scratchdata/scratchdata/pkg/util"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 )
 
+var ErrQueryTimeout = errors.New("query exceeded the maximum execution time")
+
 var insertSize = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name:    "insert_bytes",
 	Help:    "Bytes inserted in single request",
@@ -26,51 +36,204 @@ var insertArraySize = promauto.NewHistogram(prometheus.HistogramOpts{
 	Buckets: prometheus.LinearBuckets(1, 50, 10),
 })
 
-func (a *ScratchDataAPIStruct) Select(w http.ResponseWriter, r *http.Request) {
-	databaseID := a.AuthGetDatabaseID(r.Context())
+// QueryRequest is a JSON query body. {name} placeholders in Query are bound to Params.
+type QueryRequest struct {
+	Query  string        `json:"query"`
+	Params models.Params `json:"params"`
+}
 
+// readQuery gets the SQL from the "query" parameter or, for POST requests, the body.
+// A JSON body is read as a QueryRequest. If the query is missing an error response
+// is written and false is returned.
+func readQuery(w http.ResponseWriter, r *http.Request) (string, models.Params, bool) {
 	var query string
+	var params models.Params
 	query = r.URL.Query().Get("query")
 
-	format := r.URL.Query().Get("format")
-
 	if r.Method == "POST" {
 		queryBytes, err := io.ReadAll(r.Body)
-		if err != nil && len(queryBytes) > 0 {
+		if errors.Is(err, ErrBodyTooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return "", nil, false
+		} else if errors.Is(err, ErrInvalidEncoding) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return "", nil, false
+		} else if err != nil && len(queryBytes) > 0 {
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write([]byte("Unable to read query"))
-			return
+			return "", nil, false
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "application/json" {
+			var request QueryRequest
+			if err := json.Unmarshal(queryBytes, &request); err != nil {
+				http.Error(w, "Invalid query request: "+err.Error(), http.StatusBadRequest)
+				return "", nil, false
+			}
+			query, params = request.Query, request.Params
+		} else if len(queryBytes) > 0 {
+			query = string(queryBytes)
 		}
-		query = string(queryBytes)
 	}
 
 	if strings.TrimSpace(query) == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("Query cannot be blank"))
+		return "", nil, false
+	}
+
+	return query, params, true
+}
+
+func (a *ScratchDataAPIStruct) Select(w http.ResponseWriter, r *http.Request) {
+	databaseID := a.AuthGetDatabaseID(r.Context())
+
+	format, err := models.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := a.executeQueryAndStreamData(r.Context(), w, query, databaseID, format); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	cacheTTL, err := parseCacheTTL(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, params, ok := readQuery(w, r)
+	if !ok {
+		return
+	}
+
+	cursor, paged, err := a.parsePage(r, databaseID, query, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if paged {
+		if err := a.executePagedQuery(r.Context(), w, query, params, databaseID, format, cursor); err != nil {
+			writeQueryError(w, err)
+		}
+		return
+	}
+
+	if err := a.executeQueryAndStreamData(r.Context(), w, query, params, databaseID, format, cacheTTL); err != nil {
+		writeQueryError(w, err)
+	}
+}
+
+// queryTimeout is the smaller of the global and API key execution limits. 0 means no limit.
+func (a *ScratchDataAPIStruct) queryTimeout(ctx context.Context) time.Duration {
+	seconds := a.config.MaxExecutionSeconds
+
+	keySeconds, _ := ctx.Value("maxExecutionSeconds").(int)
+	if keySeconds > 0 && (seconds <= 0 || keySeconds < seconds) {
+		seconds = keySeconds
 	}
+
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
 }
 
-func (a *ScratchDataAPIStruct) executeQueryAndStreamData(ctx context.Context, w http.ResponseWriter, query string, databaseID int64, format string) error {
+// queryContext marks requests which were not made with an admin key as read-only,
+// so that the destination can enforce it too
+func (a *ScratchDataAPIStruct) queryContext(ctx context.Context) context.Context {
+	if a.AuthIsAdmin(ctx) {
+		return ctx
+	}
+	return util.WithReadOnly(ctx)
+}
+
+// checkQuery allows only read-only queries unless the request was made with an admin key,
+// and makes sure every placeholder has a parameter
+func (a *ScratchDataAPIStruct) checkQuery(ctx context.Context, query string, params models.Params) error {
+	if !a.AuthIsAdmin(ctx) {
+		if err := util.CheckReadOnlyQuery(query); err != nil {
+			return err
+		}
+	}
+	return util.CheckParams(query, params)
+}
+
+// executeQueryAndStreamData runs the query on the destination until it finishes, the
+// client goes away or the execution limit is reached. Either way the destination
+// cancels the query on its side.
+//
+// If cacheTTL is positive and a cache is configured, a cached result is served
+// when there is one, and otherwise the result is cached for cacheTTL.
+func (a *ScratchDataAPIStruct) executeQueryAndStreamData(ctx context.Context, w http.ResponseWriter, query string, params models.Params, databaseID int64, format models.Format, cacheTTL time.Duration) error {
+	if err := a.checkQuery(ctx, query, params); err != nil {
+		return err
+	}
+
+	var out io.Writer = w
+	var cacheKey string
+	var result *cappedBuffer
+	if a.queryCacheEnabled(cacheTTL) {
+		cacheKey = cache.QueryResultKey(a.storageServices.Cache, databaseID, query, params, format)
+		if cached, ok := a.storageServices.Cache.Get(cacheKey); ok {
+			queryCacheHits.Inc()
+			w.Header().Set("Content-Type", format.ContentType())
+			w.Header().Set(CacheStatusHeader, "HIT")
+			_, err := w.Write(cached)
+			return err
+		}
+
+		queryCacheMisses.Inc()
+		w.Header().Set(CacheStatusHeader, "MISS")
+		result = &cappedBuffer{limit: a.queryCacheMaxBytes()}
+		out = io.MultiWriter(w, result)
+	}
+
 	dest, err := a.destinationManager.Destination(ctx, databaseID)
 	if err != nil {
 		return err
 	}
 
-	switch strings.ToLower(format) {
-	case "csv":
-		w.Header().Set("Content-Type", "text/csv")
-		return dest.QueryCSV(query, w)
-	default:
-		w.Header().Set("Content-Type", "application/json")
-		return dest.QueryJSON(query, w)
+	ctx = a.queryContext(ctx)
+	if timeout := a.queryTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	err = dest.Query(ctx, query, params, format, out)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrQueryTimeout
+	}
+
+	if err == nil && result != nil && !result.overflow {
+		if err := a.storageServices.Cache.Set(cacheKey, result.Bytes(), &cacheTTL); err != nil {
+			log.Error().Err(err).Int64("destination_id", databaseID).Msg("Unable to cache query result")
+		}
+	}
+	return err
 }
 
+// writeQueryError responds with a status code for errors from executeQueryAndStreamData
+func writeQueryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrQueryTimeout) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	if errors.Is(err, util.ErrQueryNotAllowed) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, util.ErrInvalidParam) || errors.Is(err, ErrUnorderedPage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// Insert writes JSON, NDJSON, CSV, TSV, Parquet or Arrow data to a table. The response is an InsertResult
+// which lists every rejected row so clients can retry only those rows.
 func (a *ScratchDataAPIStruct) Insert(w http.ResponseWriter, r *http.Request) {
 	databaseID := a.AuthGetDatabaseID(r.Context())
 	table := chi.URLParam(r, "table")
@@ -83,71 +246,225 @@ func (a *ScratchDataAPIStruct) Insert(w http.ResponseWriter, r *http.Request) {
 		flattener = HorizontalFlattener{}
 	}
 
+	idempotencyKey := ""
+	if a.idempotencyEnabled() {
+		idempotencyKey = r.Header.Get(IdempotencyKeyHeader)
+		if idempotencyKey != "" && a.replayInsert(w, databaseID, table, idempotencyKey) {
+			return
+		}
+	}
+
+	result := NewInsertResult()
+
+	mediaType, mediaParams, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson":
+		newDecoder := func(body io.Reader) RecordDecoder {
+			return NewNDJSONDecoder(body)
+		}
+		a.insertStream(r, newDecoder, databaseID, table, flattener, result)
+	case "text/csv", "text/tab-separated-values":
+		opts, err := ParseDelimitedOptions(mediaType, mediaParams, r.URL.Query())
+		if err != nil {
+			result.Fail(http.StatusBadRequest, err.Error())
+			break
+		}
+
+		newDecoder := func(body io.Reader) RecordDecoder {
+			return NewDelimitedDecoder(body, opts)
+		}
+		a.insertStream(r, newDecoder, databaseID, table, flattener, result)
+	case "application/vnd.apache.parquet", "application/x-parquet",
+		"application/vnd.apache.arrow.stream", "application/vnd.apache.arrow.file":
+		a.insertArrow(r, mediaType, databaseID, table, flattener, result)
+	default:
+		a.insertJSON(r, databaseID, table, flattener, result)
+	}
+
+	render.Status(r, result.Finish())
+
+	if idempotencyKey != "" {
+		response, err := json.Marshal(result)
+		if err != nil {
+			log.Error().Err(err).Msg("Unable to encode insert result")
+		} else {
+			a.rememberInsert(databaseID, table, idempotencyKey, result, response)
+		}
+	}
+
+	render.JSON(w, r, result)
+}
+
+func (a *ScratchDataAPIStruct) insertJSON(r *http.Request, databaseID int64, table string, flattener Flattener, result *InsertResult) {
 	body, err := io.ReadAll(r.Body)
 	insertSize.Observe(float64(len(body)))
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Unable to read data"))
+		failBodyRead(result, err)
 		return
 	}
 
-	if !gjson.ValidBytes(body) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid JSON"))
+	decoder, err := NewJSONDecoder(body)
+	if err != nil {
+		result.Fail(http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	parsed := gjson.ParseBytes(body)
+	insertArraySize.Observe(float64(decoder.Len()))
+	a.insertRecords(decoder, databaseID, table, flattener, result)
+}
 
-	parsed.IsArray()
-	lines := parsed.Array()
+// insertStream decodes the request body one record at a time into the data sink
+// so memory use does not grow with the size of the upload
+func (a *ScratchDataAPIStruct) insertStream(r *http.Request, newDecoder func(io.Reader) RecordDecoder, databaseID int64, table string, flattener Flattener, result *InsertResult) {
+	body := &countingReader{r: r.Body}
 
-	insertArraySize.Observe(float64(len(lines)))
+	a.insertRecords(newDecoder(body), databaseID, table, flattener, result)
 
-	errorItems := map[int]bool{}
-	for i, line := range lines {
-		flatItems, err := flattener.Flatten(table, line.Raw)
-		if err != nil {
-			errorItems[i] = true
-			log.Trace().Err(err).Str("json", line.Raw).Msg("Unable to flatten JSON")
-			continue
-		}
+	insertSize.Observe(float64(body.n))
+	insertArraySize.Observe(float64(result.Accepted + result.Rejected))
+}
+
+// insertArrow converts Parquet or Arrow IPC record batches to JSON rows, keeping
+// the column types from the source schema
+func (a *ScratchDataAPIStruct) insertArrow(r *http.Request, mediaType string, databaseID int64, table string, flattener Flattener, result *InsertResult) {
+	body := &countingReader{r: r.Body}
+
+	var decoder *ArrowDecoder
+	var err error
+	switch mediaType {
+	case "application/vnd.apache.arrow.stream":
+		decoder, err = NewArrowStreamDecoder(body)
+	case "application/vnd.apache.arrow.file":
+		decoder, err = NewArrowFileDecoder(body)
+	default:
+		decoder, err = NewParquetDecoder(r.Context(), body)
+	}
+
+	if errors.Is(err, ErrBodyTooLarge) || errors.Is(err, ErrInvalidEncoding) {
+		failBodyRead(result, err)
+		return
+	} else if err != nil {
+		log.Debug().Err(err).Str("content_type", mediaType).Msg("Unable to open columnar body")
+		result.Fail(http.StatusBadRequest, "Unable to read "+mediaType+" data")
+		return
+	}
+	defer decoder.Close()
+
+	a.createArrowColumns(r.Context(), databaseID, table, decoder)
+	a.insertRecords(decoder, databaseID, table, flattener, result)
 
-		for _, flatItem := range flatItems {
-			var writeErr error
-			var toWrite string
+	insertSize.Observe(float64(body.n))
+	insertArraySize.Observe(float64(result.Accepted + result.Rejected))
+}
 
-			toWrite = flatItem.JSON
+// createArrowColumns creates the table's missing columns with the types of the
+// Arrow schema before the rows are queued. Existing columns keep their type. If
+// the destination cannot be reached the rows are still accepted, and the worker
+// infers the types of their columns as it does for JSON.
+func (a *ScratchDataAPIStruct) createArrowColumns(ctx context.Context, databaseID int64, table string, decoder *ArrowDecoder) {
+	columns := ArrowColumns(decoder.Schema())
+	if len(columns) == 0 || !util.ValidTableName(table) {
+		return
+	}
+
+	dest, err := a.destinationManager.Destination(ctx, databaseID)
+	if err == nil {
+		err = dest.CreateEmptyTable(table)
+	}
+	if err == nil {
+		err = dest.CreateDeclaredColumns(table, columns)
+	}
+	if err != nil {
+		log.Error().Err(err).Int64("destination_id", databaseID).Str("table", table).Msg("Unable to create columns from the Arrow schema")
+	}
+}
+
+// failBodyRead sets the status for a request body which could not be read
+func failBodyRead(result *InsertResult, err error) {
+	switch {
+	case errors.Is(err, ErrBodyTooLarge):
+		result.Fail(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, ErrInvalidEncoding):
+		result.Fail(http.StatusBadRequest, err.Error())
+	default:
+		log.Error().Err(err).Msg("Unable to read request body")
+		result.Fail(http.StatusInternalServerError, "Unable to read data")
+	}
+}
+
+func (a *ScratchDataAPIStruct) insertRecords(decoder RecordDecoder, databaseID int64, table string, flattener Flattener, result *InsertResult) {
+	// Rows which already carry a __row_id are only written once per idempotency window
+	dedupe := a.idempotencyEnabled()
+
+	for i := 0; ; i++ {
+		line, err := decoder.Next()
+		if err == io.EOF {
+			return
+		}
 
-			if !gjson.Get(flatItem.JSON, "__row_id").Exists() {
-				snowID := a.snow.Generate()
-				rowID := snowID.Int64()
-				if toWrite, err = sjson.Set(flatItem.JSON, "__row_id", rowID); err != nil {
-					log.Trace().Err(err).Str("json", flatItem.JSON).Msg("Unable to add __row_id")
+		var rowID string
+		written := 0
+		if err == nil {
+			if dedupe {
+				rowID = gjson.Get(line, "__row_id").String()
+				if rowID != "" && !a.claimRow(databaseID, table, rowID) {
+					result.Duplicate()
+					continue
 				}
 			}
 
-			writeErr = a.dataSink.WriteData(databaseID, flatItem.Table, []byte(toWrite))
+			written, err = a.insertRecord(databaseID, table, flattener, line)
+		} else if !errors.Is(err, ErrInvalidJSON) && !errors.Is(err, ErrLineTooLong) && !errors.Is(err, ErrInvalidCSV) {
+			failBodyRead(result, err)
+			return
+		}
 
-			if writeErr != nil {
-				errorItems[i] = true
-				log.Trace().Err(writeErr).Str("json", flatItem.JSON).Msg("Unable to write JSON")
+		if err != nil {
+			log.Trace().Err(err).Int("row", i).Msg("Unable to insert row")
+			result.Reject(i, errorReason(err), err)
+			// Once part of a record has been written, a retry would write
+			// that part again, so the claim is kept
+			if rowID != "" && written == 0 {
+				a.forgetRow(databaseID, table, rowID)
 			}
+		} else {
+			result.Accept()
 		}
 	}
+}
 
-	if len(errorItems) > 0 {
-		if len(errorItems) == len(lines) {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Unable to insert data"))
-			return
+// insertRecord flattens a single JSON document, assigns a __row_id where
+// one is missing and hands the result to the data sink. It returns the number
+// of flattened items which were written.
+func (a *ScratchDataAPIStruct) insertRecord(databaseID int64, table string, flattener Flattener, line string) (int, error) {
+	flatItems, err := flattener.Flatten(table, line)
+	if err != nil {
+		log.Trace().Err(err).Str("json", line).Msg("Unable to flatten JSON")
+		return 0, flattenError(err)
+	}
+
+	written := 0
+	var rc error
+	for _, flatItem := range flatItems {
+		toWrite := flatItem.JSON
+
+		if !gjson.Get(flatItem.JSON, "__row_id").Exists() {
+			snowID := a.snow.Generate()
+			rowID := snowID.Int64()
+			if toWrite, err = sjson.Set(flatItem.JSON, "__row_id", rowID); err != nil {
+				log.Trace().Err(err).Str("json", flatItem.JSON).Msg("Unable to add __row_id")
+			}
+		}
+
+		writeErr := a.dataSink.WriteData(databaseID, flatItem.Table, []byte(toWrite))
+		if writeErr != nil {
+			rc = writeError(writeErr)
+			log.Trace().Err(writeErr).Str("json", flatItem.JSON).Msg("Unable to write JSON")
 		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("Partially inserted data"))
-			return
+			written++
 		}
 	}
 
-	w.Write([]byte("ok"))
+	return written, rc
 }
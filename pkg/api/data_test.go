@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		global   int
+		key      int
+		expected time.Duration
+	}{
+		{0, 0, 0},
+		{30, 0, 30 * time.Second},
+		{0, 10, 10 * time.Second},
+		{30, 10, 10 * time.Second},
+		{10, 30, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		a := &ScratchDataAPIStruct{config: config.API{MaxExecutionSeconds: test.global}}
+		ctx := context.WithValue(context.Background(), "maxExecutionSeconds", test.key)
+
+		if got := a.queryTimeout(ctx); got != test.expected {
+			t.Errorf("global %d, key %d: expected %s; got %s", test.global, test.key, test.expected, got)
+		}
+	}
+}
+
+func TestQueryContextReadOnly(t *testing.T) {
+	a := &ScratchDataAPIStruct{}
+
+	if !util.IsReadOnly(a.queryContext(context.Background())) {
+		t.Error("Expected queries without an admin key to be read-only")
+	}
+	if util.IsReadOnly(a.queryContext(context.WithValue(context.Background(), "isAdmin", true))) {
+		t.Error("Expected admin queries not to be read-only")
+	}
+}
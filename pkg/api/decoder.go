@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tidwall/gjson"
+)
+
+// Lines longer than this are rejected instead of being buffered in memory
+const maxNDJSONLineBytes = 10_000_000
+
+var ErrLineTooLong = fmt.Errorf("line exceeds %d bytes", maxNDJSONLineBytes)
+var ErrInvalidJSON = errors.New("invalid JSON")
+
+// RecordDecoder yields one JSON document per call to Next. It returns io.EOF
+// once the input is exhausted. Any other error only applies to the current
+// record and the caller may keep calling Next.
+type RecordDecoder interface {
+	Next() (string, error)
+}
+
+// NDJSONDecoder reads newline-delimited JSON one line at a time so the whole
+// request body never has to be held in memory.
+type NDJSONDecoder struct {
+	reader *bufio.Reader
+	line   []byte
+}
+
+func NewNDJSONDecoder(r io.Reader) *NDJSONDecoder {
+	return &NDJSONDecoder{
+		reader: bufio.NewReaderSize(r, 64*1024),
+	}
+}
+
+func (d *NDJSONDecoder) readLine() ([]byte, error) {
+	d.line = d.line[:0]
+	tooLong := false
+
+	for {
+		fragment, err := d.reader.ReadSlice('\n')
+		if !tooLong {
+			if len(d.line)+len(fragment) > maxNDJSONLineBytes {
+				// Keep consuming until the end of the line, but stop buffering
+				tooLong = true
+				d.line = d.line[:0]
+			} else {
+				d.line = append(d.line, fragment...)
+			}
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		if err == io.EOF && (len(d.line) > 0 || tooLong) {
+			err = nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if tooLong {
+			return nil, ErrLineTooLong
+		}
+
+		return d.line, nil
+	}
+}
+
+func (d *NDJSONDecoder) Next() (string, error) {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return "", err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if !gjson.ValidBytes(line) {
+			return "", ErrInvalidJSON
+		}
+
+		return string(line), nil
+	}
+}
+
+// JSONDecoder yields the items of an already-parsed JSON document. Arrays
+// produce one record per element, any other value is a single record.
+type JSONDecoder struct {
+	items []gjson.Result
+	pos   int
+}
+
+func NewJSONDecoder(body []byte) (*JSONDecoder, error) {
+	if !gjson.ValidBytes(body) {
+		return nil, ErrInvalidJSON
+	}
+
+	parsed := gjson.ParseBytes(body)
+	return &JSONDecoder{items: parsed.Array()}, nil
+}
+
+func (d *JSONDecoder) Len() int {
+	return len(d.items)
+}
+
+func (d *JSONDecoder) Next() (string, error) {
+	if d.pos >= len(d.items) {
+		return "", io.EOF
+	}
+
+	item := d.items[d.pos]
+	d.pos++
+	return item.Raw, nil
+}
+
+// countingReader tracks how many bytes have been read from the request body
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNDJSONDecoder(t *testing.T) {
+	input := `{"a":1}
+
+{"a":2}
+not json
+{"a":3}`
+
+	decoder := NewNDJSONDecoder(strings.NewReader(input))
+
+	expected := []struct {
+		line string
+		err  error
+	}{
+		{`{"a":1}`, nil},
+		{`{"a":2}`, nil},
+		{"", ErrInvalidJSON},
+		{`{"a":3}`, nil},
+		{"", io.EOF},
+	}
+
+	for i, exp := range expected {
+		line, err := decoder.Next()
+		if err != exp.err {
+			t.Fatalf("record %d: expected error %v; got %v", i, exp.err, err)
+		}
+		if line != exp.line {
+			t.Fatalf("record %d: expected %#q; got %#q", i, exp.line, line)
+		}
+	}
+}
+
+func TestNDJSONDecoderLongLine(t *testing.T) {
+	long := `{"a":"` + strings.Repeat("x", maxNDJSONLineBytes) + `"}`
+	decoder := NewNDJSONDecoder(strings.NewReader(long + "\n" + `{"b":1}`))
+
+	if _, err := decoder.Next(); err != ErrLineTooLong {
+		t.Fatalf("Expected ErrLineTooLong; got %v", err)
+	}
+
+	line, err := decoder.Next()
+	if err != nil || line != `{"b":1}` {
+		t.Fatalf("Expected next line after long line; got %#q, %v", line, err)
+	}
+}
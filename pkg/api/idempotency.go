@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tidwall/gjson"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+const IdempotentReplayHeader = "Idempotent-Replayed"
+
+// Stored while the first request with a given Idempotency-Key is still running
+var idempotencyInProgress = []byte("in_progress")
+
+// idempotencyEnabled is true when a cache is configured and the dedupe window is positive
+func (a *ScratchDataAPIStruct) idempotencyEnabled() bool {
+	return a.storageServices.Cache != nil && a.config.IdempotencyWindowSeconds > 0
+}
+
+func (a *ScratchDataAPIStruct) idempotencyWindow() time.Duration {
+	return time.Duration(a.config.IdempotencyWindowSeconds) * time.Second
+}
+
+func requestIdempotencyKey(databaseID int64, table string, key string) string {
+	return fmt.Sprintf("idempotency:request:%d:%s:%s", databaseID, table, key)
+}
+
+func rowIdempotencyKey(databaseID int64, table string, rowID string) string {
+	return fmt.Sprintf("idempotency:row:%d:%s:%s", databaseID, table, rowID)
+}
+
+// replayInsert checks whether a request with the same Idempotency-Key was already
+// handled within the window. If so, the previous response is written and true is returned.
+// Otherwise the key is marked as in progress, in the same step as the check, so
+// that only one of several concurrent requests with the key is handled.
+func (a *ScratchDataAPIStruct) replayInsert(w http.ResponseWriter, databaseID int64, table string, key string) bool {
+	cacheKey := requestIdempotencyKey(databaseID, table, key)
+
+	window := a.idempotencyWindow()
+	added, err := a.storageServices.Cache.Add(cacheKey, idempotencyInProgress, &window)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Unable to store idempotency key")
+		return false
+	}
+	if added {
+		return false
+	}
+
+	// The key can expire between Add and Get, in which case the client retries
+	previous, ok := a.storageServices.Cache.Get(cacheKey)
+	if !ok {
+		previous = idempotencyInProgress
+	}
+
+	if string(previous) == string(idempotencyInProgress) {
+		http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+		return true
+	}
+
+	result := gjson.GetBytes(previous, "status")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(IdempotentReplayHeader, "true")
+	w.WriteHeader(int(result.Int()))
+	w.Write(previous)
+	return true
+}
+
+// rememberInsert stores the response for an Idempotency-Key. Requests where
+// nothing was written are forgotten so that the client can safely retry them.
+func (a *ScratchDataAPIStruct) rememberInsert(databaseID int64, table string, key string, result *InsertResult, response []byte) {
+	cacheKey := requestIdempotencyKey(databaseID, table, key)
+
+	if result.Accepted == 0 && result.Duplicates == 0 && result.Status >= 500 {
+		if err := a.storageServices.Cache.Delete(cacheKey); err != nil {
+			log.Error().Err(err).Str("key", key).Msg("Unable to remove idempotency key")
+		}
+		return
+	}
+
+	window := a.idempotencyWindow()
+	if err := a.storageServices.Cache.Set(cacheKey, response, &window); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("Unable to store idempotent response")
+	}
+}
+
+// claimRow marks a client-supplied __row_id as inserted within the window. It
+// returns false when the row was already claimed, by this or a concurrent request,
+// in the same step as the check, so that only one of them writes the row.
+func (a *ScratchDataAPIStruct) claimRow(databaseID int64, table string, rowID string) bool {
+	window := a.idempotencyWindow()
+	added, err := a.storageServices.Cache.Add(rowIdempotencyKey(databaseID, table, rowID), []byte{}, &window)
+	if err != nil {
+		log.Error().Err(err).Str("row_id", rowID).Msg("Unable to store row idempotency key")
+		return true
+	}
+	return added
+}
+
+// forgetRow releases the claim on a row of which nothing could be written, so
+// that the client can retry it
+func (a *ScratchDataAPIStruct) forgetRow(databaseID int64, table string, rowID string) {
+	if err := a.storageServices.Cache.Delete(rowIdempotencyKey(databaseID, table, rowID)); err != nil {
+		log.Error().Err(err).Str("row_id", rowID).Msg("Unable to remove row idempotency key")
+	}
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/datasink"
+	"github.com/scratchdata/scratchdata/pkg/storage"
+	"github.com/scratchdata/scratchdata/pkg/storage/cache/memory"
+)
+
+func idempotentAPI(t *testing.T) *ScratchDataAPIStruct {
+	c, err := memory.NewCache(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ScratchDataAPIStruct{
+		storageServices: &storage.Services{Cache: c},
+		config:          config.API{IdempotencyWindowSeconds: 60},
+	}
+}
+
+func TestReplayInsert(t *testing.T) {
+	a := idempotentAPI(t)
+
+	if a.replayInsert(httptest.NewRecorder(), 1, "events", "key") {
+		t.Fatal("Expected the first request to be handled")
+	}
+
+	w := httptest.NewRecorder()
+	if !a.replayInsert(w, 1, "events", "key") || w.Code != http.StatusConflict {
+		t.Errorf("Expected a conflict while the first request runs, got %d", w.Code)
+	}
+
+	// Keys are scoped to the destination and table
+	if a.replayInsert(httptest.NewRecorder(), 1, "other", "key") {
+		t.Error("Expected a request for another table to be handled")
+	}
+
+	result := NewInsertResult()
+	result.Accept()
+	response, _ := json.Marshal(result)
+	a.rememberInsert(1, "events", "key", result, response)
+
+	w = httptest.NewRecorder()
+	if !a.replayInsert(w, 1, "events", "key") {
+		t.Fatal("Expected the response to be replayed")
+	}
+	if w.Code != http.StatusOK || w.Header().Get(IdempotentReplayHeader) != "true" || w.Body.String() != string(response) {
+		t.Errorf("Unexpected replay: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestReplayInsertConcurrent(t *testing.T) {
+	a := idempotentAPI(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	handled := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !a.replayInsert(httptest.NewRecorder(), 1, "events", "key") {
+				mu.Lock()
+				handled++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if handled != 1 {
+		t.Errorf("Expected one request to be handled, got %d", handled)
+	}
+}
+
+func TestRememberInsertServerError(t *testing.T) {
+	a := idempotentAPI(t)
+	a.replayInsert(httptest.NewRecorder(), 1, "events", "key")
+
+	// Nothing was written, so the client may retry with the same key
+	result := NewInsertResult()
+	result.Fail(http.StatusInternalServerError, "Unable to read data")
+	a.rememberInsert(1, "events", "key", result, nil)
+
+	if a.replayInsert(httptest.NewRecorder(), 1, "events", "key") {
+		t.Error("Expected the retry to be handled")
+	}
+}
+
+// countingSink counts the rows written to it, and fails every write while
+// failing is set or once failAfter rows have been written
+type countingSink struct {
+	datasink.DataSink
+	mu        sync.Mutex
+	rows      int
+	failing   bool
+	failAfter int
+}
+
+func (s *countingSink) WriteData(databaseID int64, table string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing || (s.failAfter > 0 && s.rows >= s.failAfter) {
+		return errors.New("disk full")
+	}
+	s.rows++
+	return nil
+}
+
+func insertRow(a *ScratchDataAPIStruct, row string) *InsertResult {
+	result := NewInsertResult()
+	a.insertRecords(NewNDJSONDecoder(strings.NewReader(row)), 1, "events", HorizontalFlattener{}, result)
+	return result
+}
+
+func TestClaimRow(t *testing.T) {
+	a := idempotentAPI(t)
+
+	if !a.claimRow(1, "events", "7") {
+		t.Error("Expected the first claim to succeed")
+	}
+	if a.claimRow(1, "events", "7") {
+		t.Error("Expected the row to be claimed already")
+	}
+	if !a.claimRow(2, "events", "7") {
+		t.Error("Expected rows to be scoped to the destination")
+	}
+
+	a.forgetRow(1, "events", "7")
+	if !a.claimRow(1, "events", "7") {
+		t.Error("Expected a forgotten row to be claimed again")
+	}
+}
+
+func TestInsertRowConcurrent(t *testing.T) {
+	a := idempotentAPI(t)
+	sink := &countingSink{}
+	a.dataSink = sink
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			insertRow(a, `{"__row_id": "7", "a": 1}`)
+		}()
+	}
+	wg.Wait()
+
+	if sink.rows != 1 {
+		t.Errorf("Expected the row to be written once, got %d", sink.rows)
+	}
+}
+
+func TestInsertRowWriteFailure(t *testing.T) {
+	a := idempotentAPI(t)
+	sink := &countingSink{failing: true}
+	a.dataSink = sink
+
+	if result := insertRow(a, `{"__row_id": "7", "a": 1}`); result.Accepted != 0 {
+		t.Fatalf("Expected the row to be rejected, got %+v", result)
+	}
+
+	// The row was not written, so a retry is not a duplicate
+	sink.failing = false
+	result := insertRow(a, `{"__row_id": "7", "a": 1}`)
+	if result.Accepted != 1 || result.Duplicates != 0 || sink.rows != 1 {
+		t.Errorf("Expected the retry to be written, got %+v and %d rows", result, sink.rows)
+	}
+}
+
+func TestInsertRowPartialWriteFailure(t *testing.T) {
+	a := idempotentAPI(t)
+	sink := &countingSink{failAfter: 2}
+	a.dataSink = sink
+
+	// The record flattens to three rows, and the third cannot be written
+	row := `{"__row_id": "7", "a": [1, 2, 3]}`
+	result := NewInsertResult()
+	a.insertRecords(NewNDJSONDecoder(strings.NewReader(row)), 1, "events", VerticalFlattener{}, result)
+	if result.Accepted != 0 || sink.rows != 2 {
+		t.Fatalf("Expected the record to be rejected after 2 rows, got %+v and %d rows", result, sink.rows)
+	}
+
+	// Part of the record was written, so a retry must not write it again
+	sink.failAfter = 0
+	result = NewInsertResult()
+	a.insertRecords(NewNDJSONDecoder(strings.NewReader(row)), 1, "events", VerticalFlattener{}, result)
+	if result.Duplicates != 1 || sink.rows != 2 {
+		t.Errorf("Expected the retry to be a duplicate, got %+v and %d rows", result, sink.rows)
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	sinkmodels "github.com/scratchdata/scratchdata/pkg/datasink/models"
+)
+
+// Only this many row errors are returned to the client. The counts are always exact.
+const maxReportedRowErrors = 1000
+
+const (
+	ReasonInvalidJSON    = "invalid_json"
+	ReasonLineTooLong    = "line_too_long"
+	ReasonInvalidCSV     = "invalid_csv"
+	ReasonFlatten        = "flatten_error"
+	ReasonWrite          = "write_error"
+	ReasonLockContention = "lock_contention"
+)
+
+// RowError describes why a single row of an insert request was not accepted
+type RowError struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// Retryable is true for server-side failures where sending the same row
+// again may succeed
+func (e RowError) Retryable() bool {
+	return e.Status >= 500
+}
+
+// InsertResult is returned from the insert endpoint. Rows are indexed from 0
+// in the order they appear in the request body.
+type InsertResult struct {
+	Status          int        `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	Accepted        int        `json:"accepted"`
+	Rejected        int        `json:"rejected"`
+	Duplicates      int        `json:"duplicates"`
+	Errors          []RowError `json:"errors"`
+	ErrorsTruncated bool       `json:"errors_truncated,omitempty"`
+
+	clientErrors     int
+	serverErrors     int
+	contentionErrors int
+}
+
+func NewInsertResult() *InsertResult {
+	return &InsertResult{
+		Status: http.StatusOK,
+		Errors: []RowError{},
+	}
+}
+
+func (r *InsertResult) Accept() {
+	r.Accepted++
+}
+
+// Duplicate counts a row which was skipped because its __row_id was already inserted
+func (r *InsertResult) Duplicate() {
+	r.Duplicates++
+}
+
+func (r *InsertResult) Reject(index int, reason string, err error) {
+	rowErr := RowError{
+		Index:  index,
+		Reason: reason,
+		Status: reasonStatus(reason),
+		Error:  err.Error(),
+	}
+
+	r.Rejected++
+	if !rowErr.Retryable() {
+		r.clientErrors++
+	} else if reason == ReasonLockContention {
+		r.contentionErrors++
+	} else {
+		r.serverErrors++
+	}
+
+	if len(r.Errors) >= maxReportedRowErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+
+	r.Errors = append(r.Errors, rowErr)
+}
+
+// Fail marks the whole request as failed, independent of individual rows
+func (r *InsertResult) Fail(status int, message string) {
+	r.Status = status
+	r.Error = message
+}
+
+// Finish computes the overall status code. Client errors only produce a 400,
+// any server-side failure produces a 5xx so the client knows a retry is worthwhile.
+// A 503 means every server-side failure was lock contention.
+func (r *InsertResult) Finish() int {
+	if r.Error != "" || r.Rejected == 0 {
+		return r.Status
+	}
+
+	switch {
+	case r.serverErrors > 0:
+		r.Status = http.StatusInternalServerError
+	case r.contentionErrors > 0:
+		r.Status = http.StatusServiceUnavailable
+	case r.clientErrors > 0:
+		r.Status = http.StatusBadRequest
+	}
+
+	return r.Status
+}
+
+func reasonStatus(reason string) int {
+	switch reason {
+	case ReasonInvalidJSON, ReasonLineTooLong, ReasonInvalidCSV, ReasonFlatten:
+		return http.StatusBadRequest
+	case ReasonLockContention:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// insertError ties an error from the insert pipeline to a RowError reason
+type insertError struct {
+	reason string
+	err    error
+}
+
+func (e *insertError) Error() string {
+	return e.err.Error()
+}
+
+func (e *insertError) Unwrap() error {
+	return e.err
+}
+
+func flattenError(err error) error {
+	return &insertError{reason: ReasonFlatten, err: err}
+}
+
+func writeError(err error) error {
+	if errors.Is(err, sinkmodels.ErrLockContention) {
+		return &insertError{reason: ReasonLockContention, err: err}
+	}
+	return &insertError{reason: ReasonWrite, err: err}
+}
+
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidJSON):
+		return ReasonInvalidJSON
+	case errors.Is(err, ErrLineTooLong):
+		return ReasonLineTooLong
+	case errors.Is(err, ErrInvalidCSV):
+		return ReasonInvalidCSV
+	}
+
+	var insertErr *insertError
+	if errors.As(err, &insertErr) {
+		return insertErr.reason
+	}
+
+	return ReasonWrite
+}
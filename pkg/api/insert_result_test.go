@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestInsertResultStatus(t *testing.T) {
+	err := errors.New("boom")
+
+	tests := []struct {
+		name     string
+		reasons  []string
+		expected int
+	}{
+		{"no errors", nil, http.StatusOK},
+		{"client errors", []string{ReasonFlatten, ReasonInvalidJSON}, http.StatusBadRequest},
+		{"lock contention", []string{ReasonLockContention, ReasonFlatten}, http.StatusServiceUnavailable},
+		{"server error", []string{ReasonLockContention, ReasonWrite, ReasonFlatten}, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		result := NewInsertResult()
+		result.Accept()
+		for i, reason := range test.reasons {
+			result.Reject(i, reason, err)
+		}
+
+		if status := result.Finish(); status != test.expected {
+			t.Errorf("%s: expected status %d; got %d", test.name, test.expected, status)
+		}
+		if result.Rejected != len(test.reasons) || len(result.Errors) != len(test.reasons) {
+			t.Errorf("%s: expected %d rejected rows; got %d", test.name, len(test.reasons), result.Rejected)
+		}
+	}
+}
+
+func TestInsertResultTruncated(t *testing.T) {
+	result := NewInsertResult()
+	for i := 0; i < maxReportedRowErrors+10; i++ {
+		result.Reject(i, ReasonFlatten, errors.New("bad row"))
+	}
+	result.Reject(maxReportedRowErrors+10, ReasonWrite, errors.New("disk error"))
+
+	if len(result.Errors) != maxReportedRowErrors || !result.ErrorsTruncated {
+		t.Fatalf("Expected %d reported errors and truncation; got %d", maxReportedRowErrors, len(result.Errors))
+	}
+
+	if status := result.Finish(); status != http.StatusInternalServerError {
+		t.Fatalf("Expected unreported server error to produce 500; got %d", status)
+	}
+}
+
+func TestErrorReason(t *testing.T) {
+	if reason := errorReason(writeError(errors.New("disk full"))); reason != ReasonWrite {
+		t.Fatalf("Expected %s; got %s", ReasonWrite, reason)
+	}
+	if reason := errorReason(flattenError(errors.New("bad json"))); reason != ReasonFlatten {
+		t.Fatalf("Expected %s; got %s", ReasonFlatten, reason)
+	}
+	if reason := errorReason(ErrInvalidJSON); reason != ReasonInvalidJSON {
+		t.Fatalf("Expected %s; got %s", ReasonInvalidJSON, reason)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	blobModels "github.com/scratchdata/scratchdata/pkg/storage/blobstore/models"
+	dbModels "github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	queueModels "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+)
+
+type QueryJobResponse struct {
+	ID         string                  `json:"id"`
+	Status     dbModels.QueryJobStatus `json:"status"`
+	Rows       int64                   `json:"rows"`
+	Bytes      int64                   `json:"bytes"`
+	Error      string                  `json:"error,omitempty"`
+	CreatedAt  time.Time               `json:"created_at"`
+	StartedAt  *time.Time              `json:"started_at,omitempty"`
+	FinishedAt *time.Time              `json:"finished_at,omitempty"`
+}
+
+func queryJobResponse(job dbModels.QueryJob) QueryJobResponse {
+	return QueryJobResponse{
+		ID:         job.UUID,
+		Status:     job.Status,
+		Rows:       job.Rows,
+		Bytes:      job.Bytes,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+	}
+}
+
+// queryJob loads the job named in the URL. It writes a 404 and returns false
+// if the job does not exist or belongs to another destination.
+func (a *ScratchDataAPIStruct) queryJob(w http.ResponseWriter, r *http.Request) (dbModels.QueryJob, bool) {
+	databaseID := a.AuthGetDatabaseID(r.Context())
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return dbModels.QueryJob{}, false
+	}
+
+	job, ok := a.storageServices.Database.GetQueryJob(r.Context(), id)
+	if !ok || job.DestinationID != databaseID {
+		http.Error(w, "Query job not found", http.StatusNotFound)
+		return dbModels.QueryJob{}, false
+	}
+
+	return job, true
+}
+
+// CreateQueryJob queues a query to run on a worker and returns its ID immediately
+func (a *ScratchDataAPIStruct) CreateQueryJob(w http.ResponseWriter, r *http.Request) {
+	databaseID := a.AuthGetDatabaseID(r.Context())
+
+	query, params, ok := readQuery(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.checkQuery(r.Context(), query, params); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	job, err := a.storageServices.Database.CreateQueryJob(r.Context(), databaseID, query, params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := queueModels.QueryJobMessage{
+		JobID:               job.UUID,
+		DestinationID:       job.DestinationID,
+		MaxExecutionSeconds: int(a.queryTimeout(r.Context()) / time.Second),
+		ReadOnly:            !a.AuthIsAdmin(r.Context()),
+	}
+	_, err = a.storageServices.Database.Enqueue(dbModels.RunQuery, message)
+	if err != nil {
+		log.Error().Err(err).Str("job_id", job.UUID).Msg("Unable to enqueue query job")
+
+		job.Status = dbModels.JobFailed
+		job.Error = "Unable to queue job"
+		a.storageServices.Database.UpdateQueryJob(r.Context(), &job, dbModels.JobQueued)
+
+		http.Error(w, "Unable to queue job", http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, queryJobResponse(job))
+}
+
+func (a *ScratchDataAPIStruct) GetQueryJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.queryJob(w, r)
+	if !ok {
+		return
+	}
+
+	render.JSON(w, r, queryJobResponse(job))
+}
+
+func (a *ScratchDataAPIStruct) CancelQueryJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.queryJob(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	job.Status = dbModels.JobCancelled
+	job.FinishedAt = &now
+
+	updated, err := a.storageServices.Database.UpdateQueryJob(r.Context(), &job, dbModels.JobQueued, dbModels.JobRunning)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !updated {
+		http.Error(w, "Query job has already finished", http.StatusConflict)
+		return
+	}
+
+	render.JSON(w, r, queryJobResponse(job))
+}
+
+// QueryJobResult downloads the result of a finished job in the requested format
+func (a *ScratchDataAPIStruct) QueryJobResult(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.queryJob(w, r)
+	if !ok {
+		return
+	}
+
+	format, err := models.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if job.Status != dbModels.JobSucceeded {
+		http.Error(w, "Query job has not succeeded: "+string(job.Status), http.StatusConflict)
+		return
+	}
+
+	f, err := os.CreateTemp("", "scratchdata_job_result")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = a.storageServices.BlobStore.Download(job.ResultKey, f)
+	if errors.Is(err, blobModels.ErrNotFound) {
+		http.Error(w, "Query result has expired", http.StatusGone)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	if err := rowencoder.ConvertParquet(r.Context(), f, format, w); err != nil {
+		log.Error().Err(err).Str("job_id", job.UUID).Msg("Unable to convert query result")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+const NextCursorHeader = "X-Next-Cursor"
+const TotalRowsHeader = "X-Total-Rows"
+
+const maxPageLimit = 100_000
+
+// Rows per page when the request does not set a limit
+const defaultPageLimit = 1_000
+
+// Tables created by ScratchData have an increasing __row_id, which makes for
+// stable pages which do not get slower as the client moves through them
+const keysetColumn = "__row_id"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUnorderedPage is returned for queries which would be paged with OFFSET but
+// do not sort their rows, so pages could repeat or skip rows
+var ErrUnorderedPage = errors.New("queries must have an ORDER BY to be paginated")
+
+// queryCursor is the position of the next page. Clients see it as an opaque string.
+type queryCursor struct {
+	// Hash of the query and params, so a cursor cannot be used with a different query
+	Query string `json:"q"`
+	Limit int    `json:"l"`
+
+	// Rows returned by earlier pages
+	Seen int64 `json:"s"`
+
+	// Keyset pages start after this __row_id. Otherwise pages use OFFSET Seen.
+	Keyset bool  `json:"k,omitempty"`
+	After  int64 `json:"a,omitempty"`
+
+	// OFFSET pages of a keyset query whose __row_id is not an integer, which
+	// are sorted by __row_id
+	KeyOrder bool `json:"o,omitempty"`
+
+	// Token for destinations which page natively
+	Token string `json:"t,omitempty"`
+}
+
+// cursorMAC signs a cursor's payload for a destination, so that clients cannot
+// change any of its fields, such as the job a native page token refers to
+func (a *ScratchDataAPIStruct) cursorMAC(databaseID int64, payload []byte) []byte {
+	mac := hmac.New(sha256.New, a.cursorKey)
+	fmt.Fprintf(mac, "%d\n", databaseID)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encodeCursor returns the signed cursor which clients send back for the next page
+func (a *ScratchDataAPIStruct) encodeCursor(databaseID int64, c queryCursor) string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(a.cursorMAC(databaseID, payload))
+}
+
+// decodeCursor checks a cursor's signature and decodes it
+func (a *ScratchDataAPIStruct) decodeCursor(databaseID int64, text string) (queryCursor, error) {
+	var cursor queryCursor
+
+	encodedPayload, encodedMAC, ok := strings.Cut(text, ".")
+	if !ok {
+		return cursor, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(signature, a.cursorMAC(databaseID, payload)) {
+		return cursor, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func queryHash(query string, params models.Params) string {
+	encodedParams, _ := json.Marshal(params)
+	h := sha256.Sum256([]byte(util.NormalizeQuery(query) + "\n" + string(encodedParams)))
+	return hex.EncodeToString(h[:8])
+}
+
+// parsePage reads the limit and cursor parameters. paged is false when neither is set.
+// Cursors are only accepted for the destination and query they were issued for.
+func (a *ScratchDataAPIStruct) parsePage(r *http.Request, databaseID int64, query string, params models.Params) (cursor queryCursor, paged bool, err error) {
+	limitText := r.URL.Query().Get("limit")
+	cursorText := r.URL.Query().Get("cursor")
+	if limitText == "" && cursorText == "" {
+		return cursor, false, nil
+	}
+
+	cursor.Query = queryHash(query, params)
+	if cursorText != "" {
+		cursor, err = a.decodeCursor(databaseID, cursorText)
+		if err != nil {
+			return cursor, true, err
+		}
+		if cursor.Query != queryHash(query, params) {
+			return cursor, true, fmt.Errorf("%w: cursor is for a different query", ErrInvalidCursor)
+		}
+		if cursor.Limit < 1 || cursor.Limit > maxPageLimit || cursor.Seen < 0 {
+			return cursor, true, ErrInvalidCursor
+		}
+	}
+
+	if limitText != "" {
+		cursor.Limit, err = strconv.Atoi(limitText)
+		if err != nil || cursor.Limit <= 0 || cursor.Limit > maxPageLimit {
+			return cursor, true, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+
+	return cursor, true, nil
+}
+
+// pageResult describes a page written by executePagedQuery
+type pageResult struct {
+	next      *queryCursor
+	totalRows int64 // -1 if unknown
+}
+
+// fetchPage writes the page at cursor as Parquet. Destinations which page natively
+// do so. Otherwise the query is wrapped by pageQuery.
+func (a *ScratchDataAPIStruct) fetchPage(ctx context.Context, dest destinations.Destination, query string, params models.Params, cursor queryCursor, w io.Writer) (token string, totalRows int64, err error) {
+	if pager, ok := dest.(destinations.PagingDestination); ok {
+		return pager.QueryPage(ctx, query, params, cursor.Limit, cursor.Token, w)
+	}
+
+	wrapped, err := pageQuery(query, cursor)
+	if err != nil {
+		return "", -1, err
+	}
+	return "", -1, dest.Query(ctx, wrapped, params, models.FormatParquet, w)
+}
+
+// pageQuery wraps a query with LIMIT and either a keyset on __row_id or OFFSET.
+// One extra row is fetched to tell whether there is another page. OFFSET is
+// only stable if the rows are sorted, so the query must have an ORDER BY.
+func pageQuery(query string, cursor queryCursor) (string, error) {
+	inner := "SELECT * FROM (\n" + util.TrimQuery(query) + "\n) AS page"
+
+	switch {
+	case cursor.Keyset && cursor.Seen == 0:
+		return fmt.Sprintf("%s ORDER BY %s LIMIT %d", inner, keysetColumn, cursor.Limit+1), nil
+	case cursor.Keyset:
+		return fmt.Sprintf("%s WHERE %s > %d ORDER BY %s LIMIT %d", inner, keysetColumn, cursor.After, keysetColumn, cursor.Limit+1), nil
+	case cursor.KeyOrder:
+		return fmt.Sprintf("%s ORDER BY %s LIMIT %d OFFSET %d", inner, keysetColumn, cursor.Limit+1, cursor.Seen), nil
+	case !util.HasOrderBy(query):
+		return "", ErrUnorderedPage
+	}
+	return fmt.Sprintf("%s LIMIT %d OFFSET %d", inner, cursor.Limit+1, cursor.Seen), nil
+}
+
+// canUseKeyset is true for SELECT * queries on a table with a __row_id column
+func canUseKeyset(dest destinations.Destination, query string) bool {
+	table, ok := util.SelectStarTable(query)
+	if !ok {
+		return false
+	}
+
+	columns, err := dest.Columns(table)
+	if err != nil {
+		return false
+	}
+
+	for _, column := range columns {
+		if column.Name == keysetColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// nextPage works out the cursor for the page after a Parquet page fetched at cursor
+func nextPage(ctx context.Context, page []byte, cursor queryCursor, token string, totalRows int64) (pageResult, error) {
+	info, err := rowencoder.ParquetPageInfo(ctx, bytes.NewReader(page), int64(cursor.Limit), keysetColumn)
+	if err != nil {
+		return pageResult{}, err
+	}
+
+	result := pageResult{totalRows: totalRows}
+
+	next := cursor
+	next.Seen += info.Rows
+	next.Token = token
+
+	if token == "" && !info.HasMore {
+		// This is the last page, so every row has been counted
+		if result.totalRows < 0 {
+			result.totalRows = next.Seen
+		}
+		return result, nil
+	}
+
+	if next.Keyset {
+		after, ok := info.LastKey.(int64)
+		if ok {
+			next.After = after
+		} else {
+			// Fall back to OFFSET if __row_id turns out not to be an integer
+			next.Keyset = false
+			next.KeyOrder = true
+		}
+	}
+
+	result.next = &next
+	return result, nil
+}
+
+// executePagedQuery writes one page of a query's result. JSON pages are wrapped
+// in an object with the next cursor and, when known, the total row count. Other
+// formats return these in headers.
+func (a *ScratchDataAPIStruct) executePagedQuery(ctx context.Context, w http.ResponseWriter, query string, params models.Params, databaseID int64, format models.Format, cursor queryCursor) error {
+	if err := a.checkQuery(ctx, query, params); err != nil {
+		return err
+	}
+
+	dest, err := a.destinationManager.Destination(ctx, databaseID)
+	if err != nil {
+		return err
+	}
+
+	ctx = a.queryContext(ctx)
+	if timeout := a.queryTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if cursor.Limit == 0 {
+		cursor.Limit = defaultPageLimit
+	}
+	if cursor.Seen == 0 && cursor.Token == "" {
+		_, native := dest.(destinations.PagingDestination)
+		cursor.Keyset = !native && canUseKeyset(dest, query)
+	}
+
+	// The page is held in memory as Parquet, which lets us count rows and set
+	// the cursor before converting it to the client's format
+	var page bytes.Buffer
+	token, totalRows, err := a.fetchPage(ctx, dest, query, params, cursor, &page)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return ErrQueryTimeout
+		}
+		return err
+	}
+
+	result, err := nextPage(ctx, page.Bytes(), cursor, token, totalRows)
+	if err != nil {
+		return err
+	}
+
+	var next *string
+	if result.next != nil {
+		encoded := a.encodeCursor(databaseID, *result.next)
+		next = &encoded
+		w.Header().Set(NextCursorHeader, encoded)
+	}
+	if result.totalRows >= 0 {
+		w.Header().Set(TotalRowsHeader, strconv.FormatInt(result.totalRows, 10))
+	}
+
+	if format != models.FormatJSON {
+		w.Header().Set("Content-Type", format.ContentType())
+		_, err = rowencoder.ConvertParquetPage(ctx, bytes.NewReader(page.Bytes()), format, w, int64(cursor.Limit), "")
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return writeJSONPage(ctx, w, page.Bytes(), cursor.Limit, next, result.totalRows)
+}
+
+// writeJSONPage streams a page as {"data": [...], "next_cursor": ..., "total_rows": ...}
+func writeJSONPage(ctx context.Context, w io.Writer, page []byte, limit int, next *string, totalRows int64) error {
+	if _, err := io.WriteString(w, `{"data":`); err != nil {
+		return err
+	}
+	_, err := rowencoder.ConvertParquetPage(ctx, bytes.NewReader(page), models.FormatJSON, w, int64(limit), "")
+	if err != nil {
+		return err
+	}
+
+	trailer := struct {
+		NextCursor *string `json:"next_cursor"`
+		TotalRows  *int64  `json:"total_rows,omitempty"`
+	}{NextCursor: next}
+	if totalRows >= 0 {
+		trailer.TotalRows = &totalRows
+	}
+
+	encoded, err := json.Marshal(trailer)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, ",%s\n", encoded[1:])
+	return err
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+)
+
+// parquetPage encodes rows with __row_id values from..to as Parquet
+func parquetPage(t *testing.T, from, to int64) []byte {
+	var buf bytes.Buffer
+	encoder, err := rowencoder.New(models.FormatParquet, &buf, []rowencoder.Column{{Name: "__row_id", Type: rowencoder.Int64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := from; i <= to; i++ {
+		if err := encoder.Write([]any{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNextPage(t *testing.T) {
+	cursor := queryCursor{Query: "q", Limit: 2, Keyset: true}
+
+	// Three rows were fetched for a page of two, so there is another page
+	result, err := nextPage(context.Background(), parquetPage(t, 10, 12), cursor, "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.next == nil || result.next.After != 11 || result.next.Seen != 2 || result.totalRows != -1 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	// The last page reports the total
+	result, err = nextPage(context.Background(), parquetPage(t, 12, 12), *result.next, "", -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.next != nil || result.totalRows != 3 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+}
+
+func TestWriteJSONPage(t *testing.T) {
+	var out bytes.Buffer
+	next := "cursor"
+	if err := writeJSONPage(context.Background(), &out, parquetPage(t, 10, 12), 2, &next, -1); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"data":[{"__row_id":10},{"__row_id":11}],"next_cursor":"cursor"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q; got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := writeJSONPage(context.Background(), &out, parquetPage(t, 12, 12), 2, nil, 3); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"data":[{"__row_id":12}],"next_cursor":null,"total_rows":3}` + "\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q; got %q", expected, out.String())
+	}
+}
+
+func TestPageQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		cursor   queryCursor
+		expected string
+	}{
+		{"SELECT * FROM events", queryCursor{Limit: 10, Keyset: true}, "SELECT * FROM (\nSELECT * FROM events\n) AS page ORDER BY __row_id LIMIT 11"},
+		{"SELECT * FROM events", queryCursor{Limit: 10, Seen: 10, Keyset: true, After: 42}, "SELECT * FROM (\nSELECT * FROM events\n) AS page WHERE __row_id > 42 ORDER BY __row_id LIMIT 11"},
+		{"SELECT * FROM events", queryCursor{Limit: 10, Seen: 10, KeyOrder: true}, "SELECT * FROM (\nSELECT * FROM events\n) AS page ORDER BY __row_id LIMIT 11 OFFSET 10"},
+		{"SELECT a FROM t ORDER BY a;", queryCursor{Limit: 10, Seen: 20}, "SELECT * FROM (\nSELECT a FROM t ORDER BY a\n) AS page LIMIT 11 OFFSET 20"},
+	}
+	for _, test := range tests {
+		got, err := pageQuery(test.query, test.cursor)
+		if err != nil || got != test.expected {
+			t.Errorf("%q: expected %q; got %q, %v", test.query, test.expected, got, err)
+		}
+	}
+
+	// Without an ORDER BY, OFFSET pages could repeat or skip rows
+	for _, cursor := range []queryCursor{{Limit: 10}, {Limit: 10, Seen: 10}} {
+		if _, err := pageQuery("SELECT a FROM t", cursor); !errors.Is(err, ErrUnorderedPage) {
+			t.Errorf("Expected %+v to need an ORDER BY, got %v", cursor, err)
+		}
+	}
+}
+
+func TestParsePageInvalidCursor(t *testing.T) {
+	a := &ScratchDataAPIStruct{cursorKey: []byte("key")}
+	query := "SELECT * FROM events"
+	hash := queryHash(query, nil)
+
+	parse := func(cursorText string, databaseID int64) (queryCursor, bool, error) {
+		r := httptest.NewRequest(http.MethodGet, "/?cursor="+cursorText, nil)
+		return a.parsePage(r, databaseID, query, nil)
+	}
+
+	cursors := []queryCursor{
+		{Query: hash, Limit: 0},
+		{Query: hash, Limit: -1},
+		{Query: hash, Limit: maxPageLimit + 1},
+		{Query: hash, Limit: 10, Seen: -5},
+		{Query: "other", Limit: 10},
+	}
+	for _, cursor := range cursors {
+		if _, _, err := parse(a.encodeCursor(1, cursor), 1); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected %+v to be rejected, got %v", cursor, err)
+		}
+	}
+
+	valid := queryCursor{Query: hash, Limit: 10, Seen: 20, Token: "job"}
+	cursor, paged, err := parse(a.encodeCursor(1, valid), 1)
+	if err != nil || !paged || cursor != valid {
+		t.Errorf("Expected %+v, got %+v, %v", valid, cursor, err)
+	}
+
+	// Cursors are only valid for the destination they were issued for
+	if _, _, err := parse(a.encodeCursor(1, valid), 2); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected a cursor for another destination to be rejected, got %v", err)
+	}
+
+	// Changing the payload, such as the native page token, breaks the signature
+	tampered := valid
+	tampered.Token = "other_job"
+	_, signature, _ := strings.Cut(a.encodeCursor(1, valid), ".")
+	payload, _, _ := strings.Cut(a.encodeCursor(1, tampered), ".")
+	for _, text := range []string{payload + "." + signature, payload, "not_a_cursor"} {
+		if _, _, err := parse(text, 1); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected %q to be rejected, got %v", text, err)
+		}
+	}
+}
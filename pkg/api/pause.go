@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+// PauseRequest optionally says why loading was paused
+type PauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// PauseResponse describes a paused destination, or one of its tables
+type PauseResponse struct {
+	DestinationID uint      `json:"destination_id"`
+	Table         string    `json:"table,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	PausedAt      time.Time `json:"paused_at"`
+}
+
+// pauseTarget returns the destination and, for table routes, the table to
+// pause or resume. Admin keys must pick a destination with destination_id.
+func (a *ScratchDataAPIStruct) pauseTarget(w http.ResponseWriter, r *http.Request) (int64, string, bool) {
+	databaseID := a.AuthGetDatabaseID(r.Context())
+	if databaseID < 0 {
+		http.Error(w, "destination_id is required", http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	table := chi.URLParam(r, "table")
+	if table != "" && !util.ValidTableName(table) {
+		http.Error(w, "Invalid table name", http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	return databaseID, table, true
+}
+
+// PauseLoading stops workers loading data into a destination, or a table when
+// the route names one. Inserts are still accepted and queued until loading is
+// resumed.
+func (a *ScratchDataAPIStruct) PauseLoading(w http.ResponseWriter, r *http.Request) {
+	databaseID, table, ok := a.pauseTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var request PauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pause, err := a.storageServices.Database.PauseLoading(r.Context(), databaseID, table, request.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int64("destination_id", databaseID).Str("table", table).Str("reason", request.Reason).Msg("Loading paused")
+
+	render.JSON(w, r, PauseResponse{
+		DestinationID: pause.DestinationID,
+		Table:         pause.DestinationTable,
+		Reason:        pause.Reason,
+		PausedAt:      pause.CreatedAt,
+	})
+}
+
+// ResumeLoading removes a pause. Loading starts again with the oldest queued data.
+func (a *ScratchDataAPIStruct) ResumeLoading(w http.ResponseWriter, r *http.Request) {
+	databaseID, table, ok := a.pauseTarget(w, r)
+	if !ok {
+		return
+	}
+
+	resumed, err := a.storageServices.Database.ResumeLoading(r.Context(), databaseID, table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !resumed {
+		http.Error(w, "Loading is not paused", http.StatusNotFound)
+		return
+	}
+	log.Info().Int64("destination_id", databaseID).Str("table", table).Msg("Loading resumed")
+
+	render.JSON(w, r, render.M{"destination_id": databaseID, "table": table, "status": "resumed"})
+}
+
+// GetPauses lists the pauses for a destination and its tables
+func (a *ScratchDataAPIStruct) GetPauses(w http.ResponseWriter, r *http.Request) {
+	databaseID, _, ok := a.pauseTarget(w, r)
+	if !ok {
+		return
+	}
+
+	pauses, err := a.storageServices.Database.GetPauses(r.Context(), databaseID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]PauseResponse, len(pauses))
+	for i, pause := range pauses {
+		response[i] = PauseResponse{
+			DestinationID: pause.DestinationID,
+			Table:         pause.DestinationTable,
+			Reason:        pause.Reason,
+			PausedAt:      pause.CreatedAt,
+		}
+	}
+	render.JSON(w, r, response)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const CacheStatusHeader = "X-Cache"
+
+// Results larger than this are streamed to the client but not cached
+const defaultQueryCacheMaxBytes = 10 * 1024 * 1024
+
+var queryCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "query_cache_hits",
+	Help: "Queries served from the result cache",
+})
+
+var queryCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "query_cache_misses",
+	Help: "Cacheable queries which were run on the destination",
+})
+
+func (a *ScratchDataAPIStruct) queryCacheMaxBytes() int {
+	if a.config.QueryCacheMaxBytes > 0 {
+		return a.config.QueryCacheMaxBytes
+	}
+	return defaultQueryCacheMaxBytes
+}
+
+// queryCacheEnabled is true when a cache is configured and the caller asked for caching
+func (a *ScratchDataAPIStruct) queryCacheEnabled(ttl time.Duration) bool {
+	return a.storageServices.Cache != nil && ttl > 0
+}
+
+// parseCacheTTL reads the optional cache_ttl parameter, in seconds. Results are not
+// cached when it is missing or 0.
+func parseCacheTTL(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("cache_ttl")
+	if value == "" {
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid cache_ttl %q", value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// cappedBuffer keeps a copy of a result until it grows past limit. Writes never
+// fail, so it can sit behind an io.MultiWriter without affecting the response.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if !b.overflow {
+		if b.Len()+len(p) > b.limit {
+			b.overflow = true
+			b.Reset()
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	dbModels "github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+const defaultQueueLimit = 100
+
+// QueueMessageResponse describes a queued message. The payload is only
+// included when a single message is requested.
+type QueueMessageResponse struct {
+	ID            uint                   `json:"id"`
+	Type          dbModels.MessageType   `json:"type"`
+	Status        dbModels.MessageStatus `json:"status"`
+	DestinationID uint                   `json:"destination_id"`
+	Table         string                 `json:"table,omitempty"`
+	Attempts      int                    `json:"attempts"`
+	LastError     string                 `json:"last_error,omitempty"`
+	ClaimedBy     string                 `json:"claimed_by,omitempty"`
+	ClaimedAt     *time.Time             `json:"claimed_at,omitempty"`
+	NextAttemptAt *time.Time             `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	Payload       json.RawMessage        `json:"payload,omitempty"`
+}
+
+func queueMessageResponse(message dbModels.Message) QueueMessageResponse {
+	response := QueueMessageResponse{
+		ID:            message.ID,
+		Type:          message.MessageType,
+		Status:        message.Status,
+		DestinationID: message.DestinationID,
+		Table:         message.DestinationTable,
+		Attempts:      message.Attempts,
+		LastError:     message.LastError,
+		ClaimedBy:     message.ClaimedBy,
+		NextAttemptAt: message.NextAttemptAt,
+		CreatedAt:     message.CreatedAt,
+	}
+	if !message.ClaimedAt.IsZero() {
+		response.ClaimedAt = &message.ClaimedAt
+	}
+	return response
+}
+
+// QueueStatsResponse is the depth of one destination's queue for a message
+// type and status, and the age of its oldest message
+type QueueStatsResponse struct {
+	DestinationID uint                   `json:"destination_id"`
+	Type          dbModels.MessageType   `json:"type"`
+	Status        dbModels.MessageStatus `json:"status"`
+	Messages      int64                  `json:"messages"`
+	OldestAt      time.Time              `json:"oldest_at"`
+	AgeSeconds    int64                  `json:"age_seconds"`
+}
+
+// readQueueFilter parses the status, type, destination_id and table query parameters
+func readQueueFilter(r *http.Request) (dbModels.QueueFilter, error) {
+	query := r.URL.Query()
+	filter := dbModels.QueueFilter{
+		MessageType: dbModels.MessageType(strings.ToUpper(query.Get("type"))),
+		Table:       query.Get("table"),
+	}
+
+	switch status := dbModels.MessageStatus(strings.ToUpper(query.Get("status"))); status {
+	case "", dbModels.New, dbModels.Claimed, dbModels.Dead:
+		filter.Status = status
+	default:
+		return filter, fmt.Errorf("status must be one of %s, %s or %s", dbModels.New, dbModels.Claimed, dbModels.Dead)
+	}
+
+	if value := query.Get("destination_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid destination_id: %w", err)
+		}
+		destinationID := uint(id)
+		filter.DestinationID = &destinationID
+	}
+
+	return filter, nil
+}
+
+// queueMessage looks up the message named by the id URL parameter, writing an
+// error response if it does not exist
+func (a *ScratchDataAPIStruct) queueMessage(w http.ResponseWriter, r *http.Request) (dbModels.Message, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return dbModels.Message{}, false
+	}
+
+	message, ok := a.storageServices.Database.GetMessage(uint(id))
+	if !ok {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return dbModels.Message{}, false
+	}
+	return message, true
+}
+
+// QueueMessages lists queued messages, oldest first, filtered by status, type,
+// destination and table
+func (a *ScratchDataAPIStruct) QueueMessages(w http.ResponseWriter, r *http.Request) {
+	filter, err := readQueueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultQueueLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	messages, err := a.storageServices.Database.ListMessages(filter, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]QueueMessageResponse, len(messages))
+	for i, message := range messages {
+		response[i] = queueMessageResponse(message)
+	}
+	render.JSON(w, r, response)
+}
+
+// GetQueueMessage returns a message with its payload
+func (a *ScratchDataAPIStruct) GetQueueMessage(w http.ResponseWriter, r *http.Request) {
+	message, ok := a.queueMessage(w, r)
+	if !ok {
+		return
+	}
+
+	response := queueMessageResponse(message)
+	response.Payload = json.RawMessage(message.Message)
+	render.JSON(w, r, response)
+}
+
+// RetryQueueMessage puts a dead or stuck message back on the queue to be
+// picked up straight away, with its attempts reset
+func (a *ScratchDataAPIStruct) RetryQueueMessage(w http.ResponseWriter, r *http.Request) {
+	message, ok := a.queueMessage(w, r)
+	if !ok {
+		return
+	}
+
+	if message.Status == dbModels.New && message.NextAttemptAt == nil {
+		http.Error(w, "Message is already waiting to be processed", http.StatusConflict)
+		return
+	}
+
+	if err := a.storageServices.Database.RetryMessage(message.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info().Uint("id", message.ID).Str("status", string(message.Status)).Msg("Message retried by admin")
+
+	message, _ = a.storageServices.Database.GetMessage(message.ID)
+	render.JSON(w, r, queueMessageResponse(message))
+}
+
+// DeleteQueueMessage removes a message from the queue. A worker which has
+// claimed it will still finish processing it.
+func (a *ScratchDataAPIStruct) DeleteQueueMessage(w http.ResponseWriter, r *http.Request) {
+	message, ok := a.queueMessage(w, r)
+	if !ok {
+		return
+	}
+
+	if err := a.storageServices.Database.Delete(message.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info().Uint("id", message.ID).Str("status", string(message.Status)).Msg("Message deleted by admin")
+
+	render.JSON(w, r, render.M{"id": message.ID, "deleted": true})
+}
+
+// PurgeQueue deletes every message matching the same filters as QueueMessages.
+// At least one filter is required, so that the queue is not emptied by mistake.
+func (a *ScratchDataAPIStruct) PurgeQueue(w http.ResponseWriter, r *http.Request) {
+	filter, err := readQueueFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if filter.Empty() {
+		http.Error(w, "At least one of status, type, destination_id or table is required", http.StatusBadRequest)
+		return
+	}
+
+	purged, err := a.storageServices.Database.PurgeMessages(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Info().Int64("messages", purged).Any("filter", filter).Msg("Messages purged by admin")
+
+	render.JSON(w, r, render.M{"purged": purged})
+}
+
+// QueueStats returns the number of messages and the age of the oldest for each
+// destination, message type and status
+func (a *ScratchDataAPIStruct) QueueStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := a.storageServices.Database.QueueStats()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	response := make([]QueueStatsResponse, len(stats))
+	for i, s := range stats {
+		response[i] = QueueStatsResponse{
+			DestinationID: s.DestinationID,
+			Type:          s.MessageType,
+			Status:        s.Status,
+			Messages:      s.Messages,
+			OldestAt:      s.OldestAt,
+			AgeSeconds:    int64(now.Sub(s.OldestAt).Seconds()),
+		}
+	}
+	render.JSON(w, r, response)
+}
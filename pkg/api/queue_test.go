@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	dbModels "github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+func TestReadQueueFilter(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/queue/messages?status=dead&type=insert_data&destination_id=0&table=events", nil)
+	filter, err := readQueueFilter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Status != dbModels.Dead || filter.MessageType != dbModels.InsertData || filter.Table != "events" {
+		t.Errorf("Unexpected filter %+v", filter)
+	}
+	if filter.DestinationID == nil || *filter.DestinationID != 0 {
+		t.Errorf("Destination 0 should be selected, got %v", filter.DestinationID)
+	}
+
+	r = httptest.NewRequest("GET", "/api/queue/purge", nil)
+	filter, err = readQueueFilter(r)
+	if err != nil || !filter.Empty() {
+		t.Errorf("Expected an empty filter, got %+v %v", filter, err)
+	}
+
+	for _, query := range []string{"status=done", "destination_id=abc"} {
+		r = httptest.NewRequest("GET", "/api/queue/messages?"+query, nil)
+		if _, err := readQueueFilter(r); err == nil {
+			t.Errorf("Expected an error for %s", query)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/tidwall/gjson"
+)
+
+const defaultRejectsLimit = 100
+
+// Rows re-driven by one request
+const maxRedriveRows = 10_000
+
+// RedriveRequest selects the rejected rows to load again. Every rejected row,
+// up to maxRedriveRows, is retried when IDs is empty.
+type RedriveRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+// hasRejects is true if rows of table have been rejected
+func hasRejects(dest destinations.Destination, table string) bool {
+	columns, err := dest.Columns(models.RejectsTable(table))
+	return err == nil && len(columns) > 0
+}
+
+// Rejects lists rows which could not be loaded into a table, newest first,
+// with the error, the key of the file they came from and the original JSON
+func (a *ScratchDataAPIStruct) Rejects(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultRejectsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !hasRejects(dest, table) {
+		render.JSON(w, r, []any{})
+		return
+	}
+
+	query, err := rejectsQuery(dest, table, limit)
+	if err != nil {
+		writeTableError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", models.FormatJSON.ContentType())
+	if err := dest.Query(r.Context(), query, nil, models.FormatJSON, w); err != nil {
+		log.Error().Err(err).Str("table", table).Msg("Unable to list rejected rows")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// RedriveRejects inserts rejected rows into their table again and removes them
+// from the rejects table. Rows which fail again are rejected again. Rows which
+// are not valid JSON can never load, so they are skipped and kept.
+func (a *ScratchDataAPIStruct) RedriveRejects(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	var request RedriveRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.IDs) > maxRedriveRows {
+		http.Error(w, fmt.Sprintf("At most %d rows can be re-driven at once", maxRedriveRows), http.StatusBadRequest)
+		return
+	}
+
+	if !hasRejects(dest, table) {
+		render.JSON(w, r, render.M{"table": table, "redriven": 0, "skipped": 0})
+		return
+	}
+
+	rejectsTable := models.RejectsTable(table)
+	query, err := redriveQuery(dest, table, request.IDs)
+	if err != nil {
+		writeTableError(w, err)
+		return
+	}
+
+	var rows bytes.Buffer
+	if err := dest.Query(r.Context(), query, nil, models.FormatJSON, &rows); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	databaseID := a.AuthGetDatabaseID(r.Context())
+	redriven := []int64{}
+	skipped := 0
+	var writeErr error
+	for _, row := range gjson.ParseBytes(rows.Bytes()).Array() {
+		data := row.Get("data").String()
+		if !gjson.Valid(data) {
+			skipped++
+			continue
+		}
+
+		if writeErr = a.dataSink.WriteData(databaseID, table, []byte(data)); writeErr != nil {
+			break
+		}
+		redriven = append(redriven, row.Get("__row_id").Int())
+	}
+
+	// Rows handed to the data sink are removed even if a later one failed,
+	// so that they are not loaded twice
+	if len(redriven) > 0 {
+		_, err := dest.DeleteRows(r.Context(), rejectsTable, "__row_id IN ("+joinIDs(redriven)+")", nil)
+		if err != nil {
+			log.Error().Err(err).Str("table", rejectsTable).Int("rows", len(redriven)).Msg("Unable to remove re-driven rows")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		a.invalidateTable(databaseID, rejectsTable)
+	}
+
+	if writeErr != nil {
+		log.Error().Err(writeErr).Str("table", table).Msg("Unable to re-drive rejected row")
+		http.Error(w, fmt.Sprintf("Re-drove %d rows before failing: %s", len(redriven), writeErr), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, render.M{"table": table, "redriven": len(redriven), "skipped": skipped})
+}
+
+// rejectsQuery selects the newest rejected rows of table
+func rejectsQuery(dest destinations.Destination, table string, limit int) (string, error) {
+	rejectsTable, err := dest.QualifiedTable(models.RejectsTable(table))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"SELECT __row_id AS id, rejected_at, error, source_key, data FROM %s ORDER BY __row_id DESC LIMIT %d",
+		rejectsTable, limit,
+	), nil
+}
+
+// redriveQuery selects the rejected rows of table to re-drive, or all of
+// them, up to maxRedriveRows, if ids is empty
+func redriveQuery(dest destinations.Destination, table string, ids []int64) (string, error) {
+	rejectsTable, err := dest.QualifiedTable(models.RejectsTable(table))
+	if err != nil {
+		return "", err
+	}
+
+	query := fmt.Sprintf("SELECT __row_id, data FROM %s", rejectsTable)
+	if len(ids) > 0 {
+		query += " WHERE __row_id IN (" + joinIDs(ids) + ")"
+	}
+	query += fmt.Sprintf(" ORDER BY __row_id LIMIT %d", maxRedriveRows)
+	return query, nil
+}
+
+func joinIDs(ids []int64) string {
+	text := make([]string, len(ids))
+	for i, id := range ids {
+		text[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(text, ", ")
+}
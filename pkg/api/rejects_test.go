@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/scratchdata/scratchdata/pkg/destinations/bigquery"
+)
+
+func TestRejectsQueryBigQuery(t *testing.T) {
+	dest := &bigquery.BigQueryServer{}
+
+	query, err := rejectsQuery(dest, "analytics.events", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SELECT __row_id AS id, rejected_at, error, source_key, data FROM `analytics.events__rejects` ORDER BY __row_id DESC LIMIT 10"
+	if query != expected {
+		t.Errorf("expected %s; got %s", expected, query)
+	}
+
+	query, err = redriveQuery(dest, "analytics.events", []int64{3, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "SELECT __row_id, data FROM `analytics.events__rejects` WHERE __row_id IN (3, 7) ORDER BY __row_id LIMIT 10000"
+	if query != expected {
+		t.Errorf("expected %s; got %s", expected, query)
+	}
+
+	if _, err := rejectsQuery(dest, "events", 10); err == nil {
+		t.Error("expected an error for a table without a dataset")
+	}
+}
@@ -34,10 +34,39 @@ type ScratchDataAPI interface {
 	Insert(w http.ResponseWriter, r *http.Request)
 	Tables(w http.ResponseWriter, r *http.Request)
 	Columns(w http.ResponseWriter, r *http.Request)
+	DropTable(w http.ResponseWriter, r *http.Request)
+	TruncateTable(w http.ResponseWriter, r *http.Request)
+	RenameTable(w http.ResponseWriter, r *http.Request)
+	DeleteRows(w http.ResponseWriter, r *http.Request)
+	GetTableSchema(w http.ResponseWriter, r *http.Request)
+	PutTableSchema(w http.ResponseWriter, r *http.Request)
+	GetSchemaHistory(w http.ResponseWriter, r *http.Request)
+	Rejects(w http.ResponseWriter, r *http.Request)
+	RedriveRejects(w http.ResponseWriter, r *http.Request)
 
 	CreateQuery(w http.ResponseWriter, r *http.Request)
 	ShareData(w http.ResponseWriter, r *http.Request)
 
+	CreateQueryJob(w http.ResponseWriter, r *http.Request)
+	GetQueryJob(w http.ResponseWriter, r *http.Request)
+	CancelQueryJob(w http.ResponseWriter, r *http.Request)
+	QueryJobResult(w http.ResponseWriter, r *http.Request)
+
+	CreateCopyJob(w http.ResponseWriter, r *http.Request)
+	GetCopyJob(w http.ResponseWriter, r *http.Request)
+	CancelCopyJob(w http.ResponseWriter, r *http.Request)
+
+	PauseLoading(w http.ResponseWriter, r *http.Request)
+	ResumeLoading(w http.ResponseWriter, r *http.Request)
+	GetPauses(w http.ResponseWriter, r *http.Request)
+
+	QueueMessages(w http.ResponseWriter, r *http.Request)
+	GetQueueMessage(w http.ResponseWriter, r *http.Request)
+	RetryQueueMessage(w http.ResponseWriter, r *http.Request)
+	DeleteQueueMessage(w http.ResponseWriter, r *http.Request)
+	PurgeQueue(w http.ResponseWriter, r *http.Request)
+	QueueStats(w http.ResponseWriter, r *http.Request)
+
 	AuthMiddleware(next http.Handler) http.Handler
 	AuthGetDatabaseID(context.Context) int64
 
@@ -50,20 +79,51 @@ func CreateMux(apiFunctions *ScratchDataAPIStruct, c config.ScratchDataConfig) *
 	r := chi.NewRouter()
 	r.Use(PrometheusMiddleware)
 	r.Get("/healthcheck", apiFunctions.Healthcheck)
-	r.Get("/share/{uuid}/data.{format}", apiFunctions.ShareData)
+
+	compressor := NewQueryCompressor()
+	r.With(compressor.Handler).Get("/share/{uuid}/data.{format}", apiFunctions.ShareData)
 
 	api := chi.NewRouter()
 	api.Use(apiFunctions.AuthMiddleware)
-	api.Post("/data/insert/{table}", apiFunctions.Insert)
-	api.Get("/data/query", apiFunctions.Select)
-	api.Post("/data/query", apiFunctions.Select)
+	api.With(apiFunctions.DecompressBody).Post("/data/insert/{table}", apiFunctions.Insert)
+	api.With(compressor.Handler).Get("/data/query", apiFunctions.Select)
+	api.With(apiFunctions.DecompressBody, compressor.Handler).Post("/data/query", apiFunctions.Select)
 	api.Get("/tables", apiFunctions.Tables)
 	api.Get("/tables/{table}/columns", apiFunctions.Columns)
+	api.Get("/tables/{table}/schema", apiFunctions.GetTableSchema)
+	api.With(apiFunctions.RequireAdmin).Put("/tables/{table}/schema", apiFunctions.PutTableSchema)
+	api.Get("/tables/{table}/schema/history", apiFunctions.GetSchemaHistory)
+	api.Get("/tables/{table}/rejects", apiFunctions.Rejects)
+	api.Post("/tables/{table}/rejects/redrive", apiFunctions.RedriveRejects)
+	api.With(apiFunctions.RequireAdmin).Delete("/tables/{table}", apiFunctions.DropTable)
+	api.With(apiFunctions.RequireAdmin).Post("/tables/{table}/truncate", apiFunctions.TruncateTable)
+	api.With(apiFunctions.RequireAdmin).Post("/tables/{table}/rename", apiFunctions.RenameTable)
+	api.With(apiFunctions.RequireAdmin).Post("/tables/{table}/delete", apiFunctions.DeleteRows)
+	api.With(apiFunctions.RequireAdmin).Post("/tables/{table}/pause", apiFunctions.PauseLoading)
+	api.With(apiFunctions.RequireAdmin).Post("/tables/{table}/resume", apiFunctions.ResumeLoading)
+	api.With(apiFunctions.RequireAdmin).Post("/pause", apiFunctions.PauseLoading)
+	api.With(apiFunctions.RequireAdmin).Post("/resume", apiFunctions.ResumeLoading)
+	api.With(apiFunctions.RequireAdmin).Get("/pauses", apiFunctions.GetPauses)
 
 	api.Get("/destinations", apiFunctions.GetDestinations)
 	api.Post("/destinations", apiFunctions.CreateDestination)
 	api.Post("/destinations/{id}/keys", apiFunctions.AddAPIKey)
 	api.Post("/data/query/share", apiFunctions.CreateQuery)
+	api.With(apiFunctions.DecompressBody).Post("/data/query/jobs", apiFunctions.CreateQueryJob)
+	api.Get("/data/query/jobs/{id}", apiFunctions.GetQueryJob)
+	api.Post("/data/query/jobs/{id}/cancel", apiFunctions.CancelQueryJob)
+	api.With(compressor.Handler).Get("/data/query/jobs/{id}/result", apiFunctions.QueryJobResult)
+	api.With(apiFunctions.RequireAdmin).Post("/data/copy", apiFunctions.CreateCopyJob)
+	api.With(apiFunctions.RequireAdmin).Get("/data/copy/{id}", apiFunctions.GetCopyJob)
+	api.With(apiFunctions.RequireAdmin).Post("/data/copy/{id}/cancel", apiFunctions.CancelCopyJob)
+
+	queue := api.With(apiFunctions.RequireAdmin)
+	queue.Get("/queue/messages", apiFunctions.QueueMessages)
+	queue.Get("/queue/messages/{id}", apiFunctions.GetQueueMessage)
+	queue.Post("/queue/messages/{id}/retry", apiFunctions.RetryQueueMessage)
+	queue.Delete("/queue/messages/{id}", apiFunctions.DeleteQueueMessage)
+	queue.Post("/queue/purge", apiFunctions.PurgeQueue)
+	queue.Get("/queue/stats", apiFunctions.QueueStats)
 
 	r.Mount("/api", api)
 
@@ -89,7 +149,7 @@ func CreateMux(apiFunctions *ScratchDataAPIStruct, c config.ScratchDataConfig) *
 	})
 
 	if c.Dashboard.Enabled {
-		d, err := view.New(c.Dashboard, apiFunctions.Authenticator(apiFunctions.tokenAuth))
+		d, err := view.New(c.Dashboard, apiFunctions.Authenticator(apiFunctions.tokenAuth), apiFunctions.storageServices.Database)
 		if err != nil {
 			panic(err)
 		}
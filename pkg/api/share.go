@@ -2,12 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 )
 
 type CachedQueryData struct {
@@ -17,8 +22,10 @@ type CachedQueryData struct {
 
 func (a *ScratchDataAPIStruct) CreateQuery(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
-		Query    string `json:"query"`
-		Duration int    `json:"duration"` // Duration in seconds
+		Query    string        `json:"query"`
+		Params   models.Params `json:"params"`    // Defaults, which viewers may override with ?param.<name>=
+		Duration int           `json:"duration"`  // Duration in seconds
+		CacheTTL int           `json:"cache_ttl"` // Seconds to cache results for. 0 disables caching.
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -34,9 +41,19 @@ func (a *ScratchDataAPIStruct) CreateQuery(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Shared links are public, so the query must be read-only even for admin keys
+	if err := util.CheckReadOnlyQuery(requestBody.Query); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := util.CheckParams(requestBody.Query, requestBody.Params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	destId := a.AuthGetDatabaseID(r.Context())
 	expires := time.Duration(requestBody.Duration) * time.Second
-	sharedQueryId, err := a.storageServices.Database.CreateShareQuery(r.Context(), destId, requestBody.Query, expires)
+	sharedQueryId, err := a.storageServices.Database.CreateShareQuery(r.Context(), destId, requestBody.Query, requestBody.Params, time.Duration(requestBody.CacheTTL)*time.Second, expires)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
@@ -48,7 +65,11 @@ func (a *ScratchDataAPIStruct) CreateQuery(w http.ResponseWriter, r *http.Reques
 
 func (a *ScratchDataAPIStruct) ShareData(w http.ResponseWriter, r *http.Request) {
 	queryUUID := chi.URLParam(r, "uuid")
-	format := chi.URLParam(r, "format")
+	format, err := models.ParseFormat(chi.URLParam(r, "format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	id, err := uuid.Parse(queryUUID)
 	if err != nil {
@@ -62,7 +83,49 @@ func (a *ScratchDataAPIStruct) ShareData(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := a.executeQueryAndStreamData(r.Context(), w, cachedQuery.Query, cachedQuery.DestinationID, format); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	params, err := shareParams(cachedQuery.Params, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.executeQueryAndStreamData(r.Context(), w, cachedQuery.Query, params, cachedQuery.DestinationID, format, cachedQuery.CacheTTL); err != nil {
+		writeQueryError(w, err)
+	}
+}
+
+// shareParams overrides a shared query's default params with ?param.<name>= values.
+// Only params declared when the link was created can be set, and values are
+// parsed as the declared type. List values are comma-separated.
+func shareParams(defaults models.Params, values url.Values) (models.Params, error) {
+	params := models.Params{}
+	for name, param := range defaults {
+		params[name] = param
 	}
+
+	for key, value := range values {
+		name, ok := strings.CutPrefix(key, "param.")
+		if !ok {
+			continue
+		}
+
+		declared, ok := defaults[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+
+		var param models.Param
+		var err error
+		if declared.Type == models.ParamList {
+			param, err = models.ParseListParam(declared.ElementType(), value[0])
+		} else {
+			param, err = models.ParseParam(declared.Type, value[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", name, err)
+		}
+		params[name] = param
+	}
+
+	return params, nil
 }
@@ -1,10 +1,20 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/storage/cache"
+	dbModels "github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 )
 
 func (a *ScratchDataAPIStruct) Tables(w http.ResponseWriter, r *http.Request) {
@@ -42,3 +52,251 @@ func (a *ScratchDataAPIStruct) Columns(w http.ResponseWriter, r *http.Request) {
 
 	render.JSON(w, r, columns)
 }
+
+// TableFilter selects rows to delete. Filter is a SQL expression, as in a
+// WHERE clause, with {name} placeholders bound to Params.
+type TableFilter struct {
+	Filter string        `json:"filter"`
+	Params models.Params `json:"params"`
+}
+
+// tableDestination returns the destination and validated table name for a
+// table management request
+func (a *ScratchDataAPIStruct) tableDestination(w http.ResponseWriter, r *http.Request) (destinations.Destination, string, bool) {
+	table := chi.URLParam(r, "table")
+	if !util.ValidTableName(table) {
+		http.Error(w, "Invalid table name", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	dest, err := a.destinationManager.Destination(r.Context(), a.AuthGetDatabaseID(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	return dest, table, true
+}
+
+// writeTableError responds with 400 for table names the destination does not
+// accept, and 500 otherwise
+func writeTableError(w http.ResponseWriter, err error) {
+	if errors.Is(err, util.ErrQualifiedTable) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// invalidateTable drops cached query results for a table whose data has changed
+func (a *ScratchDataAPIStruct) invalidateTable(databaseID int64, table string) {
+	if a.storageServices.Cache == nil {
+		return
+	}
+
+	if err := cache.InvalidateTable(a.storageServices.Cache, databaseID, table); err != nil {
+		log.Error().Err(err).Int64("destination_id", databaseID).Str("table", table).Msg("Unable to invalidate cached queries")
+	}
+}
+
+func (a *ScratchDataAPIStruct) DropTable(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	if err := dest.DropTable(table); err != nil {
+		writeTableError(w, err)
+		return
+	}
+
+	a.invalidateTable(a.AuthGetDatabaseID(r.Context()), table)
+	render.JSON(w, r, render.M{"table": table, "status": "dropped"})
+}
+
+func (a *ScratchDataAPIStruct) TruncateTable(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	if err := dest.TruncateTable(table); err != nil {
+		writeTableError(w, err)
+		return
+	}
+
+	a.invalidateTable(a.AuthGetDatabaseID(r.Context()), table)
+	render.JSON(w, r, render.M{"table": table, "status": "truncated"})
+}
+
+func (a *ScratchDataAPIStruct) RenameTable(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !util.ValidTableName(request.Name) {
+		http.Error(w, "Invalid new table name", http.StatusBadRequest)
+		return
+	}
+
+	if err := dest.RenameTable(table, request.Name); err != nil {
+		writeTableError(w, err)
+		return
+	}
+
+	databaseID := a.AuthGetDatabaseID(r.Context())
+	a.invalidateTable(databaseID, table)
+	a.invalidateTable(databaseID, request.Name)
+	render.JSON(w, r, render.M{"table": request.Name, "previous_name": table, "status": "renamed"})
+}
+
+// DeleteRows deletes the rows of a table which match a filter, such as for an
+// erasure request. The filter is required; use TruncateTable to delete every row.
+func (a *ScratchDataAPIStruct) DeleteRows(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	var request TableFilter
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := util.CheckFilter(request.Filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := util.CheckParams(request.Filter, request.Params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := dest.DeleteRows(r.Context(), table, request.Filter, request.Params)
+	if err != nil {
+		writeTableError(w, err)
+		return
+	}
+
+	a.invalidateTable(a.AuthGetDatabaseID(r.Context()), table)
+
+	response := render.M{"table": table, "status": "deleted"}
+	if deleted >= 0 {
+		response["deleted_rows"] = deleted
+	}
+	render.JSON(w, r, response)
+}
+
+// TableSchemaRequest declares the types of some or all of a table's columns
+type TableSchemaRequest struct {
+	Columns []models.SchemaColumn `json:"columns"`
+}
+
+func (a *ScratchDataAPIStruct) GetTableSchema(w http.ResponseWriter, r *http.Request) {
+	table := chi.URLParam(r, "table")
+	databaseID := a.AuthGetDatabaseID(r.Context())
+
+	columns, err := a.storageServices.Database.GetTableSchema(r.Context(), databaseID, table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if columns == nil {
+		columns = []models.SchemaColumn{}
+	}
+
+	render.JSON(w, r, render.M{"table": table, "columns": columns})
+}
+
+// PutTableSchema replaces a table's declared column types. The table and any
+// missing columns are created right away, so that the first insert does not
+// infer their types. Existing columns keep the type they already have.
+func (a *ScratchDataAPIStruct) PutTableSchema(w http.ResponseWriter, r *http.Request) {
+	dest, table, ok := a.tableDestination(w, r)
+	if !ok {
+		return
+	}
+
+	var request TableSchemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid schema: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, column := range request.Columns {
+		if !util.ValidColumnName(column.Name) || column.Name == keysetColumn {
+			http.Error(w, fmt.Sprintf("Invalid column name %q", column.Name), http.StatusBadRequest)
+			return
+		}
+		if seen[column.Name] {
+			http.Error(w, fmt.Sprintf("Column %q is declared more than once", column.Name), http.StatusBadRequest)
+			return
+		}
+		seen[column.Name] = true
+	}
+
+	databaseID := a.AuthGetDatabaseID(r.Context())
+	err := a.storageServices.Database.SetTableSchema(r.Context(), databaseID, table, request.Columns)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := dest.CreateEmptyTable(table); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := dest.CreateDeclaredColumns(table, request.Columns); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, render.M{"table": table, "columns": request.Columns})
+}
+
+// SchemaChangeResponse is one entry in a table's schema history
+type SchemaChangeResponse struct {
+	Column       string                      `json:"column"`
+	Action       dbModels.SchemaChangeAction `json:"action"`
+	OldType      string                      `json:"old_type,omitempty"`
+	NewType      string                      `json:"new_type,omitempty"`
+	SourceColumn string                      `json:"source_column,omitempty"`
+	CreatedAt    time.Time                   `json:"created_at"`
+}
+
+// GetSchemaHistory lists the columns added, widened and rejected while loading
+// data into a table, oldest first
+func (a *ScratchDataAPIStruct) GetSchemaHistory(w http.ResponseWriter, r *http.Request) {
+	table := chi.URLParam(r, "table")
+	databaseID := a.AuthGetDatabaseID(r.Context())
+
+	changes, err := a.storageServices.Database.GetSchemaChanges(r.Context(), databaseID, table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history := []SchemaChangeResponse{}
+	for _, change := range changes {
+		history = append(history, SchemaChangeResponse{
+			Column:       change.Column,
+			Action:       change.Action,
+			OldType:      change.OldType,
+			NewType:      change.NewType,
+			SourceColumn: change.SourceColumn,
+			CreatedAt:    change.CreatedAt,
+		})
+	}
+
+	render.JSON(w, r, render.M{"table": table, "changes": history})
+}
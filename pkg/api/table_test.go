@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/storage"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/static"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	a := &ScratchDataAPIStruct{}
+	handler := a.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		ctx      context.Context
+		expected int
+	}{
+		{context.WithValue(context.Background(), "databaseId", uint(1)), http.StatusForbidden},
+		{context.WithValue(context.WithValue(context.Background(), "databaseId", int64(1)), "isAdmin", true), http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/api/tables/events", nil).WithContext(test.ctx)
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.expected {
+			t.Errorf("Expected %d; got %d", test.expected, w.Code)
+		}
+		if id := a.AuthGetDatabaseID(test.ctx); id != 1 {
+			t.Errorf("Expected destination 1; got %d", id)
+		}
+	}
+}
+
+func TestPutTableSchemaRequiresAdmin(t *testing.T) {
+	db, err := static.NewStaticDatabase(config.Database{}, []config.Destination{{ID: 0, APIKeys: []string{"local"}}}, []config.APIKey{{Key: "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &ScratchDataAPIStruct{
+		storageServices: &storage.Services{Database: db},
+		tokenAuth:       jwtauth.New("HS256", []byte("secret"), nil),
+	}
+	mux := CreateMux(a, config.ScratchDataConfig{})
+
+	body := strings.NewReader(`{"columns": [{"name": "zip", "type": "string"}]}`)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/tables/events/schema?api_key=local", body))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected %d; got %d", http.StatusForbidden, w.Code)
+	}
+	columns, err := db.GetTableSchema(context.Background(), 0, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 0 {
+		t.Errorf("Expected no columns to be declared, got %+v", columns)
+	}
+}
@@ -16,6 +16,21 @@ type API struct {
 	Enabled             bool   `yaml:"enabled" env:"SCRATCH_API_ENABLED"`
 	Port                int    `yaml:"port"`
 	HealthCheckFailFile string `yaml:"healthcheck_fail_file"`
+
+	// Inserts with a repeated Idempotency-Key header or __row_id within this
+	// many seconds are dropped. Requires a cache. 0 disables deduplication.
+	IdempotencyWindowSeconds int `yaml:"idempotency_window_seconds"`
+
+	// Compressed request bodies larger than this once decompressed are
+	// rejected with a 413. Defaults to 1 GiB.
+	MaxDecompressedBytes int64 `yaml:"max_decompressed_bytes"`
+
+	// Queries running longer than this many seconds are cancelled on the
+	// destination. API keys may set a lower limit. 0 means no limit.
+	MaxExecutionSeconds int `yaml:"max_execution_seconds"`
+
+	// Query results larger than this are not cached. Defaults to 10 MiB.
+	QueryCacheMaxBytes int `yaml:"query_cache_max_bytes"`
 }
 
 type Workers struct {
@@ -23,6 +38,22 @@ type Workers struct {
 	Count                  int    `yaml:"count"`
 	DataDirectory          string `yaml:"data_directory"`
 	FreeSpaceRequiredBytes int64  `yaml:"free_space_required_bytes"`
+
+	// Query jobs running longer than this many seconds are cancelled. 0 means no limit.
+	MaxExecutionSeconds int `yaml:"max_execution_seconds"`
+
+	// Failed messages are retried after RetryBaseSeconds, doubling each time up
+	// to RetryMaxSeconds, until they have been tried MaxAttempts times
+	MaxAttempts      int `yaml:"max_attempts"`
+	RetryBaseSeconds int `yaml:"retry_base_seconds"`
+	RetryMaxSeconds  int `yaml:"retry_max_seconds"`
+
+	// Messages whose worker has not sent a heartbeat for this many seconds are
+	// presumed abandoned and returned to the queue
+	VisibilityTimeoutSeconds int `yaml:"visibility_timeout_seconds"`
+
+	// Copy jobs export their source to the blob store in files of this many rows
+	CopyChunkRows int `yaml:"copy_chunk_rows"`
 }
 
 type Queue struct {
@@ -51,6 +82,9 @@ type Destination struct {
 	Name     string         `yaml:"name" json:"name"`
 	Settings map[string]any `yaml:"settings" json:"settings"`
 	APIKeys  []string       `yaml:"api_keys" json:"api_keys"`
+
+	// Limit on query time for this destination's API keys. 0 uses the global limit.
+	MaxExecutionSeconds int `yaml:"max_execution_seconds" json:"max_execution_seconds"`
 }
 
 type DataSink struct {
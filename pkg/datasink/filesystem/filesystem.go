@@ -18,6 +18,7 @@ import (
 	"github.com/EagleChen/mapmutex"
 	"github.com/bwmarrin/snowflake"
 	"github.com/rs/zerolog/log"
+	sinkmodels "github.com/scratchdata/scratchdata/pkg/datasink/models"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
 	queuemodels "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
 )
@@ -312,7 +313,7 @@ func (m *DataSink) key(databaseID int64, table string) string {
 
 func (m *DataSink) WriteData(databaseID int64, table string, data []byte) error {
 	if !m.enabled {
-		return errors.New("writer is disabled")
+		return sinkmodels.ErrDisabled
 	}
 
 	m.wg.Add(1)
@@ -350,7 +351,7 @@ func (m *DataSink) WriteData(databaseID int64, table string, data []byte) error
 
 		fileDetails.rowCount += 1
 	} else {
-		return errors.New("Could not acquire lock")
+		return sinkmodels.ErrLockContention
 	}
 
 	return nil
@@ -0,0 +1,10 @@
+package models
+
+import "errors"
+
+// ErrLockContention is returned when another request is currently writing to
+// the same table. The write can be retried.
+var ErrLockContention = errors.New("could not acquire lock")
+
+// ErrDisabled is returned when the sink is shutting down and no longer accepts data
+var ErrDisabled = errors.New("writer is disabled")
@@ -2,6 +2,7 @@ package bigquery
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/scratchdata/scratchdata/pkg/util"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"cloud.google.com/go/bigquery"
 
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/storage/blobstore/gcs"
 )
 
@@ -29,6 +31,58 @@ func (s *BigQueryServer) jsonTypeToBQType(jsonType string) bigquery.FieldType {
 	}
 }
 
+// declaredToBQType maps a declared column type to a BigQuery type
+func declaredToBQType(t models.ColumnType) string {
+	switch t.Kind {
+	case models.KindInt:
+		return "INT64"
+	case models.KindFloat:
+		return "FLOAT64"
+	case models.KindBool:
+		return "BOOL"
+	case models.KindTimestamp:
+		return "TIMESTAMP"
+	case models.KindDate:
+		return "DATE"
+	case models.KindDecimal:
+		if t.Precision-t.Scale > 29 || t.Scale > 9 {
+			return fmt.Sprintf("BIGNUMERIC(%d, %d)", t.Precision, t.Scale)
+		}
+		return fmt.Sprintf("NUMERIC(%d, %d)", t.Precision, t.Scale)
+	case models.KindJSON:
+		return "JSON"
+	case models.KindArray:
+		return "ARRAY<" + declaredToBQType(*t.Element) + ">"
+	default:
+		return "STRING"
+	}
+}
+
+// fieldDDLType is the type of an existing column as written in DDL
+func fieldDDLType(field *bigquery.FieldSchema) string {
+	var colType string
+	switch field.Type {
+	case bigquery.IntegerFieldType:
+		colType = "INT64"
+	case bigquery.FloatFieldType:
+		colType = "FLOAT64"
+	case bigquery.BooleanFieldType:
+		colType = "BOOL"
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		colType = string(field.Type)
+		if field.Precision > 0 {
+			colType = fmt.Sprintf("%s(%d, %d)", field.Type, field.Precision, field.Scale)
+		}
+	default:
+		colType = string(field.Type)
+	}
+
+	if field.Repeated {
+		return "ARRAY<" + colType + ">"
+	}
+	return colType
+}
+
 func (s *BigQueryServer) CreateEmptyTable(name string) error {
 	ctx := context.Background()
 	res := strings.Split(name, ".")
@@ -76,6 +130,35 @@ func (s *BigQueryServer) createColumns(table string, jsonTypes map[string]string
 	return nil
 }
 
+func (s *BigQueryServer) CreateDeclaredColumns(table string, columns []models.SchemaColumn) error {
+	ctx := context.Background()
+
+	for _, column := range columns {
+		query := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN IF NOT EXISTS `%s` %s", table, column.Name, declaredToBQType(column.Type))
+		_, err := s.conn.Query(query).Read(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("query", query).Msg("CreateDeclaredColumns: cannot run query")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BigQuery can change INT64 columns to FLOAT64, but not any column to STRING
+func (s *BigQueryServer) WidenColumn(table string, column string, jsonType string) error {
+	if jsonType != "float" {
+		return errors.ErrUnsupported
+	}
+
+	query := fmt.Sprintf("ALTER TABLE `%s` ALTER COLUMN `%s` SET DATA TYPE %s", table, column, s.jsonTypeToBQType(jsonType))
+	_, err := s.conn.Query(query).Read(context.Background())
+	if err != nil {
+		log.Error().Err(err).Str("query", query).Msg("WidenColumn: cannot run query")
+	}
+	return err
+}
+
 func (s *BigQueryServer) CreateColumns(table string, fileName string) error {
 	input, err := os.Open(fileName)
 	if err != nil {
@@ -181,10 +264,28 @@ func (s *BigQueryServer) streamDataToBigQuery(table string, gcsFilePath string,
 
 	ctx := context.Background()
 
+	// Columns which already exist, such as declared ones, are loaded as their
+	// own type rather than the one inferred from this file
+	existing := map[string]string{}
+	datasetID, tableID, err := splitTableName(table)
+	if err != nil {
+		return err
+	}
+	meta, err := s.conn.Dataset(datasetID).Table(tableID).Metadata(ctx)
+	if err != nil {
+		return err
+	}
+	for _, field := range meta.Schema {
+		existing[field.Name] = fieldDDLType(field)
+	}
+
 	columns := "("
 	first := true
 	for colName, jsonType := range jsonTypes {
-		colType := s.jsonTypeToBQType(jsonType)
+		colType := string(s.jsonTypeToBQType(jsonType))
+		if fieldType, ok := existing[colName]; ok {
+			colType = fieldType
+		}
 		if !first {
 			columns += ", "
 		} else {
@@ -196,7 +297,7 @@ func (s *BigQueryServer) streamDataToBigQuery(table string, gcsFilePath string,
 	columns += ")"
 
 	query := fmt.Sprintf("LOAD DATA INTO %s %s FROM FILES ( format = 'JSON', uris = ['%s'] )", table, columns, location)
-	_, err := s.conn.Query(query).Read(ctx)
+	_, err = s.conn.Query(query).Read(ctx)
 	if err != nil {
 		log.Error().Err(err).Str("query", query).Msg("StreamDataToBigQuery: failed to stream data to BigQuery")
 		return err
@@ -0,0 +1,110 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	"google.golang.org/api/iterator"
+)
+
+// pageToken finds the next page of a finished query job's results
+type pageToken struct {
+	JobID    string `json:"job_id"`
+	Location string `json:"location"`
+	Token    string `json:"token"`
+}
+
+// QueryPage writes up to limit rows of a query's result as Parquet. The first
+// page runs the query. Later pages read the next page of that job's results
+// using the returned token, so the query is not run again.
+func (b *BigQueryServer) QueryPage(ctx context.Context, query string, params models.Params, limit int, token string, writer io.Writer) (string, int64, error) {
+	var job *bigquery.Job
+	var page pageToken
+
+	if token == "" {
+		bound, parameters, err := bindParams(query, params)
+		if err != nil {
+			return "", 0, err
+		}
+
+		q := b.conn.Query(bound)
+		q.Parameters = parameters
+		if deadline, ok := ctx.Deadline(); ok {
+			q.JobTimeout = time.Until(deadline)
+		}
+
+		job, err = q.Run(ctx)
+		if err != nil {
+			return "", 0, err
+		}
+	} else {
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return "", 0, err
+		}
+		if err := json.Unmarshal(decoded, &page); err != nil {
+			return "", 0, err
+		}
+
+		job, err = b.conn.JobFromIDLocation(ctx, page.JobID, page.Location)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	stop := watchJob(ctx, job)
+	defer stop()
+
+	itr, err := job.Read(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var rows [][]bigquery.Value
+	nextToken, err := iterator.NewPager(itr, limit, page.Token).NextPage(&rows)
+	if err != nil {
+		return "", 0, err
+	}
+
+	columns := make([]rowencoder.Column, len(itr.Schema))
+	for i, field := range itr.Schema {
+		columns[i] = bigQueryColumn(field)
+	}
+
+	encoder, err := rowencoder.New(models.FormatParquet, writer, columns)
+	if err != nil {
+		return "", 0, err
+	}
+
+	values := make([]any, len(columns))
+	for _, row := range rows {
+		for i := range values {
+			values[i] = row[i]
+		}
+
+		if err := encoder.Write(values); err != nil {
+			encoder.Close()
+			return "", 0, err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return "", 0, err
+	}
+
+	if nextToken == "" {
+		return "", int64(itr.TotalRows), nil
+	}
+
+	next, err := json.Marshal(pageToken{JobID: job.ID(), Location: job.Location(), Token: nextToken})
+	if err != nil {
+		return "", 0, err
+	}
+	return base64.RawURLEncoding.EncodeToString(next), int64(itr.TotalRows), nil
+}
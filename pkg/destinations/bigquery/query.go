@@ -6,26 +6,95 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	"github.com/scratchdata/scratchdata/pkg/util"
 	"google.golang.org/api/iterator"
 )
 
-func (b *BigQueryServer) QueryJSON(query string, writer io.Writer) error {
-	// NOTE: Query should be with dataset as prefix. Example: SELECT * FROM `dataset.table`
+// read starts a query job and returns an iterator over its rows. If ctx ends
+// before stop is called, the job is cancelled on the server.
+func (b *BigQueryServer) read(ctx context.Context, query string, parameters []bigquery.QueryParameter) (*bigquery.RowIterator, func(), error) {
+	q := b.conn.Query(query)
+	q.Parameters = parameters
+	if deadline, ok := ctx.Deadline(); ok {
+		q.JobTimeout = time.Until(deadline)
+	}
+
+	job, err := q.Run(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stop := watchJob(ctx, job)
+	itr, err := job.Read(ctx)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+
+	return itr, stop, nil
+}
 
-	ctx := context.TODO()
+// exec runs a statement which returns no rows and waits for it to finish
+func (b *BigQueryServer) exec(ctx context.Context, query string, parameters []bigquery.QueryParameter) (*bigquery.JobStatus, error) {
 	q := b.conn.Query(query)
+	q.Parameters = parameters
+	if deadline, ok := ctx.Deadline(); ok {
+		q.JobTimeout = time.Until(deadline)
+	}
+
+	job, err := q.Run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := watchJob(ctx, job)
+	defer stop()
+
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status, status.Err()
+}
+
+// watchJob cancels job on the server if ctx ends before stop is called
+func watchJob(ctx context.Context, job *bigquery.Job) (stop func()) {
+	done := make(chan struct{})
+	stop = sync.OnceFunc(func() { close(done) })
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancelCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := job.Cancel(cancelCtx); err != nil {
+				log.Error().Err(err).Str("job_id", job.ID()).Msg("Unable to cancel BigQuery job")
+			}
+		case <-done:
+		}
+	}()
+	return stop
+}
+
+func (b *BigQueryServer) QueryJSON(ctx context.Context, query string, writer io.Writer, parameters ...bigquery.QueryParameter) error {
+	// NOTE: Query should be with dataset as prefix. Example: SELECT * FROM `dataset.table`
 
 	writer.Write([]byte("["))
 	enc := json.NewEncoder(writer)
 
-	itr, err := q.Read(ctx)
+	itr, stop, err := b.read(ctx, query, parameters)
 	if err != nil {
 		log.Error().Err(err).Msg("error getting query iterator")
 		return err
 	}
+	defer stop()
 	firstRow := true
 	for {
 		var data map[string]bigquery.Value
@@ -33,6 +102,10 @@ func (b *BigQueryServer) QueryJSON(query string, writer io.Writer) error {
 
 		if err == iterator.Done {
 			break
+		} else if err != nil {
+			// The array is left open so that clients can tell the result is incomplete
+			log.Error().Err(err).Msg("error reading query results")
+			return err
 		}
 		if !firstRow {
 			_, err = writer.Write([]byte(","))
@@ -54,20 +127,17 @@ func (b *BigQueryServer) QueryJSON(query string, writer io.Writer) error {
 	return nil
 }
 
-func (b *BigQueryServer) QueryCSV(query string, writer io.Writer) error {
+func (b *BigQueryServer) QueryCSV(ctx context.Context, query string, writer io.Writer, parameters ...bigquery.QueryParameter) error {
 	// NOTE: Query should be with dataset as prefix. Example: SELECT * FROM `dataset.table`
 
-	ctx := context.TODO()
-	q := b.conn.Query(query)
-
 	enc := csv.NewWriter(writer)
 
-	columnsQuery := b.conn.Query(query)
-	columnsItr, err := columnsQuery.Read(ctx)
+	columnsItr, stopColumns, err := b.read(ctx, query, parameters)
 	if err != nil {
 		log.Error().Err(err).Msg("error getting columns query iterator")
 		return err
 	}
+	defer stopColumns()
 
 	columns := make([]string, 0)
 	columnsRow := make(map[string]bigquery.Value)
@@ -85,11 +155,12 @@ func (b *BigQueryServer) QueryCSV(query string, writer io.Writer) error {
 		return err
 	}
 
-	dataItr, err := q.Read(ctx)
+	dataItr, stop, err := b.read(ctx, query, parameters)
 	if err != nil {
 		log.Error().Err(err).Msg("error getting data query iterator")
 		return err
 	}
+	defer stop()
 
 	for {
 		var dataRow map[string]bigquery.Value
@@ -97,6 +168,9 @@ func (b *BigQueryServer) QueryCSV(query string, writer io.Writer) error {
 
 		if err == iterator.Done {
 			break
+		} else if err != nil {
+			log.Error().Err(err).Msg("error reading query results")
+			return err
 		}
 
 		row := make([]string, len(columns))
@@ -123,3 +197,116 @@ func (b *BigQueryServer) QueryCSV(query string, writer io.Writer) error {
 
 	return nil
 }
+
+// bigQueryType maps a BigQuery field type to an encoder type
+func bigQueryType(field *bigquery.FieldSchema) rowencoder.Type {
+	if field.Repeated {
+		return rowencoder.String
+	}
+
+	switch field.Type {
+	case bigquery.IntegerFieldType:
+		return rowencoder.Int64
+	case bigquery.FloatFieldType:
+		return rowencoder.Float64
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		return rowencoder.Decimal
+	case bigquery.BooleanFieldType:
+		return rowencoder.Bool
+	case bigquery.TimestampFieldType:
+		return rowencoder.Timestamp
+	default:
+		return rowencoder.String
+	}
+}
+
+// bigQueryColumn describes a result field to the encoder
+func bigQueryColumn(field *bigquery.FieldSchema) rowencoder.Column {
+	column := rowencoder.Column{Name: field.Name, Type: bigQueryType(field), DatabaseType: string(field.Type)}
+	if column.Type != rowencoder.Decimal {
+		return column
+	}
+
+	// Parameterized types report their precision. Otherwise it is the type's default.
+	column.Precision, column.Scale = int(field.Precision), int(field.Scale)
+	if column.Precision == 0 {
+		column.Precision, column.Scale = 38, 9
+		if field.Type == bigquery.BigNumericFieldType {
+			column.Precision, column.Scale = 76, 38
+		}
+	}
+	return column
+}
+
+// bindParams rewrites {name} placeholders as BigQuery named parameters
+func bindParams(query string, params models.Params) (string, []bigquery.QueryParameter, error) {
+	var parameters []bigquery.QueryParameter
+	bound, err := util.BindParams(query, params, func(value models.Param) string {
+		name := fmt.Sprintf("p%d", len(parameters))
+		parameters = append(parameters, bigquery.QueryParameter{Name: name, Value: value.Value})
+		return "@" + name
+	})
+	return bound, parameters, err
+}
+
+func (b *BigQueryServer) Query(ctx context.Context, query string, params models.Params, format models.Format, writer io.Writer) error {
+	query, parameters, err := bindParams(query, params)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case models.FormatJSON:
+		return b.QueryJSON(ctx, query, writer, parameters...)
+	case models.FormatCSV:
+		return b.QueryCSV(ctx, query, writer, parameters...)
+	}
+
+	start := time.Now()
+	itr, stop, err := b.read(ctx, query, parameters)
+	if err != nil {
+		log.Error().Err(err).Msg("error getting query iterator")
+		return err
+	}
+	defer stop()
+
+	// The schema is only known once the first page has been fetched
+	var row []bigquery.Value
+	err = itr.Next(&row)
+	if err != nil && err != iterator.Done {
+		return err
+	}
+	hasRow := err == nil
+
+	columns := make([]rowencoder.Column, len(itr.Schema))
+	for i, field := range itr.Schema {
+		columns[i] = bigQueryColumn(field)
+	}
+
+	encoder, err := rowencoder.NewSince(format, writer, columns, start)
+	if err != nil {
+		return err
+	}
+
+	values := make([]any, len(columns))
+	for hasRow {
+		for i := range values {
+			values[i] = row[i]
+		}
+
+		if err := encoder.Write(values); err != nil {
+			encoder.Close()
+			return err
+		}
+
+		err = itr.Next(&row)
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			encoder.Close()
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
@@ -6,22 +6,21 @@ import (
 	"fmt"
 	"strings"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/rs/zerolog/log"
 	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 	"google.golang.org/api/iterator"
 )
 
 func (b *BigQueryServer) Columns(table string) ([]models.Column, error) {
 	rc := []models.Column{}
 
-	tokens := strings.Split(table, ".")
-	if len(tokens) != 2 {
-		return nil, errors.New("Table should be in the format dataset.table")
+	datasetID, tableID, err := splitTableName(table)
+	if err != nil {
+		return nil, err
 	}
 
-	datasetID := tokens[0]
-	tableID := tokens[1]
-
 	ctx := context.TODO()
 	tableInfo := b.conn.Dataset(datasetID).Table(tableID)
 	meta, err := tableInfo.Metadata(ctx)
@@ -31,15 +30,16 @@ func (b *BigQueryServer) Columns(table string) ([]models.Column, error) {
 
 	for _, field := range meta.Schema {
 		rc = append(rc, models.Column{
-			Name: field.Name,
-			Type: string(field.Type),
+			Name:     field.Name,
+			Type:     string(field.Type),
+			JSONType: util.JSONTypeForColumn(string(field.Type)),
 		})
 	}
 	return rc, nil
 }
 
-func (b *BigQueryServer) Tables() ([]string, error) {
-	rc := []string{}
+func (b *BigQueryServer) Tables() ([]models.Table, error) {
+	rc := []models.Table{}
 
 	ctx := context.TODO()
 	it := b.conn.Datasets(ctx)
@@ -63,9 +63,93 @@ func (b *BigQueryServer) Tables() ([]string, error) {
 				log.Error().Err(err).Str("dataset_id", dataset.DatasetID).Msg("Failed to list tables")
 				continue
 			}
-			rc = append(rc, fmt.Sprintf("%s.%s", dataset.DatasetID, table.TableID))
+
+			info := models.Table{Name: fmt.Sprintf("%s.%s", dataset.DatasetID, table.TableID)}
+
+			meta, err := table.Metadata(ctx)
+			if err != nil {
+				log.Error().Err(err).Str("table", info.Name).Msg("Failed to get table metadata")
+			} else if meta.Type == bigquery.RegularTable {
+				rows, bytes := int64(meta.NumRows), meta.NumBytes
+				info.Rows, info.Bytes = &rows, &bytes
+			}
+
+			rc = append(rc, info)
 		}
 	}
 
 	return rc, nil
 }
+
+// splitTableName splits a dataset.table name
+func splitTableName(table string) (string, string, error) {
+	tokens := strings.Split(table, ".")
+	if len(tokens) != 2 {
+		return "", "", errors.New("Table should be in the format dataset.table")
+	}
+	return tokens[0], tokens[1], nil
+}
+
+func (b *BigQueryServer) QualifiedTable(table string) (string, error) {
+	if _, _, err := splitTableName(table); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("`%s`", table), nil
+}
+
+func (b *BigQueryServer) DropTable(table string) error {
+	datasetID, tableID, err := splitTableName(table)
+	if err != nil {
+		return err
+	}
+	return b.conn.Dataset(datasetID).Table(tableID).Delete(context.TODO())
+}
+
+func (b *BigQueryServer) TruncateTable(table string) error {
+	if _, _, err := splitTableName(table); err != nil {
+		return err
+	}
+
+	_, err := b.exec(context.TODO(), fmt.Sprintf("TRUNCATE TABLE `%s`", table), nil)
+	return err
+}
+
+// RenameTable renames a table within its dataset. newName may include the
+// dataset, as long as it is the same one.
+func (b *BigQueryServer) RenameTable(table string, newName string) error {
+	datasetID, _, err := splitTableName(table)
+	if err != nil {
+		return err
+	}
+
+	if newDataset, newTable, err := splitTableName(newName); err == nil {
+		if newDataset != datasetID {
+			return errors.New("tables cannot be renamed to a different dataset")
+		}
+		newName = newTable
+	}
+
+	_, err = b.exec(context.TODO(), fmt.Sprintf("ALTER TABLE `%s` RENAME TO `%s`", table, newName), nil)
+	return err
+}
+
+func (b *BigQueryServer) DeleteRows(ctx context.Context, table string, filter string, params models.Params) (int64, error) {
+	if _, _, err := splitTableName(table); err != nil {
+		return 0, err
+	}
+
+	filter, parameters, err := bindParams(filter, params)
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := b.exec(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE (%s)", table, filter), parameters)
+	if err != nil {
+		return 0, err
+	}
+
+	if stats, ok := status.Statistics.Details.(*bigquery.QueryStatistics); ok {
+		return stats.NumDMLAffectedRows, nil
+	}
+	return -1, nil
+}
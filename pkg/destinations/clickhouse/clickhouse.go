@@ -5,9 +5,15 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/scratchdata/scratchdata/pkg/util"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -27,6 +33,11 @@ type ClickhouseServer struct {
 
 	StoragePolicy string `mapstructure:"storage_policy"`
 
+	// Create tables as ReplacingMergeTree so rows with the same __row_id are
+	// collapsed when parts are merged. This only applies to tables created
+	// after it is set. Existing MergeTree tables are not converted.
+	DedupeRowID bool `mapstructure:"dedupe_row_id"`
+
 	MaxOpenConns        int `mapstructure:"max_open_conns"`
 	MaxIdleConns        int `mapstructure:"max_idle_conns"`
 	ConnMaxLifetimeSecs int `mapstructure:"conn_max_lifetime_secs"`
@@ -86,11 +97,31 @@ func (s *ClickhouseServer) Close() error {
 	return s.conn.Close()
 }
 
-func (s *ClickhouseServer) httpQuery(query string) (io.ReadCloser, error) {
-	url := fmt.Sprintf("%s://%s:%d", s.HTTPProtocol, s.Host, s.HTTPPort)
+// httpQuery runs a query over the HTTP interface. Each query gets an ID so that it
+// can be killed on the server if ctx is cancelled before the response is consumed.
+// A deadline on ctx is also sent as max_execution_time, and read-only requests
+// are sent with readonly=2, which still allows that setting.
+func (s *ClickhouseServer) httpQuery(ctx context.Context, query string, queryParams url.Values) (io.ReadCloser, error) {
+	queryID := uuid.New().String()
+
+	params := url.Values{}
+	for name, values := range queryParams {
+		params[name] = values
+	}
+	params.Set("query_id", queryID)
+	params.Set("cancel_http_readonly_queries_on_client_close", "1")
+	if deadline, ok := ctx.Deadline(); ok {
+		seconds := int(math.Ceil(time.Until(deadline).Seconds()))
+		params.Set("max_execution_time", strconv.Itoa(max(seconds, 1)))
+	}
+	if util.IsReadOnly(ctx) {
+		params.Set("readonly", "2")
+	}
+
+	endpoint := fmt.Sprintf("%s://%s:%d/?%s", s.HTTPProtocol, s.Host, s.HTTPPort, params.Encode())
 
 	var jsonStr = []byte(query)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonStr))
 	if err != nil {
 		return nil, err
 	}
@@ -99,14 +130,56 @@ func (s *ClickhouseServer) httpQuery(query string) (io.ReadCloser, error) {
 	req.Header.Set("X-Clickhouse-Key", s.Password)
 	req.Header.Set("X-Clickhouse-Database", s.Database)
 
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.killQuery(queryID)
+		case <-done:
+		}
+	}()
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
+		close(done)
 		log.Error().Err(err).Msg("request failed")
 		return nil, err
 	}
 
-	return resp.Body, nil
+	// Errors before the first row arrive as a non-200 response with the message in the body
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		close(done)
+
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, fmt.Errorf("clickhouse: %s", strings.TrimSpace(string(message)))
+	}
+
+	return &queryBody{ReadCloser: resp.Body, done: done}, nil
+}
+
+// queryBody stops watching for cancellation once the response is closed
+type queryBody struct {
+	io.ReadCloser
+	done chan struct{}
+	once sync.Once
+}
+
+func (b *queryBody) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return b.ReadCloser.Close()
+}
+
+func (s *ClickhouseServer) killQuery(queryID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	log.Debug().Str("query_id", queryID).Msg("Killing cancelled query")
+	err := s.conn.Exec(ctx, "KILL QUERY WHERE query_id = '"+queryID+"' ASYNC")
+	if err != nil {
+		log.Error().Err(err).Str("query_id", queryID).Msg("Unable to kill query")
+	}
 }
 
 func OpenServer(settings map[string]any) (*ClickhouseServer, error) {
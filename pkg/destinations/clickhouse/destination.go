@@ -8,14 +8,19 @@ import (
 )
 
 func (s *ClickhouseServer) CreateEmptyTable(table string) error {
+	engine := "MergeTree"
+	if s.DedupeRowID {
+		engine = "ReplacingMergeTree"
+	}
+
 	sql := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS "%s"."%s" 
 		(
 		    __row_id Int64
 		)
-		 ENGINE = MergeTree
+		 ENGINE = %s
 		PRIMARY KEY(__row_id)
-	`, s.Database, table)
+	`, s.Database, table, engine)
 
 	return s.conn.Exec(context.TODO(), sql)
 }
@@ -6,117 +6,92 @@ import (
 	"fmt"
 	"io"
 	"math/big"
-	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 	"github.com/shopspring/decimal"
 	"github.com/tidwall/gjson"
 )
 
 func (s *ClickhouseServer) inferColumnTypes(file io.ReadSeeker) (map[string]string, error) {
-	rc := map[string]string{}
-
-	typeCounts := map[string]map[string]int{}
+	return util.GetJSONTypes(file)
+}
 
-	_, err := file.Seek(0, io.SeekStart)
-	if err != nil {
-		return rc, err
+// jsonToClickhouse maps an inferred JSON type to a ClickHouse type
+func jsonToClickhouse(jsonType string) string {
+	switch jsonType {
+	case "int":
+		return "Int64"
+	case "bool":
+		return "Boolean"
+	case "float":
+		return "Float64"
+	default:
+		return "String"
 	}
+}
 
-	scanner := bufio.NewScanner(file)
-	maxCapacity := 100_000_000
-	buf := make([]byte, maxCapacity)
-	scanner.Buffer(buf, maxCapacity)
-
-	for scanner.Scan() {
-		parsed := gjson.ParseBytes(scanner.Bytes())
-
-		parsed.ForEach(func(key, value gjson.Result) bool {
-			k := key.String()
-			_, ok := typeCounts[k]
-			if !ok {
-				typeCounts[k] = map[string]int{}
-			}
-			switch value.Type {
-			case gjson.String:
-				typeCounts[k]["string"] += 1
-			case gjson.Null:
-				typeCounts[k]["null"] += 1
-			case gjson.False:
-				typeCounts[k]["bool"] += 1
-			case gjson.True:
-				typeCounts[k]["bool"] += 1
-			case gjson.Number:
-				_, intErr := strconv.Atoi(value.Raw)
-				if intErr != nil {
-					typeCounts[k]["float"] += 1
-				} else {
-					typeCounts[k]["int"] += 1
-				}
-			default:
-				typeCounts[k]["undefined"] += 1
-			}
-			return true
-		})
+func (s *ClickhouseServer) createColumnsWithTypes(table string, columns map[string]string) error {
+	sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" `, s.Database, table)
+	columnSql := []string{}
+	for colName, jsonType := range columns {
+		columnSql = append(columnSql, fmt.Sprintf(`ADD COLUMN IF NOT EXISTS "%s" %s`, colName, jsonToClickhouse(jsonType)))
 	}
 
-	log.Trace().Interface("column_type_counts", typeCounts).Send()
+	sql += strings.Join(columnSql, ", ")
 
-	if err := scanner.Err(); err != nil {
-		return rc, err
-	}
+	log.Trace().Msg(sql)
 
-	for colName, colTypeCounts := range typeCounts {
-		if colTypeCounts["string"] > 0 {
-			rc[colName] = "string"
-			continue
-		} else if colTypeCounts["undefined"] > 0 {
-			rc[colName] = "string"
-			continue
-		} else if colTypeCounts["float"] > 0 {
-			rc[colName] = "float"
-			continue
-		} else if colTypeCounts["int"] > 0 {
-			rc[colName] = "int"
-			continue
-		} else if colTypeCounts["bool"] > 0 {
-			rc[colName] = "bool"
-		} else {
-			rc[colName] = "string"
-		}
+	return s.conn.Exec(context.TODO(), sql)
+}
 
+// declaredToClickhouse maps a declared column type to a ClickHouse type
+func declaredToClickhouse(t models.ColumnType) string {
+	switch t.Kind {
+	case models.KindInt:
+		return "Int64"
+	case models.KindFloat:
+		return "Float64"
+	case models.KindBool:
+		return "Boolean"
+	case models.KindTimestamp:
+		return "DateTime64(6, 'UTC')"
+	case models.KindDate:
+		return "Date32"
+	case models.KindDecimal:
+		return fmt.Sprintf("Decimal(%d, %d)", t.Precision, t.Scale)
+	case models.KindUUID:
+		return "UUID"
+	case models.KindArray:
+		return "Array(" + declaredToClickhouse(*t.Element) + ")"
+	case models.KindLowCardinality:
+		return "LowCardinality(String)"
+	default:
+		// JSON is kept as text, since the JSON type is still experimental
+		return "String"
 	}
-
-	log.Trace().Interface("column_types", rc).Send()
-
-	return rc, nil
 }
 
-func (s *ClickhouseServer) createColumnsWithTypes(table string, columns map[string]string) error {
-	sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" `, s.Database, table)
-	columnSql := []string{}
-	for colName, jsonType := range columns {
-		var colType string
-		switch jsonType {
-		case "int":
-			colType = "Int64"
-		case "bool":
-			colType = "Boolean"
-		case "float":
-			colType = "Float64"
-		case "string":
-			colType = "String"
-		default:
-			colType = "String"
-		}
-		columnSql = append(columnSql, fmt.Sprintf(`ADD COLUMN IF NOT EXISTS "%s" %s`, colName, colType))
+func (s *ClickhouseServer) CreateDeclaredColumns(table string, columns []models.SchemaColumn) error {
+	if len(columns) == 0 {
+		return nil
 	}
 
-	sql += strings.Join(columnSql, ", ")
+	columnSql := make([]string, len(columns))
+	for i, column := range columns {
+		columnSql[i] = fmt.Sprintf(`ADD COLUMN IF NOT EXISTS "%s" %s`, column.Name, declaredToClickhouse(column.Type))
+	}
 
-	log.Trace().Msg(sql)
+	sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" `, s.Database, table) + strings.Join(columnSql, ", ")
+	return s.conn.Exec(context.TODO(), sql)
+}
 
+func (s *ClickhouseServer) WidenColumn(table string, column string, jsonType string) error {
+	sql := fmt.Sprintf(`ALTER TABLE "%s"."%s" MODIFY COLUMN "%s" %s`, s.Database, table, column, jsonToClickhouse(jsonType))
 	return s.conn.Exec(context.TODO(), sql)
 }
 
@@ -124,12 +99,11 @@ func (s *ClickhouseServer) getClickhouseTypes(table string) (map[string]string,
 	rc := map[string]string{}
 
 	sql := fmt.Sprintf("DESCRIBE TABLE \"%s\" FORMAT JSON", table)
-	resp, err := s.httpQuery(sql)
-	defer resp.Close()
-
+	resp, err := s.httpQuery(context.TODO(), sql, nil)
 	if err != nil {
 		return rc, err
 	}
+	defer resp.Close()
 
 	data, err := io.ReadAll(resp)
 	if err != nil {
@@ -145,12 +119,55 @@ func (s *ClickhouseServer) getClickhouseTypes(table string) (map[string]string,
 	return rc, nil
 }
 
+// splitClickhouseType splits a type such as Decimal(10, 2) into its name and arguments
+func splitClickhouseType(clickhouseType string) (string, string) {
+	name, args, ok := strings.Cut(clickhouseType, "(")
+	if !ok {
+		return clickhouseType, ""
+	}
+	return name, strings.TrimSuffix(args, ")")
+}
+
+// parseTimestamp reads timestamps written by util.CoerceNDJSONFile and other
+// common layouts. Missing values are the Unix epoch, ClickHouse's default.
+func parseTimestamp(data gjson.Result) time.Time {
+	if data.Type == gjson.Number {
+		return time.UnixMilli(data.Int()).UTC()
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano, "2006-01-02"} {
+		if ts, err := time.Parse(layout, data.String()); err == nil {
+			return ts.UTC()
+		}
+	}
+	return time.Unix(0, 0).UTC()
+}
+
 func (s *ClickhouseServer) jsonToGoType(clickhouseType string, data gjson.Result) any {
-	switch clickhouseType {
+	name, args := splitClickhouseType(clickhouseType)
+
+	switch name {
+	case "Nullable":
+		if data.Type == gjson.Null {
+			return nil
+		}
+		return s.jsonToGoType(args, data)
+	case "LowCardinality":
+		return s.jsonToGoType(args, data)
+	case "Array":
+		values := []any{}
+		for _, element := range data.Array() {
+			values = append(values, s.jsonToGoType(args, element))
+		}
+		return values
 	case "String", "FixedString":
 		return data.String()
-	case "Decimal":
-		return decimal.NewFromFloat(data.Float())
+	case "Decimal", "Decimal32", "Decimal64", "Decimal128", "Decimal256":
+		d, err := decimal.NewFromString(data.String())
+		if err != nil {
+			return decimal.NewFromFloat(data.Float())
+		}
+		return d
 	case "Bool":
 		return data.Bool()
 	case "UInt8":
@@ -182,14 +199,17 @@ func (s *ClickhouseServer) jsonToGoType(clickhouseType string, data gjson.Result
 	case "Float64":
 		return data.Float()
 	case "UUID":
+		if data.String() == "" {
+			return uuid.Nil.String()
+		}
 		return data.String()
 	case "Date", "Date32":
-		return data.String()
+		return parseTimestamp(data)
 	case "DateTime", "DateTime64":
 		if data.Type == gjson.Number {
 			return data.Int()
 		} else {
-			return data.String()
+			return parseTimestamp(data)
 		}
 	case "Enum8":
 		return int8(data.Int())
@@ -259,9 +279,13 @@ func (s *ClickhouseServer) insertData(file io.ReadSeeker, table string, columns
 			vals[i] = s.jsonToGoType(colType, gjson.GetBytes(data, colName))
 		}
 
+		// A row the batch cannot take fails the whole load, so that the
+		// worker can find and quarantine it
 		err = batch.Append(vals...)
 		if err != nil {
 			log.Error().Err(err).Int("row", row).Msg("Unable to add item to batch")
+			batch.Abort()
+			return fmt.Errorf("row %d: %w", row, err)
 		}
 		row++
 	}
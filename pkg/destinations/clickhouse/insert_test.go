@@ -0,0 +1,64 @@
+package clickhouse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+func TestGetClickhouseTypesError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Code: 60. DB::Exception: Table default.events does not exist", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ClickhouseServer{Host: u.Hostname(), HTTPProtocol: "http", HTTPPort: port, Database: "default"}
+	if _, err := s.getClickhouseTypes("events"); err == nil {
+		t.Error("Expected an error from a failed DESCRIBE")
+	}
+}
+
+func TestHTTPQueryReadOnly(t *testing.T) {
+	var readonly []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readonly = append(readonly, r.URL.Query().Get("readonly"))
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &ClickhouseServer{Host: u.Hostname(), HTTPProtocol: "http", HTTPPort: port, Database: "default"}
+	for _, ctx := range []context.Context{context.Background(), util.WithReadOnly(context.Background())} {
+		body, err := s.httpQuery(ctx, "SELECT 1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body.Close()
+	}
+
+	// readonly=2 still allows max_execution_time to be sent
+	if len(readonly) != 2 || readonly[0] != "" || readonly[1] != "2" {
+		t.Errorf("Expected readonly to be sent only for read-only requests, got %q", readonly)
+	}
+}
@@ -2,15 +2,26 @@ package clickhouse
 
 import (
 	"bufio"
-	"github.com/scratchdata/scratchdata/pkg/util"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	"github.com/scratchdata/scratchdata/pkg/util"
+	"github.com/tidwall/gjson"
 )
 
-func (s *ClickhouseServer) QueryJSON(query string, writer io.Writer) error {
+func (s *ClickhouseServer) QueryJSON(ctx context.Context, query string, writer io.Writer, queryParams url.Values) error {
 	sanitized := util.TrimQuery(query)
 	sql := "SELECT * FROM (" + sanitized + ") FORMAT " + "JSONEachRow"
 
-	resp, err := s.httpQuery(sql)
+	resp, err := s.httpQuery(ctx, sql, queryParams)
 	if err != nil {
 		return err
 	}
@@ -54,11 +65,16 @@ func (s *ClickhouseServer) QueryJSON(query string, writer io.Writer) error {
 	return nil
 }
 
-func (s *ClickhouseServer) QueryCSV(query string, writer io.Writer) error {
+func (s *ClickhouseServer) QueryCSV(ctx context.Context, query string, writer io.Writer, queryParams url.Values) error {
+	return s.queryFormat(ctx, query, "CSVWithNames", writer, queryParams)
+}
+
+// queryFormat streams the result of a query in one of ClickHouse's native output formats
+func (s *ClickhouseServer) queryFormat(ctx context.Context, query string, format string, writer io.Writer, queryParams url.Values) error {
 	sanitized := util.TrimQuery(query)
-	sql := "SELECT * FROM (" + sanitized + ") FORMAT " + "CSVWithNames"
+	sql := "SELECT * FROM (" + sanitized + ") FORMAT " + format
 
-	resp, err := s.httpQuery(sql)
+	resp, err := s.httpQuery(ctx, sql, queryParams)
 	if err != nil {
 		return err
 	}
@@ -68,3 +84,135 @@ func (s *ClickhouseServer) QueryCSV(query string, writer io.Writer) error {
 
 	return err
 }
+
+// queryJSONMeta writes the json_meta format using the column names and types
+// which ClickHouse sends ahead of the rows
+func (s *ClickhouseServer) queryJSONMeta(ctx context.Context, query string, writer io.Writer, queryParams url.Values) error {
+	start := time.Now()
+
+	sanitized := util.TrimQuery(query)
+	sql := "SELECT * FROM (" + sanitized + ") FORMAT JSONCompactEachRowWithNamesAndTypes"
+
+	resp, err := s.httpQuery(ctx, sql, queryParams)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	reader := bufio.NewReader(resp)
+
+	// The first line holds the column names and the second their types
+	var header [2][]gjson.Result
+	for i := range header {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		header[i] = gjson.ParseBytes(line).Array()
+	}
+
+	names, types := header[0], header[1]
+	if len(names) != len(types) {
+		return fmt.Errorf("clickhouse: got %d column names and %d types", len(names), len(types))
+	}
+
+	meta := make([]rowencoder.ColumnMeta, len(names))
+	keys := make([][]byte, len(names))
+	for i := range names {
+		meta[i] = rowencoder.ColumnMeta{Name: names[i].String(), Type: types[i].String()}
+		keys[i] = []byte(names[i].Raw)
+	}
+
+	if err := rowencoder.WriteJSONMetaHeader(writer, meta); err != nil {
+		return err
+	}
+
+	var rows int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			row := make([]byte, 0, len(line)+16*len(keys))
+			if rows > 0 {
+				row = append(row, ',')
+			}
+			row = append(row, '{')
+			for i, value := range gjson.ParseBytes(line).Array() {
+				if i >= len(keys) {
+					break
+				}
+				if i > 0 {
+					row = append(row, ',')
+				}
+				row = append(row, keys[i]...)
+				row = append(row, ':')
+				row = append(row, value.Raw...)
+			}
+			row = append(row, '}')
+
+			if _, err := writer.Write(row); err != nil {
+				return err
+			}
+			rows++
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return rowencoder.WriteJSONMetaFooter(writer, rows, start)
+}
+
+// bindParams rewrites {name} placeholders as ClickHouse query parameters, which
+// are sent alongside the query as param_<name> values
+func bindParams(query string, params models.Params) (string, url.Values, error) {
+	queryParams := url.Values{}
+	bound, err := util.BindParams(query, params, func(value models.Param) string {
+		name := fmt.Sprintf("p%d", len(queryParams))
+
+		var chType, text string
+		switch v := value.Value.(type) {
+		case int64:
+			chType, text = "Int64", strconv.FormatInt(v, 10)
+		case float64:
+			chType, text = "Float64", strconv.FormatFloat(v, 'g', -1, 64)
+		case time.Time:
+			chType, text = "DateTime64(6, 'UTC')", v.UTC().Format("2006-01-02 15:04:05.000000")
+		default:
+			// Values use the escaped format, like TabSeparated
+			chType, text = "String", paramEscaper.Replace(fmt.Sprint(v))
+		}
+
+		queryParams.Set("param_"+name, text)
+		return "{" + name + ":" + chType + "}"
+	})
+	return bound, queryParams, err
+}
+
+var paramEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`)
+
+func (s *ClickhouseServer) Query(ctx context.Context, query string, params models.Params, format models.Format, writer io.Writer) error {
+	query, queryParams, err := bindParams(query, params)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case models.FormatCSV:
+		return s.queryFormat(ctx, query, "CSVWithNames", writer, queryParams)
+	case models.FormatTSV:
+		return s.queryFormat(ctx, query, "TabSeparatedWithNames", writer, queryParams)
+	case models.FormatNDJSON:
+		return s.queryFormat(ctx, query, "JSONEachRow", writer, queryParams)
+	case models.FormatParquet:
+		return s.queryFormat(ctx, query, "Parquet", writer, queryParams)
+	case models.FormatArrow:
+		return s.queryFormat(ctx, query, "ArrowStream", writer, queryParams)
+	case models.FormatJSONMeta:
+		return s.queryJSONMeta(ctx, query, writer, queryParams)
+	default:
+		return s.QueryJSON(ctx, query, writer, queryParams)
+	}
+}
@@ -1,15 +1,130 @@
 package clickhouse
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"io"
 
 	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 )
 
 func (b *ClickhouseServer) Columns(table string) ([]models.Column, error) {
-	return []models.Column{}, errors.New("not implemented")
+	rc := []models.Column{}
+
+	rows, err := b.conn.Query(context.TODO(), `
+		SELECT name, type
+		FROM system.columns
+		WHERE database = ? AND table = ?
+		ORDER BY position`, b.Database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column models.Column
+		if err := rows.Scan(&column.Name, &column.Type); err != nil {
+			return nil, err
+		}
+		column.JSONType = util.JSONTypeForColumn(column.Type)
+		rc = append(rc, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rc) == 0 {
+		return nil, fmt.Errorf("table %q not found", table)
+	}
+	return rc, nil
+}
+
+// Tables lists the tables in the database. ClickHouse reports rows and bytes
+// for MergeTree tables, and leaves them null for views and other engines.
+func (b *ClickhouseServer) Tables() ([]models.Table, error) {
+	rc := []models.Table{}
+
+	rows, err := b.conn.Query(context.TODO(), `
+		SELECT name, total_rows, total_bytes
+		FROM system.tables
+		WHERE database = ? AND NOT is_temporary
+		ORDER BY name`, b.Database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var totalRows, totalBytes *uint64
+		if err := rows.Scan(&name, &totalRows, &totalBytes); err != nil {
+			return nil, err
+		}
+
+		table := models.Table{Name: name}
+		if totalRows != nil {
+			n := int64(*totalRows)
+			table.Rows = &n
+		}
+		if totalBytes != nil {
+			n := int64(*totalBytes)
+			table.Bytes = &n
+		}
+		rc = append(rc, table)
+	}
+
+	return rc, rows.Err()
 }
 
-func (b *ClickhouseServer) Tables() ([]string, error) {
-	return []string{}, errors.New("not implemented")
+func (b *ClickhouseServer) QualifiedTable(table string) (string, error) {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%s"."%s"`, b.Database, table), nil
+}
+
+func (b *ClickhouseServer) DropTable(table string) error {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return err
+	}
+	return b.conn.Exec(context.TODO(), fmt.Sprintf(`DROP TABLE "%s"."%s"`, b.Database, table))
+}
+
+func (b *ClickhouseServer) TruncateTable(table string) error {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return err
+	}
+	return b.conn.Exec(context.TODO(), fmt.Sprintf(`TRUNCATE TABLE "%s"."%s"`, b.Database, table))
+}
+
+func (b *ClickhouseServer) RenameTable(table string, newName string) error {
+	if err := util.CheckUnqualifiedTable(table, newName); err != nil {
+		return err
+	}
+	return b.conn.Exec(context.TODO(), fmt.Sprintf(`RENAME TABLE "%s"."%s" TO "%s"."%s"`, b.Database, table, b.Database, newName))
+}
+
+// DeleteRows uses a lightweight DELETE, which hides the rows immediately and
+// removes them from disk as parts are merged. ClickHouse does not report how
+// many rows were deleted.
+func (b *ClickhouseServer) DeleteRows(ctx context.Context, table string, filter string, params models.Params) (int64, error) {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return 0, err
+	}
+	filter, queryParams, err := bindParams(filter, params)
+	if err != nil {
+		return 0, err
+	}
+
+	sql := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE (%s)`, b.Database, table, filter)
+	resp, err := b.httpQuery(ctx, sql, queryParams)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Close()
+
+	_, err = io.Copy(io.Discard, resp)
+	return -1, err
 }
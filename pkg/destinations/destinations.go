@@ -24,19 +24,48 @@ type DestinationManager struct {
 }
 
 type Destination interface {
-	QueryJSON(query string, writer io.Writer) error
-	QueryCSV(query string, writer io.Writer) error
+	// Query streams the result of a query to writer. {name} placeholders are
+	// bound to params natively by the destination. The query is cancelled
+	// on the server if ctx is cancelled or its deadline passes.
+	Query(ctx context.Context, query string, params models.Params, format models.Format, writer io.Writer) error
 
-	Tables() ([]string, error)
+	Tables() ([]models.Table, error)
 	Columns(table string) ([]models.Column, error)
 
 	CreateEmptyTable(name string) error
 	CreateColumns(table string, filePath string) error
+	// CreateDeclaredColumns adds declared columns which do not exist yet.
+	// Existing columns keep their type.
+	CreateDeclaredColumns(table string, columns []models.SchemaColumn) error
+	// WidenColumn changes a column to the type for jsonType, converting the
+	// values already stored. It returns errors.ErrUnsupported if the
+	// destination cannot make the change.
+	WidenColumn(table string, column string, jsonType string) error
 	InsertFromNDJsonFile(table string, filePath string) error
 
+	// QualifiedTable returns table quoted and qualified as this destination's
+	// SQL refers to it, such as "db"."table" or `dataset.table`
+	QualifiedTable(table string) (string, error)
+
+	DropTable(table string) error
+	TruncateTable(table string) error
+	RenameTable(table string, newName string) error
+
+	// DeleteRows deletes the rows matching filter, a SQL expression with {name}
+	// placeholders bound to params. It returns the number of rows deleted, or
+	// -1 if the destination does not report it.
+	DeleteRows(ctx context.Context, table string, filter string, params models.Params) (int64, error)
+
 	Close() error
 }
 
+// PagingDestination is implemented by destinations which can page through
+// results natively. Pages are written as Parquet. An empty next token means
+// there are no more pages.
+type PagingDestination interface {
+	QueryPage(ctx context.Context, query string, params models.Params, limit int, token string, writer io.Writer) (next string, totalRows int64, err error)
+}
+
 func NewDestinationManager(storage *storage.Services) *DestinationManager {
 	mux := mapmutex.NewMapMutex()
 	rc := DestinationManager{
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/util"
 
 	"github.com/marcboeker/go-duckdb"
@@ -25,6 +26,9 @@ type DuckDBServer struct {
 
 	InMemory bool `mapstructure:"in_memory"`
 
+	// Skip rows whose __row_id already exists in the table when loading
+	DedupeRowID bool `mapstructure:"dedupe_row_id"`
+
 	MaxOpenConns        int `mapstructure:"max_open_conns"`
 	MaxIdleConns        int `mapstructure:"max_idle_conns"`
 	ConnMaxLifetimeSecs int `mapstructure:"conn_max_lifetime_secs"`
@@ -43,6 +47,32 @@ var jsonToDuck = map[string]string{
 	"bool":   "BOOLEAN",
 }
 
+// declaredToDuck maps a declared column type to a DuckDB type
+func declaredToDuck(t models.ColumnType) string {
+	switch t.Kind {
+	case models.KindInt:
+		return "BIGINT"
+	case models.KindFloat:
+		return "DOUBLE"
+	case models.KindBool:
+		return "BOOLEAN"
+	case models.KindTimestamp:
+		return "TIMESTAMP"
+	case models.KindDate:
+		return "DATE"
+	case models.KindDecimal:
+		return fmt.Sprintf("DECIMAL(%d, %d)", t.Precision, t.Scale)
+	case models.KindUUID:
+		return "UUID"
+	case models.KindJSON:
+		return "JSON"
+	case models.KindArray:
+		return declaredToDuck(*t.Element) + "[]"
+	default:
+		return "VARCHAR"
+	}
+}
+
 func openDB(s *DuckDBServer) (*sql.DB, error) {
 	var connectionString string
 
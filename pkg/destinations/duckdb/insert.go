@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
 )
 
 func (s *DuckDBServer) createColumns(table string, jsonTypes map[string]string) error {
@@ -25,6 +26,24 @@ func (s *DuckDBServer) createColumns(table string, jsonTypes map[string]string)
 	return nil
 }
 
+func (s *DuckDBServer) CreateDeclaredColumns(table string, columns []models.SchemaColumn) error {
+	for _, column := range columns {
+		sql := fmt.Sprintf("ALTER TABLE \"%s\" ADD COLUMN IF NOT EXISTS \"%s\" %s", table, column.Name, declaredToDuck(column.Type))
+		_, err := s.db.Exec(sql)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *DuckDBServer) WidenColumn(table string, column string, jsonType string) error {
+	sql := fmt.Sprintf("ALTER TABLE \"%s\" ALTER COLUMN \"%s\" TYPE %s", table, column, jsonToDuck[jsonType])
+	_, err := s.db.Exec(sql)
+	return err
+}
+
 func (s *DuckDBServer) describeTable(table string) ([]string, map[string]string, error) {
 	duckColumns := []string{}
 	duckdbColTypes := make(map[string]string)
@@ -54,14 +73,32 @@ func (s *DuckDBServer) describeTable(table string) ([]string, map[string]string,
 }
 
 func (s *DuckDBServer) insertFromLocal(table string, localPath string) error {
-	sql := fmt.Sprintf(`
-		INSERT INTO "%s" 
-		BY NAME
-		SELECT * FROM
-		read_ndjson_auto('%s')
-		`,
-		table, localPath,
-	)
+	var sql string
+	if s.DedupeRowID {
+		// Anti-join against rows already in the table, and keep only the
+		// first occurrence of each __row_id within the file
+		sql = fmt.Sprintf(`
+			INSERT INTO "%s"
+			BY NAME
+			SELECT * FROM (
+				SELECT DISTINCT ON (__row_id) * FROM read_ndjson_auto('%s')
+			) src
+			WHERE NOT EXISTS (
+				SELECT 1 FROM "%s" dst WHERE dst.__row_id = src.__row_id
+			)
+			`,
+			table, localPath, table,
+		)
+	} else {
+		sql = fmt.Sprintf(`
+			INSERT INTO "%s" 
+			BY NAME
+			SELECT * FROM
+			read_ndjson_auto('%s')
+			`,
+			table, localPath,
+		)
+	}
 
 	log.Trace().Str("sql", sql).Msg("Insert data SQL")
 
@@ -1,6 +1,9 @@
 package duckdb
 
 import (
+	"context"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
 	"github.com/scratchdata/scratchdata/pkg/util"
 	"io"
 	"os"
@@ -11,7 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func (s *DuckDBServer) QueryPipe(query string, format string, writer io.Writer) error {
+func (s *DuckDBServer) QueryPipe(ctx context.Context, query string, format models.Format, writer io.Writer, args ...any) error {
 	// This function is complicated. It does the following:
 	//
 	// 1. Creates a named pipe (mkfifo)
@@ -20,6 +23,9 @@ func (s *DuckDBServer) QueryPipe(query string, format string, writer io.Writer)
 	//
 	// It is complicated because it uses nonblocking IO to both look for data from the pipe
 	// and look for errors.
+	//
+	// If ctx is cancelled, DuckDB stops executing the query and we close our end of
+	// the pipe so that a COPY blocked on writing fails instead of waiting forever.
 
 	sanitized := util.TrimQuery(query)
 
@@ -48,8 +54,14 @@ func (s *DuckDBServer) QueryPipe(query string, format string, writer io.Writer)
 	// Writes result to our pipe
 	var formatClause string
 	switch format {
-	case "csv":
+	case models.FormatCSV:
 		formatClause = "(FORMAT CSV)"
+	case models.FormatTSV:
+		formatClause = "(FORMAT CSV, DELIMITER '\t')"
+	case models.FormatNDJSON:
+		formatClause = "(FORMAT JSON)"
+	case models.FormatParquet:
+		formatClause = "(FORMAT PARQUET)"
 	default:
 		formatClause = "(FORMAT JSON, ARRAY TRUE)"
 	}
@@ -59,9 +71,9 @@ func (s *DuckDBServer) QueryPipe(query string, format string, writer io.Writer)
 
 	// Execute the query in a new goroutine. This will block while waiting
 	// for someone to consume the pipe
-	errExecChan := make(chan error)
+	errExecChan := make(chan error, 1)
 	go func() {
-		_, err := s.db.Exec(sql)
+		_, err := s.db.ExecContext(ctx, sql, args...)
 		if err != nil {
 			log.Error().Err(err).Send()
 		}
@@ -83,7 +95,9 @@ func (s *DuckDBServer) QueryPipe(query string, format string, writer io.Writer)
 		if n > 0 {
 			// If we have data, write it to the http handler and
 			// keep checking for more data
-			writer.Write(buf[:n])
+			if _, err := writer.Write(buf[:n]); err != nil {
+				return err
+			}
 		} else {
 			// Otherwise, check and see if we have 0 data and the query is done
 			// executing. If so, then we assume we've consumed all data and can return
@@ -102,6 +116,8 @@ func (s *DuckDBServer) QueryPipe(query string, format string, writer io.Writer)
 					// readyToStop = true means "keep consuming data and stop checking for more if read returns 0 bytes"
 					readyToStop = true
 				}
+			case <-ctx.Done():
+				return ctx.Err()
 			default:
 				// Query has not finished executing. Wait for a little bit and check again.
 				time.Sleep(50 * time.Millisecond)
@@ -199,11 +215,56 @@ func (s *DuckDBServer) QueryJSONString(query string, writer io.Writer) error {
 	return nil
 }
 
-func (s *DuckDBServer) QueryJSON(query string, writer io.Writer) error {
-	return s.QueryPipe(query, "json", writer)
+func (s *DuckDBServer) QueryJSON(ctx context.Context, query string, writer io.Writer) error {
+	return s.QueryPipe(ctx, query, models.FormatJSON, writer)
 	// return s.QueryJSONString(query, writer)
 }
 
-func (s *DuckDBServer) QueryCSV(query string, writer io.Writer) error {
-	return s.QueryPipe(query, "csv", writer)
+func (s *DuckDBServer) QueryCSV(ctx context.Context, query string, writer io.Writer) error {
+	return s.QueryPipe(ctx, query, models.FormatCSV, writer)
+}
+
+func (s *DuckDBServer) Query(ctx context.Context, query string, params models.Params, format models.Format, writer io.Writer) error {
+	query, args, err := util.PositionalParams(query, params)
+	if err != nil {
+		return err
+	}
+
+	// COPY has no Arrow IPC writer. Write Parquet to a temp file instead,
+	// which keeps the column types, and convert it to an Arrow stream.
+	if format == models.FormatArrow {
+		dir, err := os.MkdirTemp("", "scratchdata_duckdb")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		parquetPath := filepath.Join(dir, "result.parquet")
+		_, err = s.db.ExecContext(ctx, "COPY ("+util.TrimQuery(query)+") TO '"+parquetPath+"' (FORMAT PARQUET)", args...)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(parquetPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return rowencoder.ParquetToArrow(ctx, f, writer)
+	}
+
+	// COPY cannot write column types either, so json_meta scans the rows
+	if format == models.FormatJSONMeta {
+		start := time.Now()
+		rows, err := s.db.QueryContext(ctx, util.TrimQuery(query), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		return rowencoder.WriteRows(rows, format, writer, start)
+	}
+
+	return s.QueryPipe(ctx, query, format, writer, args...)
 }
@@ -1,15 +1,117 @@
 package duckdb
 
 import (
-	"errors"
+	"context"
+	"fmt"
 
 	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 )
 
 func (b *DuckDBServer) Columns(table string) ([]models.Column, error) {
-	return []models.Column{}, errors.New("not implemented")
+	rc := []models.Column{}
+
+	rows, err := b.db.Query(`
+		SELECT column_name, data_type
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column models.Column
+		if err := rows.Scan(&column.Name, &column.Type); err != nil {
+			return nil, err
+		}
+		column.JSONType = util.JSONTypeForColumn(column.Type)
+		rc = append(rc, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rc) == 0 {
+		return nil, fmt.Errorf("table %q not found", table)
+	}
+	return rc, nil
+}
+
+// Tables lists the tables in the current schema. DuckDB does not report the
+// size of individual tables, and its row counts are estimates kept with the
+// table's storage, so they are read without scanning the table.
+func (b *DuckDBServer) Tables() ([]models.Table, error) {
+	rc := []models.Table{}
+
+	rows, err := b.db.Query(`
+		SELECT table_name, estimated_size
+		FROM duckdb_tables()
+		WHERE database_name = current_database() AND schema_name = current_schema() AND NOT temporary
+		ORDER BY table_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table models.Table
+		var count int64
+		if err := rows.Scan(&table.Name, &count); err != nil {
+			return nil, err
+		}
+		table.Rows = &count
+		rc = append(rc, table)
+	}
+
+	return rc, rows.Err()
 }
 
-func (b *DuckDBServer) Tables() ([]string, error) {
-	return []string{}, errors.New("not implemented")
+func (b *DuckDBServer) QualifiedTable(table string) (string, error) {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%s"`, table), nil
+}
+
+func (b *DuckDBServer) DropTable(table string) error {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return err
+	}
+	_, err := b.db.Exec(fmt.Sprintf(`DROP TABLE "%s"`, table))
+	return err
+}
+
+func (b *DuckDBServer) TruncateTable(table string) error {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return err
+	}
+	_, err := b.db.Exec(fmt.Sprintf(`TRUNCATE "%s"`, table))
+	return err
+}
+
+func (b *DuckDBServer) RenameTable(table string, newName string) error {
+	if err := util.CheckUnqualifiedTable(table, newName); err != nil {
+		return err
+	}
+	_, err := b.db.Exec(fmt.Sprintf(`ALTER TABLE "%s" RENAME TO "%s"`, table, newName))
+	return err
+}
+
+func (b *DuckDBServer) DeleteRows(ctx context.Context, table string, filter string, params models.Params) (int64, error) {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return 0, err
+	}
+	filter, args, err := util.PositionalParams(filter, params)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := b.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s" WHERE (%s)`, table, filter), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
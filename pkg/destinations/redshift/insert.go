@@ -1,6 +1,7 @@
 package redshift
 
 import (
+	"errors"
 	"fmt"
 	"github.com/scratchdata/scratchdata/pkg/util"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/storage/blobstore/s3"
 )
 
@@ -44,6 +46,49 @@ func (s *RedshiftServer) createColumns(table string, jsonTypes map[string]string
 
 	return nil
 }
+
+// declaredToRedshift maps a declared column type to a Redshift type
+func declaredToRedshift(t models.ColumnType) string {
+	switch t.Kind {
+	case models.KindInt:
+		return "BIGINT"
+	case models.KindFloat:
+		return "DOUBLE PRECISION"
+	case models.KindBool:
+		return "BOOLEAN"
+	case models.KindTimestamp:
+		return "TIMESTAMP"
+	case models.KindDate:
+		return "DATE"
+	case models.KindDecimal:
+		return fmt.Sprintf("DECIMAL(%d, %d)", t.Precision, t.Scale)
+	case models.KindUUID:
+		return "CHAR(36)"
+	case models.KindJSON, models.KindArray:
+		return "SUPER"
+	default:
+		return "VARCHAR(65535)"
+	}
+}
+
+func (s *RedshiftServer) CreateDeclaredColumns(table string, columns []models.SchemaColumn) error {
+	for _, column := range columns {
+		sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN \"%s\" %s", s.Schema+"."+table, column.Name, declaredToRedshift(column.Type))
+		_, err := s.conn.Exec(sql)
+		if err != nil && !strings.Contains(err.Error(), "already exists") {
+			log.Error().Err(err).Str("column", column.Name).Msg("CreateDeclaredColumns: cannot create column")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Redshift can only change the length of VARCHAR columns
+func (s *RedshiftServer) WidenColumn(table string, column string, jsonType string) error {
+	return errors.ErrUnsupported
+}
+
 func (s *RedshiftServer) CreateColumns(table string, fileName string) error {
 
 	input, err := os.Open(fileName)
@@ -120,7 +165,7 @@ func (s *RedshiftServer) InsertFromNDJsonFile(table string, filePath string) err
 		return err
 	}
 
-	copyCommand := fmt.Sprintf("COPY %s FROM 's3://%s/%s' CREDENTIALS 'aws_access_key_id=%s;aws_secret_access_key=%s' FORMAT AS JSON 'auto'", s.Schema+"."+table, s.S3Bucket, s3FilePath, s.S3AccessKeyId, s.S3SecretAccessKey)
+	copyCommand := fmt.Sprintf("COPY %s FROM 's3://%s/%s' CREDENTIALS 'aws_access_key_id=%s;aws_secret_access_key=%s' FORMAT AS JSON 'auto' TIMEFORMAT 'auto' DATEFORMAT 'auto'", s.Schema+"."+table, s.S3Bucket, s3FilePath, s.S3AccessKeyId, s.S3SecretAccessKey)
 
 	_, err = s.conn.Exec(copyCommand)
 	if err != nil {
@@ -1,16 +1,21 @@
 package redshift
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	"github.com/scratchdata/scratchdata/pkg/util"
 )
 
-func (s *RedshiftServer) QueryJSON(query string, writer io.Writer) error {
-	rows, err := s.conn.Query(query)
+func (s *RedshiftServer) QueryJSON(ctx context.Context, query string, writer io.Writer, args ...any) error {
+	rows, err := s.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to execute query")
 		return err
@@ -81,8 +86,8 @@ func (s *RedshiftServer) QueryJSON(query string, writer io.Writer) error {
 	return nil
 }
 
-func (s *RedshiftServer) QueryCSV(query string, writer io.Writer) error {
-	rows, err := s.conn.Query(query)
+func (s *RedshiftServer) QueryCSV(ctx context.Context, query string, writer io.Writer, args ...any) error {
+	rows, err := s.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to execute query")
 		return err
@@ -140,3 +145,28 @@ func (s *RedshiftServer) QueryCSV(query string, writer io.Writer) error {
 
 	return nil
 }
+
+// Query runs with ctx so that lib/pq sends a cancel request to the server if ctx ends early
+func (s *RedshiftServer) Query(ctx context.Context, query string, params models.Params, format models.Format, writer io.Writer) error {
+	query, args, err := util.PositionalParams(query, params)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case models.FormatJSON:
+		return s.QueryJSON(ctx, query, writer, args...)
+	case models.FormatCSV:
+		return s.QueryCSV(ctx, query, writer, args...)
+	}
+
+	start := time.Now()
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to execute query")
+		return err
+	}
+	defer rows.Close()
+
+	return rowencoder.WriteRows(rows, format, writer, start)
+}
@@ -1,15 +1,151 @@
 package redshift
 
 import (
-	"errors"
+	"context"
+	"fmt"
 
 	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
 )
 
 func (b *RedshiftServer) Columns(table string) ([]models.Column, error) {
-	return []models.Column{}, errors.New("not implemented")
+	rc := []models.Column{}
+
+	rows, err := b.conn.Query(`
+		SELECT column_name, data_type
+		FROM svv_columns
+		WHERE table_schema = $1 AND table_name = $2
+		ORDER BY ordinal_position`, b.Schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column models.Column
+		if err := rows.Scan(&column.Name, &column.Type); err != nil {
+			return nil, err
+		}
+		column.JSONType = util.JSONTypeForColumn(column.Type)
+		rc = append(rc, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rc) == 0 {
+		return nil, fmt.Errorf("table %q not found", table)
+	}
+	return rc, nil
 }
 
-func (b *RedshiftServer) Tables() ([]string, error) {
-	return []string{}, errors.New("not implemented")
+// Tables lists the tables in the schema. Sizes come from SVV_TABLE_INFO, which
+// only has rows for tables with data. It runs on the compute nodes, so it is
+// queried separately from the catalog rather than joined to it.
+func (b *RedshiftServer) Tables() ([]models.Table, error) {
+	rc := []models.Table{}
+
+	rows, err := b.conn.Query(`
+		SELECT table_name
+		FROM svv_tables
+		WHERE table_schema = $1 AND table_type = 'BASE TABLE'
+		ORDER BY table_name`, b.Schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var table models.Table
+		if err := rows.Scan(&table.Name); err != nil {
+			return nil, err
+		}
+		rc = append(rc, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// size is in 1 MB blocks
+	infoRows, err := b.conn.Query(`
+		SELECT "table", tbl_rows, size
+		FROM svv_table_info
+		WHERE schema = $1`, b.Schema)
+	if err != nil {
+		return nil, err
+	}
+	defer infoRows.Close()
+
+	type tableInfo struct{ rows, blocks int64 }
+	info := map[string]tableInfo{}
+	for infoRows.Next() {
+		var name string
+		var t tableInfo
+		if err := infoRows.Scan(&name, &t.rows, &t.blocks); err != nil {
+			return nil, err
+		}
+		info[name] = t
+	}
+
+	if err := infoRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, table := range rc {
+		t := info[table.Name]
+		bytes := t.blocks * 1024 * 1024
+		rc[i].Rows = &t.rows
+		rc[i].Bytes = &bytes
+	}
+
+	return rc, nil
+}
+
+func (b *RedshiftServer) QualifiedTable(table string) (string, error) {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%s."%s"`, b.Schema, table), nil
+}
+
+func (b *RedshiftServer) DropTable(table string) error {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return err
+	}
+	_, err := b.conn.Exec(fmt.Sprintf(`DROP TABLE %s."%s"`, b.Schema, table))
+	return err
+}
+
+func (b *RedshiftServer) TruncateTable(table string) error {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return err
+	}
+	_, err := b.conn.Exec(fmt.Sprintf(`TRUNCATE %s."%s"`, b.Schema, table))
+	return err
+}
+
+func (b *RedshiftServer) RenameTable(table string, newName string) error {
+	if err := util.CheckUnqualifiedTable(table, newName); err != nil {
+		return err
+	}
+	_, err := b.conn.Exec(fmt.Sprintf(`ALTER TABLE %s."%s" RENAME TO "%s"`, b.Schema, table, newName))
+	return err
+}
+
+func (b *RedshiftServer) DeleteRows(ctx context.Context, table string, filter string, params models.Params) (int64, error) {
+	if err := util.CheckUnqualifiedTable(table); err != nil {
+		return 0, err
+	}
+	filter, args, err := util.PositionalParams(filter, params)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := b.conn.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s."%s" WHERE (%s)`, b.Schema, table, filter), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
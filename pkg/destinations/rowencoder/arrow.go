@@ -0,0 +1,159 @@
+package rowencoder
+
+import (
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/decimal128"
+	"github.com/apache/arrow/go/v14/arrow/decimal256"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/shopspring/decimal"
+)
+
+// Rows are buffered and written as one record batch (or Parquet row group) at a time
+const arrowBatchRows = 10_000
+
+type recordWriter interface {
+	Write(arrow.Record) error
+	Close() error
+}
+
+type arrowEncoder struct {
+	columns []Column
+	builder *array.RecordBuilder
+	writer  recordWriter
+	rows    int
+}
+
+func arrowType(col Column) arrow.DataType {
+	switch col.Type {
+	case Int64:
+		return arrow.PrimitiveTypes.Int64
+	case Float64:
+		return arrow.PrimitiveTypes.Float64
+	case Bool:
+		return arrow.FixedWidthTypes.Boolean
+	case Timestamp:
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	case Decimal:
+		precision, scale := col.decimalSize()
+		if precision > 38 {
+			return &arrow.Decimal256Type{Precision: precision, Scale: scale}
+		}
+		return &arrow.Decimal128Type{Precision: precision, Scale: scale}
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// newRecordWriter writes records as a Parquet file or an Arrow IPC stream
+func newRecordWriter(format models.Format, w io.Writer, schema *arrow.Schema) (recordWriter, error) {
+	if format == models.FormatParquet {
+		props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+		// Hide any Close method so that closing the Parquet writer leaves w open
+		sink := struct{ io.Writer }{w}
+		return pqarrow.NewFileWriter(schema, sink, props, pqarrow.DefaultWriterProps())
+	}
+
+	return ipc.NewWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator)), nil
+}
+
+func newArrowEncoder(format models.Format, w io.Writer, columns []Column) (*arrowEncoder, error) {
+	fields := make([]arrow.Field, len(columns))
+	for i, col := range columns {
+		fields[i] = arrow.Field{Name: col.Name, Type: arrowType(col), Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	writer, err := newRecordWriter(format, w, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &arrowEncoder{
+		columns: columns,
+		builder: array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		writer:  writer,
+	}, nil
+}
+
+func (e *arrowEncoder) Write(values []any) error {
+	for i, col := range e.columns {
+		field := e.builder.Field(i)
+
+		value := Normalize(values[i], col.Type)
+		if value == nil {
+			field.AppendNull()
+			continue
+		}
+
+		switch b := field.(type) {
+		case *array.Int64Builder:
+			b.Append(value.(int64))
+		case *array.Float64Builder:
+			b.Append(value.(float64))
+		case *array.BooleanBuilder:
+			b.Append(value.(bool))
+		case *array.TimestampBuilder:
+			b.Append(arrow.Timestamp(value.(time.Time).UnixMicro()))
+		case *array.StringBuilder:
+			b.Append(value.(string))
+		case *array.Decimal128Builder, *array.Decimal256Builder:
+			unscaled, ok := unscaledDecimal(value.(decimal.Decimal), col)
+			if !ok {
+				// Too many digits for the column's precision
+				field.AppendNull()
+			} else if b128, ok := b.(*array.Decimal128Builder); ok {
+				b128.Append(decimal128.FromBigInt(unscaled))
+			} else {
+				b.(*array.Decimal256Builder).Append(decimal256.FromBigInt(unscaled))
+			}
+		}
+	}
+
+	e.rows++
+	if e.rows >= arrowBatchRows {
+		return e.flush()
+	}
+	return nil
+}
+
+// unscaledDecimal rounds d to the column's scale and returns it as an integer
+// count of 10^-scale, as Arrow stores it. ok is false if it has more digits
+// than the column's precision.
+func unscaledDecimal(d decimal.Decimal, col Column) (*big.Int, bool) {
+	precision, scale := col.decimalSize()
+	unscaled := d.Round(scale).Shift(scale).BigInt()
+
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	return unscaled, new(big.Int).Abs(unscaled).Cmp(limit) < 0
+}
+
+func (e *arrowEncoder) flush() error {
+	record := e.builder.NewRecord()
+	defer record.Release()
+
+	e.rows = 0
+	return e.writer.Write(record)
+}
+
+func (e *arrowEncoder) Close() error {
+	defer e.builder.Release()
+
+	if e.rows > 0 {
+		if err := e.flush(); err != nil {
+			e.writer.Close()
+			return err
+		}
+	}
+
+	return e.writer.Close()
+}
@@ -0,0 +1,288 @@
+package rowencoder
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/shopspring/decimal"
+)
+
+// ConvertParquet writes the contents of a Parquet file in the given format
+func ConvertParquet(ctx context.Context, r parquet.ReaderAtSeeker, format models.Format, w io.Writer) error {
+	switch format {
+	case models.FormatParquet:
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, io.NewSectionReader(r, 0, size))
+		return err
+	case models.FormatArrow:
+		return ParquetToArrow(ctx, r, w)
+	}
+
+	_, err := ConvertParquetPage(ctx, r, format, w, math.MaxInt64, "")
+	return err
+}
+
+// PageInfo describes the rows written by ConvertParquetPage
+type PageInfo struct {
+	Rows    int64
+	HasMore bool // The file had more rows than the limit
+
+	// The value of the key column in the last row written, or nil
+	LastKey any
+}
+
+// ConvertParquetPage writes at most limit rows of a Parquet file in the given format
+func ConvertParquetPage(ctx context.Context, r parquet.ReaderAtSeeker, format models.Format, w io.Writer, limit int64, keyColumn string) (PageInfo, error) {
+	var info PageInfo
+
+	records, err := readParquet(ctx, r)
+	if err != nil {
+		return info, err
+	}
+	defer records.Release()
+
+	schema := records.Schema()
+	columns := make([]Column, len(schema.Fields()))
+	for i, field := range schema.Fields() {
+		columns[i] = arrowColumn(field)
+	}
+
+	keyIndex := -1
+	if indices := schema.FieldIndices(keyColumn); len(indices) > 0 {
+		keyIndex = indices[0]
+	}
+
+	var writer recordWriter
+	if format == models.FormatParquet || format == models.FormatArrow {
+		writer, err = newRecordWriter(format, w, schema)
+	} else {
+		writer, err = newRowWriter(format, w, columns)
+	}
+	if err != nil {
+		return info, err
+	}
+
+	for records.Next() {
+		record := records.Record()
+
+		n := record.NumRows()
+		if info.Rows+n > limit {
+			info.HasMore = true
+			n = limit - info.Rows
+			if n == 0 {
+				break
+			}
+
+			record = record.NewSlice(0, n)
+			defer record.Release()
+		}
+
+		if err := writer.Write(record); err != nil {
+			writer.Close()
+			return info, err
+		}
+
+		info.Rows += n
+		if keyIndex >= 0 {
+			col := record.Column(keyIndex)
+			info.LastKey = Normalize(arrowValue(col, int(n-1), columns[keyIndex].Type), columns[keyIndex].Type)
+		}
+
+		if info.HasMore {
+			break
+		}
+	}
+
+	if err := records.Err(); err != nil && err != io.EOF {
+		writer.Close()
+		return info, err
+	}
+
+	return info, writer.Close()
+}
+
+// ParquetPageInfo returns what ConvertParquetPage would report for the same
+// limit. Only the key column is read, so that a page's cursor can be worked
+// out before its rows are written.
+func ParquetPageInfo(ctx context.Context, r parquet.ReaderAtSeeker, limit int64, keyColumn string) (PageInfo, error) {
+	var info PageInfo
+
+	parquetReader, err := file.NewParquetReader(r)
+	if err != nil {
+		return info, err
+	}
+
+	total := parquetReader.NumRows()
+	info.Rows = min(total, limit)
+	info.HasMore = total > limit
+
+	keyIndex := parquetReader.MetaData().Schema.ColumnIndexByName(keyColumn)
+	if keyColumn == "" || keyIndex < 0 || info.Rows == 0 {
+		return info, nil
+	}
+
+	props := pqarrow.ArrowReadProperties{BatchSize: arrowBatchRows}
+	fileReader, err := pqarrow.NewFileReader(parquetReader, props, memory.DefaultAllocator)
+	if err != nil {
+		return info, err
+	}
+	records, err := fileReader.GetRecordReader(ctx, []int{keyIndex}, nil)
+	if err != nil {
+		return info, err
+	}
+	defer records.Release()
+
+	keyType := arrowColumn(records.Schema().Field(0)).Type
+	seen := int64(0)
+	for records.Next() {
+		record := records.Record()
+		if n := record.NumRows(); seen+n < info.Rows {
+			seen += n
+			continue
+		}
+
+		info.LastKey = Normalize(arrowValue(record.Column(0), int(info.Rows-seen-1), keyType), keyType)
+		return info, nil
+	}
+
+	if err := records.Err(); err != nil && err != io.EOF {
+		return info, err
+	}
+	return info, nil
+}
+
+// rowWriter writes records one row at a time through an Encoder
+type rowWriter struct {
+	encoder Encoder
+	columns []Column
+	values  []any
+}
+
+func newRowWriter(format models.Format, w io.Writer, columns []Column) (*rowWriter, error) {
+	encoder, err := New(format, w, columns)
+	if err != nil {
+		return nil, err
+	}
+	return &rowWriter{encoder: encoder, columns: columns, values: make([]any, len(columns))}, nil
+}
+
+func (rw *rowWriter) Write(record arrow.Record) error {
+	for row := 0; row < int(record.NumRows()); row++ {
+		for i, col := range record.Columns() {
+			rw.values[i] = arrowValue(col, row, rw.columns[i].Type)
+		}
+
+		if err := rw.encoder.Write(rw.values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw *rowWriter) Close() error {
+	return rw.encoder.Close()
+}
+
+func arrowColumn(field arrow.Field) Column {
+	column := Column{Name: field.Name, Type: String, DatabaseType: field.Type.String()}
+
+	switch t := field.Type.(type) {
+	case arrow.DecimalType:
+		column.Type = Decimal
+		column.Precision, column.Scale = int(t.GetPrecision()), int(t.GetScale())
+		return column
+	}
+
+	switch field.Type.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32:
+		column.Type = Int64
+	case arrow.UINT64:
+		// Values above MaxInt64 are kept exact
+		column.Type = Decimal
+		column.Precision = 20
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		column.Type = Float64
+	case arrow.BOOL:
+		column.Type = Bool
+	case arrow.TIMESTAMP:
+		column.Type = Timestamp
+	}
+	return column
+}
+
+// arrowValue returns a value which Normalize can convert to the column type
+func arrowValue(arr arrow.Array, i int, t Type) any {
+	if arr.IsNull(i) {
+		return nil
+	}
+
+	switch a := arr.(type) {
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit)
+	case *array.String:
+		return a.Value(i)
+	case *array.LargeString:
+		return a.Value(i)
+	case *array.Decimal128:
+		scale := a.DataType().(*arrow.Decimal128Type).Scale
+		return decimal.NewFromBigInt(a.Value(i).BigInt(), -scale)
+	case *array.Decimal256:
+		scale := a.DataType().(*arrow.Decimal256Type).Scale
+		return decimal.NewFromBigInt(a.Value(i).BigInt(), -scale)
+	case *array.Uint64:
+		return new(big.Int).SetUint64(a.Value(i))
+	}
+
+	value := arr.GetOneForMarshal(i)
+	if t != String {
+		return value
+	}
+
+	// Dates, lists and structs are written as their JSON representation
+	b, err := json.Marshal(value)
+	if err != nil {
+		return arr.ValueStr(i)
+	}
+
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		return s
+	}
+	return string(b)
+}
+
+// readParquet reads a Parquet file as Arrow records. Closing the file is left to the caller.
+func readParquet(ctx context.Context, r parquet.ReaderAtSeeker) (pqarrow.RecordReader, error) {
+	parquetReader, err := file.NewParquetReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	props := pqarrow.ArrowReadProperties{BatchSize: arrowBatchRows}
+	fileReader, err := pqarrow.NewFileReader(parquetReader, props, memory.DefaultAllocator)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileReader.GetRecordReader(ctx, nil, nil)
+}
+
+// ParquetToArrow rewrites a Parquet file as an Arrow IPC stream, keeping its schema
+func ParquetToArrow(ctx context.Context, r parquet.ReaderAtSeeker, w io.Writer) error {
+	_, err := ConvertParquetPage(ctx, r, models.FormatArrow, w, math.MaxInt64, "")
+	return err
+}
@@ -0,0 +1,454 @@
+// Package rowencoder writes query results one row at a time in any of the
+// supported output formats. Destinations without a native way to produce a
+// format scan their rows and hand them to an Encoder.
+package rowencoder
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/marcboeker/go-duckdb"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/shopspring/decimal"
+)
+
+type Type int
+
+const (
+	String Type = iota
+	Int64
+	Float64
+	Bool
+	Timestamp
+	// Exact numbers, written as their digits in text formats and as
+	// decimal(Precision, Scale) in Parquet and Arrow
+	Decimal
+)
+
+// Decimals without a known precision and scale are written as decimal(38, 9)
+const (
+	defaultDecimalPrecision = 38
+	defaultDecimalScale     = 9
+	maxDecimalPrecision     = 76
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int64:
+		return "int64"
+	case Float64:
+		return "float64"
+	case Bool:
+		return "bool"
+	case Timestamp:
+		return "timestamp"
+	case Decimal:
+		return "decimal"
+	default:
+		return "string"
+	}
+}
+
+type Column struct {
+	Name string
+	Type Type
+
+	// The column's type in the database, reported by the json_meta format.
+	// Defaults to the name of Type.
+	DatabaseType string
+
+	// For Decimal columns. 0 means unknown.
+	Precision int
+	Scale     int
+}
+
+// decimalSize is the precision and scale of a Decimal column in Parquet and Arrow
+func (c Column) decimalSize() (int32, int32) {
+	if c.Precision <= 0 || c.Precision > maxDecimalPrecision || c.Scale < 0 || c.Scale > c.Precision {
+		return defaultDecimalPrecision, defaultDecimalScale
+	}
+	return int32(c.Precision), int32(c.Scale)
+}
+
+type Encoder interface {
+	// Write encodes a single row. There must be one value per column.
+	Write(values []any) error
+
+	// Close writes any buffered rows and trailing bytes. It does not close the underlying writer.
+	Close() error
+}
+
+func New(format models.Format, w io.Writer, columns []Column) (Encoder, error) {
+	return NewSince(format, w, columns, time.Now())
+}
+
+// NewSince is New for queries which started at start, which the json_meta
+// format reports as elapsed_ms
+func NewSince(format models.Format, w io.Writer, columns []Column, start time.Time) (Encoder, error) {
+	switch format {
+	case models.FormatJSON:
+		return &jsonEncoder{w: w, columns: columns, array: true}, nil
+	case models.FormatJSONMeta:
+		return newJSONMetaEncoder(w, columns, start)
+	case models.FormatNDJSON:
+		return &jsonEncoder{w: w, columns: columns}, nil
+	case models.FormatCSV:
+		return newDelimitedEncoder(w, columns, ',')
+	case models.FormatTSV:
+		return newDelimitedEncoder(w, columns, '\t')
+	case models.FormatParquet, models.FormatArrow:
+		return newArrowEncoder(format, w, columns)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+type jsonEncoder struct {
+	w       io.Writer
+	columns []Column
+	array   bool
+	rows    int
+}
+
+func (e *jsonEncoder) Write(values []any) error {
+	row := make([]byte, 0, 256)
+
+	if e.array {
+		if e.rows == 0 {
+			row = append(row, '[')
+		} else {
+			row = append(row, ',')
+		}
+	}
+
+	row = append(row, '{')
+	for i, col := range e.columns {
+		if i > 0 {
+			row = append(row, ',')
+		}
+
+		key, _ := json.Marshal(col.Name)
+		row = append(row, key...)
+		row = append(row, ':')
+
+		normalized := Normalize(values[i], col.Type)
+		if d, ok := normalized.(decimal.Decimal); ok {
+			// A JSON number with every digit, rather than a string or a float
+			row = append(row, d.String()...)
+			continue
+		}
+
+		value, err := json.Marshal(normalized)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(values[i]))
+		}
+		row = append(row, value...)
+	}
+	row = append(row, '}')
+
+	if !e.array {
+		row = append(row, '\n')
+	}
+
+	e.rows++
+	_, err := e.w.Write(row)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	if !e.array {
+		return nil
+	}
+
+	var err error
+	if e.rows == 0 {
+		_, err = e.w.Write([]byte("[]"))
+	} else {
+		_, err = e.w.Write([]byte("]"))
+	}
+	return err
+}
+
+// ColumnMeta describes a column in the json_meta format
+type ColumnMeta struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// WriteJSONMetaHeader starts a json_meta response, up to the opening of the data array
+func WriteJSONMetaHeader(w io.Writer, meta []ColumnMeta) error {
+	if err := writeJSONMetaStart(w, meta); err != nil {
+		return err
+	}
+	_, err := w.Write([]byte("["))
+	return err
+}
+
+// WriteJSONMetaFooter closes the data array and the json_meta response
+func WriteJSONMetaFooter(w io.Writer, rows int64, start time.Time) error {
+	if _, err := w.Write([]byte("]")); err != nil {
+		return err
+	}
+	return writeJSONMetaEnd(w, rows, start)
+}
+
+func writeJSONMetaStart(w io.Writer, meta []ColumnMeta) error {
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, `{"meta":%s,"data":`, encoded)
+	return err
+}
+
+func writeJSONMetaEnd(w io.Writer, rows int64, start time.Time) error {
+	_, err := fmt.Fprintf(w, `,"rows":%d,"elapsed_ms":%d}`, rows, time.Since(start).Milliseconds())
+	return err
+}
+
+// jsonMetaEncoder wraps the JSON array of rows with column names and types
+type jsonMetaEncoder struct {
+	jsonEncoder
+	start time.Time
+}
+
+func newJSONMetaEncoder(w io.Writer, columns []Column, start time.Time) (*jsonMetaEncoder, error) {
+	meta := make([]ColumnMeta, len(columns))
+	for i, col := range columns {
+		meta[i] = ColumnMeta{Name: col.Name, Type: col.DatabaseType}
+		if meta[i].Type == "" {
+			meta[i].Type = col.Type.String()
+		}
+	}
+
+	if err := writeJSONMetaStart(w, meta); err != nil {
+		return nil, err
+	}
+
+	return &jsonMetaEncoder{
+		jsonEncoder: jsonEncoder{w: w, columns: columns, array: true},
+		start:       start,
+	}, nil
+}
+
+func (e *jsonMetaEncoder) Close() error {
+	if err := e.jsonEncoder.Close(); err != nil {
+		return err
+	}
+	return writeJSONMetaEnd(e.w, int64(e.rows), e.start)
+}
+
+type delimitedEncoder struct {
+	w       *csv.Writer
+	columns []Column
+	record  []string
+}
+
+func newDelimitedEncoder(w io.Writer, columns []Column, delimiter rune) (*delimitedEncoder, error) {
+	e := &delimitedEncoder{
+		w:       csv.NewWriter(w),
+		columns: columns,
+		record:  make([]string, len(columns)),
+	}
+	e.w.Comma = delimiter
+
+	for i, col := range columns {
+		e.record[i] = col.Name
+	}
+
+	return e, e.w.Write(e.record)
+}
+
+func (e *delimitedEncoder) Write(values []any) error {
+	for i, col := range e.columns {
+		switch v := Normalize(values[i], col.Type).(type) {
+		case nil:
+			e.record[i] = ""
+		case string:
+			e.record[i] = v
+		case int64:
+			e.record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			e.record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			e.record[i] = strconv.FormatBool(v)
+		case time.Time:
+			e.record[i] = v.Format(time.RFC3339Nano)
+		case decimal.Decimal:
+			e.record[i] = v.String()
+		}
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *delimitedEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Normalize converts a value scanned from a database driver to the Go type
+// for the column: string, int64, float64, bool, time.Time or decimal.Decimal.
+// Values which cannot be converted become nil.
+func Normalize(value any, t Type) any {
+	if value == nil {
+		return nil
+	}
+
+	switch t {
+	case Int64:
+		if i, ok := toInt64(value); ok {
+			return i
+		}
+		return nil
+	case Float64:
+		if f, ok := toFloat64(value); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		return nil
+	case Bool:
+		switch v := value.(type) {
+		case bool:
+			return v
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b
+			}
+		case []byte:
+			if b, err := strconv.ParseBool(string(v)); err == nil {
+				return b
+			}
+		}
+		return nil
+	case Timestamp:
+		if ts, ok := value.(time.Time); ok {
+			return ts.UTC()
+		}
+		return nil
+	case Decimal:
+		if d, ok := toDecimal(value); ok {
+			return d
+		}
+		return nil
+	default:
+		return toString(value)
+	}
+}
+
+func toInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	case []byte:
+		i, err := strconv.ParseInt(string(v), 10, 64)
+		return i, err == nil
+	case interface {
+		IsInt64() bool
+		Int64() int64
+	}:
+		// *big.Int, used for DuckDB HUGEINT
+		return v.Int64(), v.IsInt64()
+	}
+	return 0, false
+}
+
+func toFloat64(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	case interface{ Float64() (float64, bool) }:
+		// *big.Rat, used for BigQuery NUMERIC
+		f, _ := v.Float64()
+		return f, true
+	}
+
+	if i, ok := toInt64(value); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+func toDecimal(value any) (decimal.Decimal, bool) {
+	switch v := value.(type) {
+	case decimal.Decimal:
+		return v, true
+	case string:
+		d, err := decimal.NewFromString(v)
+		return d, err == nil
+	case []byte:
+		d, err := decimal.NewFromString(string(v))
+		return d, err == nil
+	case *big.Rat:
+		// BigQuery NUMERIC and BIGNUMERIC, which have at most 38 decimal places
+		num := decimal.NewFromBigInt(v.Num(), 0)
+		return num.DivRound(decimal.NewFromBigInt(v.Denom(), 0), 38), true
+	case *big.Int:
+		return decimal.NewFromBigInt(v, 0), true
+	case duckdb.Decimal:
+		return decimal.NewFromBigInt(v.Value, -int32(v.Scale)), true
+	case float32:
+		return decimal.NewFromFloat32(v), !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+	case float64:
+		return decimal.NewFromFloat(v), !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+
+	if i, ok := toInt64(value); ok {
+		return decimal.NewFromInt(i), true
+	}
+	return decimal.Decimal{}, false
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return fmt.Sprint(v)
+	}
+
+	// Lists, maps and structs
+	if b, err := json.Marshal(value); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,192 @@
+package rowencoder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/tidwall/gjson"
+)
+
+var testColumns = []Column{
+	{Name: "id", Type: Int64},
+	{Name: "name", Type: String},
+	{Name: "score", Type: Float64},
+	{Name: "at", Type: Timestamp},
+}
+
+var testRows = [][]any{
+	{int32(1), "alice", []byte("1.5"), time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	{"2", nil, nil, nil},
+}
+
+func encode(t *testing.T, format models.Format) []byte {
+	var buf bytes.Buffer
+	encoder, err := New(format, &buf, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range testRows {
+		if err := encoder.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTextFormats(t *testing.T) {
+	expected := map[models.Format]string{
+		models.FormatJSON:   `[{"id":1,"name":"alice","score":1.5,"at":"2024-01-02T03:04:05Z"},{"id":2,"name":null,"score":null,"at":null}]`,
+		models.FormatNDJSON: "{\"id\":1,\"name\":\"alice\",\"score\":1.5,\"at\":\"2024-01-02T03:04:05Z\"}\n{\"id\":2,\"name\":null,\"score\":null,\"at\":null}\n",
+		models.FormatCSV:    "id,name,score,at\n1,alice,1.5,2024-01-02T03:04:05Z\n2,,,\n",
+		models.FormatTSV:    "id\tname\tscore\tat\n1\talice\t1.5\t2024-01-02T03:04:05Z\n2\t\t\t\n",
+	}
+
+	for format, want := range expected {
+		if got := string(encode(t, format)); got != want {
+			t.Errorf("%s: expected %q; got %q", format, want, got)
+		}
+	}
+}
+
+func TestArrowFormat(t *testing.T) {
+	reader, err := ipc.NewReader(bytes.NewReader(encode(t, models.FormatArrow)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+
+	if !reader.Next() {
+		t.Fatal("Expected a record batch")
+	}
+
+	record := reader.Record()
+	if record.NumRows() != 2 || record.NumCols() != 4 {
+		t.Fatalf("Expected 2 rows and 4 columns; got %d and %d", record.NumRows(), record.NumCols())
+	}
+	if !record.Column(1).IsNull(1) {
+		t.Fatal("Expected null name in second row")
+	}
+}
+
+func TestConvertParquet(t *testing.T) {
+	parquetFile := bytes.NewReader(encode(t, models.FormatParquet))
+
+	var buf bytes.Buffer
+	if err := ConvertParquet(context.Background(), parquetFile, models.FormatCSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "id,name,score,at\n1,alice,1.5,2024-01-02T03:04:05Z\n2,,,\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q; got %q", expected, buf.String())
+	}
+}
+
+func TestParquetPageInfo(t *testing.T) {
+	var buf bytes.Buffer
+	encoder, err := New(models.FormatParquet, &buf, []Column{{Name: "name", Type: String}, {Name: "id", Type: Int64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 25_000; i++ {
+		if err := encoder.Write([]any{"x", i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pages which end in a later batch report the same as converting them
+	for _, limit := range []int64{1, arrowBatchRows, arrowBatchRows + 1, 25_000, 30_000} {
+		expected, err := ConvertParquetPage(context.Background(), bytes.NewReader(buf.Bytes()), models.FormatCSV, io.Discard, limit, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParquetPageInfo(context.Background(), bytes.NewReader(buf.Bytes()), limit, "id")
+		if err != nil || got != expected {
+			t.Errorf("limit %d: expected %+v; got %+v, %v", limit, expected, got, err)
+		}
+	}
+}
+
+func TestJSONMetaFormat(t *testing.T) {
+	result := gjson.ParseBytes(encode(t, models.FormatJSONMeta))
+
+	if got := result.Get("meta.#.name").String(); got != `["id","name","score","at"]` {
+		t.Errorf("Unexpected column names %s", got)
+	}
+	if got := result.Get("meta.#.type").String(); got != `["int64","string","float64","timestamp"]` {
+		t.Errorf("Unexpected column types %s", got)
+	}
+	if got := result.Get("data").Raw; got != `[{"id":1,"name":"alice","score":1.5,"at":"2024-01-02T03:04:05Z"},{"id":2,"name":null,"score":null,"at":null}]` {
+		t.Errorf("Unexpected data %s", got)
+	}
+	if result.Get("rows").Int() != 2 || !result.Get("elapsed_ms").Exists() {
+		t.Errorf("Unexpected rows or elapsed_ms in %s", result.Raw)
+	}
+}
+
+func TestDecimalFormats(t *testing.T) {
+	columns := []Column{{Name: "amount", Type: Decimal, Precision: 38, Scale: 18}}
+	exact := "12345678901234567.123456789012345678"
+	rows := [][]any{
+		{big.NewRat(1, 10)},
+		{[]byte(exact)},
+		{nil},
+	}
+
+	write := func(format models.Format) []byte {
+		var buf bytes.Buffer
+		encoder, err := New(format, &buf, columns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range rows {
+			if err := encoder.Write(row); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// Text formats have every digit
+	if got, want := string(write(models.FormatCSV)), "amount\n0.1\n"+exact+"\n\n"; got != want {
+		t.Errorf("csv: expected %q; got %q", want, got)
+	}
+	if got, want := string(write(models.FormatJSON)), `[{"amount":0.1},{"amount":`+exact+`},{"amount":null}]`; got != want {
+		t.Errorf("json: expected %q; got %q", want, got)
+	}
+
+	// Binary formats have a decimal type, which converts back exactly
+	reader, err := ipc.NewReader(bytes.NewReader(write(models.FormatArrow)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+	if got := reader.Schema().Field(0).Type.String(); got != "decimal(38, 18)" {
+		t.Errorf("arrow: expected decimal(38, 18); got %s", got)
+	}
+
+	var buf bytes.Buffer
+	if err := ConvertParquet(context.Background(), bytes.NewReader(write(models.FormatParquet)), models.FormatCSV, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "amount\n0.1\n"+exact+"\n\n"; got != want {
+		t.Errorf("parquet: expected %q; got %q", want, got)
+	}
+}
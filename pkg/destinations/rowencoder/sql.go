@@ -0,0 +1,78 @@
+package rowencoder
+
+import (
+	"database/sql"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/scratchdata/scratchdata/models"
+)
+
+// sqlType maps a database column type name to an encoder type
+func sqlType(databaseType string) Type {
+	t := strings.ToUpper(databaseType)
+	switch {
+	case strings.HasSuffix(t, "]"), strings.HasPrefix(t, "STRUCT"), strings.HasPrefix(t, "MAP"):
+		// Nested values are written as JSON strings
+		return String
+	case strings.Contains(t, "BOOL"):
+		return Bool
+	case strings.HasPrefix(t, "INT") && !strings.HasPrefix(t, "INTERVAL"), strings.HasSuffix(t, "INT"), strings.Contains(t, "INTEGER"):
+		return Int64
+	case strings.Contains(t, "NUMERIC"), strings.Contains(t, "DECIMAL"):
+		return Decimal
+	case strings.Contains(t, "FLOAT"), strings.Contains(t, "DOUBLE"), strings.Contains(t, "REAL"):
+		return Float64
+	case strings.Contains(t, "TIMESTAMP"):
+		return Timestamp
+	default:
+		return String
+	}
+}
+
+// WriteRows encodes every row of a database/sql result set for a query which started at start
+func WriteRows(rows *sql.Rows, format models.Format, w io.Writer, start time.Time) error {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	columns := make([]Column, len(columnTypes))
+	for i, ct := range columnTypes {
+		columns[i] = Column{Name: ct.Name(), Type: sqlType(ct.DatabaseTypeName()), DatabaseType: ct.DatabaseTypeName()}
+		if precision, scale, ok := ct.DecimalSize(); ok {
+			columns[i].Precision, columns[i].Scale = int(precision), int(scale)
+		}
+	}
+
+	encoder, err := NewSince(format, w, columns, start)
+	if err != nil {
+		return err
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			encoder.Close()
+			return err
+		}
+
+		if err := encoder.Write(values); err != nil {
+			encoder.Close()
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		encoder.Close()
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -10,6 +10,10 @@ import (
 type Cache interface {
 	Get(key string) (value []byte, ok bool)
 	Set(key string, value []byte, expires *time.Duration) error
+	// Add sets a value only if the key is not already set, as one atomic
+	// step. It returns false if the key exists.
+	Add(key string, value []byte, expires *time.Duration) (bool, error)
+	Delete(key string) error
 }
 
 func NewCache(conf config.Cache) (Cache, error) {
@@ -29,9 +29,25 @@ func (c *Cache) Get(key string) ([]byte, bool) {
 // Set sets a value in the cache for the given key with an optional expiration time.
 func (c *Cache) Set(key string, value []byte, expires *time.Duration) error {
 	if expires != nil {
-		c.cache.Set(key, value, *expires*time.Second)
+		c.cache.Set(key, value, *expires)
 	} else {
 		c.cache.Set(key, value, cache.NoExpiration)
 	}
 	return nil
 }
+
+// Add sets a value only if the key is not already set. It returns false if the key exists.
+func (c *Cache) Add(key string, value []byte, expires *time.Duration) (bool, error) {
+	expiration := cache.NoExpiration
+	if expires != nil {
+		expiration = *expires
+	}
+	// go-cache only fails to add when the key exists
+	return c.cache.Add(key, value, expiration) == nil, nil
+}
+
+// Delete removes the given key from the cache. Missing keys are ignored.
+func (c *Cache) Delete(key string) error {
+	c.cache.Delete(key)
+	return nil
+}
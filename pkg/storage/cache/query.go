@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+// Each table has a generation which is part of the key of every cached query
+// that reads it. Changing the generation makes those results unreachable, and
+// they expire on their own.
+func tableGenerationKey(destinationID int64, table string) string {
+	return fmt.Sprintf("query_cache:generation:%d:%s", destinationID, strings.ToLower(table))
+}
+
+// InvalidateTable makes cached results for queries which read from table stale
+func InvalidateTable(c Cache, destinationID int64, table string) error {
+	generation := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return c.Set(tableGenerationKey(destinationID, table), []byte(generation), nil)
+}
+
+// QueryResultKey is the cache key for the result of a query in the given format
+func QueryResultKey(c Cache, destinationID int64, query string, params models.Params, format models.Format) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%s\n", destinationID, format, util.NormalizeQuery(query))
+
+	// Map keys are sorted, so equal params always encode the same way
+	encodedParams, _ := json.Marshal(params)
+	h.Write(encodedParams)
+
+	for _, table := range util.QueryTables(query) {
+		generation, _ := c.Get(tableGenerationKey(destinationID, table))
+		fmt.Fprintf(h, "\n%s=%s", table, generation)
+	}
+
+	return "query_cache:result:" + hex.EncodeToString(h.Sum(nil))
+}
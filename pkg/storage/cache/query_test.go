@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/storage/cache/memory"
+)
+
+func TestQueryResultKey(t *testing.T) {
+	c, _ := memory.NewCache(nil)
+
+	key := QueryResultKey(c, 1, "SELECT * FROM events", nil, models.FormatJSON)
+	if key != QueryResultKey(c, 1, " SELECT *\n FROM events; ", nil, models.FormatJSON) {
+		t.Fatal("Expected equivalent queries to have the same key")
+	}
+	if key == QueryResultKey(c, 1, "SELECT * FROM events", nil, models.FormatCSV) {
+		t.Fatal("Expected formats to have different keys")
+	}
+	if key == QueryResultKey(c, 2, "SELECT * FROM events", nil, models.FormatJSON) {
+		t.Fatal("Expected destinations to have different keys")
+	}
+	params := models.Params{"x": {Type: models.ParamInt, Value: int64(1)}}
+	if key == QueryResultKey(c, 1, "SELECT * FROM events", params, models.FormatJSON) {
+		t.Fatal("Expected params to change the key")
+	}
+
+	if err := InvalidateTable(c, 1, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if key != QueryResultKey(c, 1, "SELECT * FROM events", nil, models.FormatJSON) {
+		t.Fatal("Expected key to survive invalidating another table")
+	}
+
+	if err := InvalidateTable(c, 1, "Events"); err != nil {
+		t.Fatal(err)
+	}
+	if key == QueryResultKey(c, 1, "SELECT * FROM events", nil, models.FormatJSON) {
+		t.Fatal("Expected key to change when the table is invalidated")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	dataModels "github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/config"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/gorm"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
@@ -22,9 +23,34 @@ type Database interface {
 	AddAPIKey(ctx context.Context, destId int64, hashedAPIKey string) error
 	GetAPIKeyDetails(ctx context.Context, hashedAPIKey string) (models.APIKey, error)
 
-	CreateShareQuery(ctx context.Context, destId int64, query string, expires time.Duration) (queryId uuid.UUID, err error)
+	CreateShareQuery(ctx context.Context, destId int64, query string, params dataModels.Params, cacheTTL time.Duration, expires time.Duration) (queryId uuid.UUID, err error)
 	GetShareQuery(ctx context.Context, queryId uuid.UUID) (models.SharedQuery, bool)
 
+	CreateQueryJob(ctx context.Context, destId int64, query string, params dataModels.Params) (models.QueryJob, error)
+	GetQueryJob(ctx context.Context, jobId uuid.UUID) (models.QueryJob, bool)
+	// UpdateQueryJob saves the job only if its stored status is one of expected.
+	// It returns false if the status has changed, e.g. because the job was cancelled.
+	UpdateQueryJob(ctx context.Context, job *models.QueryJob, expected ...models.QueryJobStatus) (bool, error)
+
+	CreateCopyJob(ctx context.Context, job *models.CopyJob) error
+	GetCopyJob(ctx context.Context, jobId uuid.UUID) (models.CopyJob, bool)
+	// UpdateCopyJob saves the job only if its stored status is one of expected
+	UpdateCopyJob(ctx context.Context, job *models.CopyJob, expected ...models.QueryJobStatus) (bool, error)
+	AddCopyChunk(ctx context.Context, chunk *models.CopyChunk) error
+	// GetCopyChunks returns a copy job's chunks in order
+	GetCopyChunks(ctx context.Context, copyJobId uint) ([]models.CopyChunk, error)
+	MarkCopyChunkLoaded(ctx context.Context, chunkId uint) error
+	DeleteCopyChunks(ctx context.Context, copyJobId uint) error
+
+	// GetTableSchema returns the columns declared for a table, or none
+	GetTableSchema(ctx context.Context, destId int64, table string) ([]dataModels.SchemaColumn, error)
+	// SetTableSchema replaces the columns declared for a table
+	SetTableSchema(ctx context.Context, destId int64, table string, columns []dataModels.SchemaColumn) error
+
+	AddSchemaChange(ctx context.Context, change *models.SchemaChange) error
+	// GetSchemaChanges returns the changes made to a table's columns, oldest first
+	GetSchemaChanges(ctx context.Context, destId int64, table string) ([]models.SchemaChange, error)
+
 	GetUser(int64) *models.User
 	CreateUser(email string, source string, details string) (*models.User, error)
 
@@ -32,7 +58,43 @@ type Database interface {
 
 	Enqueue(messageType models.MessageType, message any) (*models.Message, error)
 	Dequeue(messageType models.MessageType, claimedBy string) (*models.Message, bool)
+	// Delete removes a message whatever its status, such as for an admin
 	Delete(id uint) error
+
+	// DeleteClaimed, Requeue and DeadLetter finish a worker's claim on a
+	// message. They do nothing and return false if the message is no longer
+	// claimed by claimedBy, as it was reclaimed and is another worker's now.
+
+	// DeleteClaimed removes a message which was processed
+	DeleteClaimed(id uint, claimedBy string) (bool, error)
+	// Requeue returns a failed message to the queue, to be claimed again at nextAttemptAt
+	Requeue(id uint, claimedBy string, lastError string, nextAttemptAt time.Time) (bool, error)
+	// DeadLetter stops retrying a message, keeping it with its last error
+	DeadLetter(id uint, claimedBy string, lastError string) (bool, error)
+	// Heartbeat renews a worker's claim on a message. It returns false if the
+	// message is no longer claimed by claimedBy.
+	Heartbeat(id uint, claimedBy string) (bool, error)
+	// ReclaimExpired returns messages claimed before claimedBefore to the queue,
+	// as their workers are presumed dead. It returns the number reclaimed.
+	ReclaimExpired(claimedBefore time.Time) (int64, error)
+
+	// PauseLoading stops InsertData and CopyData messages for a destination, or
+	// one of its tables if table is not empty, from being dequeued. Pausing
+	// again updates the reason.
+	PauseLoading(ctx context.Context, destId int64, table string, reason string) (models.Pause, error)
+	// ResumeLoading removes a pause, returning false if there was none
+	ResumeLoading(ctx context.Context, destId int64, table string) (bool, error)
+	GetPauses(ctx context.Context, destId int64) ([]models.Pause, error)
+
+	// ListMessages returns up to limit messages matching filter, oldest first
+	ListMessages(filter models.QueueFilter, limit int) ([]models.Message, error)
+	GetMessage(id uint) (models.Message, bool)
+	// RetryMessage returns a dead or stuck message to the queue with its attempts reset
+	RetryMessage(id uint) error
+	// PurgeMessages deletes the messages matching filter and returns how many there were
+	PurgeMessages(filter models.QueueFilter) (int64, error)
+	// QueueStats counts messages by destination, type and status
+	QueueStats() ([]models.QueueStats, error)
 }
 
 func NewConnection(conf config.Database, destinations []config.Destination, adminKeys []config.APIKey) (Database, error) {
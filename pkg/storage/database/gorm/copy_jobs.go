@@ -0,0 +1,60 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"gorm.io/gorm"
+)
+
+func (s *Gorm) CreateCopyJob(ctx context.Context, job *models.CopyJob) error {
+	job.UUID = uuid.New().String()
+	job.Status = models.JobQueued
+	return s.db.Create(job).Error
+}
+
+func (s *Gorm) GetCopyJob(ctx context.Context, jobId uuid.UUID) (models.CopyJob, bool) {
+	var job models.CopyJob
+	res := s.db.First(&job, "uuid = ?", jobId.String())
+	if res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			log.Error().Err(res.Error).Str("job_id", jobId.String()).Msg("Unable to find copy job")
+		}
+		return models.CopyJob{}, false
+	}
+
+	return job, true
+}
+
+func (s *Gorm) UpdateCopyJob(ctx context.Context, job *models.CopyJob, expected ...models.QueryJobStatus) (bool, error) {
+	res := s.db.Model(job).
+		Where("status IN ?", expected).
+		Select("*").
+		Omit("created_at").
+		Updates(job)
+
+	return res.RowsAffected == 1, res.Error
+}
+
+func (s *Gorm) AddCopyChunk(ctx context.Context, chunk *models.CopyChunk) error {
+	return s.db.Create(chunk).Error
+}
+
+func (s *Gorm) GetCopyChunks(ctx context.Context, copyJobId uint) ([]models.CopyChunk, error) {
+	var chunks []models.CopyChunk
+	res := s.db.Where("copy_job_id = ?", copyJobId).Order("number").Find(&chunks)
+	return chunks, res.Error
+}
+
+func (s *Gorm) MarkCopyChunkLoaded(ctx context.Context, chunkId uint) error {
+	return s.db.Model(&models.CopyChunk{}).Where("id = ?", chunkId).Update("loaded_at", time.Now()).Error
+}
+
+func (s *Gorm) DeleteCopyChunks(ctx context.Context, copyJobId uint) error {
+	// Deleted outright, as an export which starts again reuses the chunk numbers
+	return s.db.Unscoped().Where("copy_job_id = ?", copyJobId).Delete(&models.CopyChunk{}).Error
+}
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"time"
 
+	dataModels "github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/config"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
 	"github.com/scratchdata/scratchdata/pkg/util"
@@ -58,6 +59,12 @@ func NewGorm(
 		&models.Destination{},
 		&models.APIKey{},
 		&models.Message{},
+		&models.QueryJob{},
+		&models.TableSchema{},
+		&models.SchemaChange{},
+		&models.Pause{},
+		&models.CopyJob{},
+		&models.CopyChunk{},
 	)
 	if err != nil {
 		return nil, err
@@ -90,12 +97,14 @@ func (s *Gorm) VerifyAdminAPIKey(ctx context.Context, apiKey string) bool {
 	return false
 }
 
-func (s *Gorm) CreateShareQuery(ctx context.Context, destId int64, query string, expires time.Duration) (queryId uuid.UUID, err error) {
+func (s *Gorm) CreateShareQuery(ctx context.Context, destId int64, query string, params dataModels.Params, cacheTTL time.Duration, expires time.Duration) (queryId uuid.UUID, err error) {
 	id := uuid.New()
 	link := models.ShareLink{
 		UUID:          id.String(),
 		DestinationID: destId,
 		Query:         query,
+		Params:        params,
+		CacheTTL:      cacheTTL,
 		ExpiresAt:     time.Now().Add(expires),
 	}
 
@@ -121,6 +130,8 @@ func (s *Gorm) GetShareQuery(ctx context.Context, queryId uuid.UUID) (models.Sha
 	rc := models.SharedQuery{
 		ID:            link.UUID,
 		Query:         link.Query,
+		Params:        link.Params,
+		CacheTTL:      link.CacheTTL,
 		ExpiresAt:     link.ExpiresAt,
 		DestinationID: link.DestinationID,
 	}
@@ -0,0 +1,34 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"gorm.io/gorm"
+)
+
+func (s *Gorm) PauseLoading(ctx context.Context, destId int64, table string, reason string) (models.Pause, error) {
+	var pause models.Pause
+	res := s.db.First(&pause, "destination_id = ? AND destination_table = ?", destId, table)
+	if res.Error != nil && !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return pause, res.Error
+	}
+
+	pause.DestinationID = uint(destId)
+	pause.DestinationTable = table
+	pause.Reason = reason
+	return pause, s.db.Save(&pause).Error
+}
+
+func (s *Gorm) ResumeLoading(ctx context.Context, destId int64, table string) (bool, error) {
+	// Pauses are deleted outright so that the table can be paused again
+	res := s.db.Unscoped().Where("destination_id = ? AND destination_table = ?", destId, table).Delete(&models.Pause{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *Gorm) GetPauses(ctx context.Context, destId int64) ([]models.Pause, error) {
+	var pauses []models.Pause
+	res := s.db.Where("destination_id = ?", destId).Order("destination_table").Find(&pauses)
+	return pauses, res.Error
+}
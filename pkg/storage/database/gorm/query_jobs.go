@@ -0,0 +1,48 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"gorm.io/gorm"
+)
+
+func (s *Gorm) CreateQueryJob(ctx context.Context, destId int64, query string, params dataModels.Params) (models.QueryJob, error) {
+	job := models.QueryJob{
+		UUID:          uuid.New().String(),
+		DestinationID: destId,
+		Query:         query,
+		Params:        params,
+		Status:        models.JobQueued,
+	}
+
+	res := s.db.Create(&job)
+	return job, res.Error
+}
+
+func (s *Gorm) GetQueryJob(ctx context.Context, jobId uuid.UUID) (models.QueryJob, bool) {
+	var job models.QueryJob
+	res := s.db.First(&job, "uuid = ?", jobId.String())
+	if res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			log.Error().Err(res.Error).Str("job_id", jobId.String()).Msg("Unable to find query job")
+		}
+		return models.QueryJob{}, false
+	}
+
+	return job, true
+}
+
+func (s *Gorm) UpdateQueryJob(ctx context.Context, job *models.QueryJob, expected ...models.QueryJobStatus) (bool, error) {
+	res := s.db.Model(job).
+		Where("status IN ?", expected).
+		Select("*").
+		Omit("created_at").
+		Updates(job)
+
+	return res.RowsAffected == 1, res.Error
+}
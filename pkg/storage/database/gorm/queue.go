@@ -2,6 +2,7 @@ package gorm
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -21,6 +22,11 @@ func (db *Gorm) Enqueue(messageType models.MessageType, m any) (*models.Message,
 		Status:      models.New,
 		Message:     string(mStr),
 	}
+	if routed, ok := m.(models.TableMessage); ok {
+		destinationID, table := routed.MessageDestination()
+		message.DestinationID = uint(destinationID)
+		message.DestinationTable = table
+	}
 
 	res := db.db.Create(message)
 	return message, res.Error
@@ -32,9 +38,20 @@ func (db *Gorm) Dequeue(messageType models.MessageType, claimedBy string) (*mode
 	res := db.db.Transaction(func(tx *gorm.DB) error {
 
 		// This locking does not work with SQLite. Should use UPDATE .. WHERE status = new LIMIT 1 RESULT
-		findRes := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+		query := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
 			Where("status = ? AND message_type = ?", models.New, messageType).
-			First(&message)
+			Where("next_attempt_at IS NULL OR next_attempt_at <= ?", time.Now())
+
+		// Skipping paused messages in the query, rather than after claiming
+		// them, means they never hold up the messages behind them
+		if messageType == models.InsertData || messageType == models.CopyData {
+			paused := tx.Model(&models.Pause{}).Select("1").
+				Where("pauses.destination_id = messages.destination_id").
+				Where("pauses.destination_table = '' OR pauses.destination_table = messages.destination_table")
+			query = query.Where("NOT EXISTS (?)", paused)
+		}
+
+		findRes := query.First(&message)
 
 		if findRes.Error != nil {
 			return findRes.Error
@@ -43,6 +60,7 @@ func (db *Gorm) Dequeue(messageType models.MessageType, claimedBy string) (*mode
 		message.Status = models.Claimed
 		message.ClaimedAt = time.Now()
 		message.ClaimedBy = claimedBy
+		message.Attempts++
 
 		saveRes := tx.Save(&message)
 		if saveRes.Error != nil {
@@ -54,7 +72,9 @@ func (db *Gorm) Dequeue(messageType models.MessageType, claimedBy string) (*mode
 	})
 
 	if res != nil {
-		log.Error().Err(res).Any("message_type", messageType).Str("claimed_by", claimedBy).Msg("Unable to query for messages")
+		if !errors.Is(res, gorm.ErrRecordNotFound) {
+			log.Error().Err(res).Any("message_type", messageType).Str("claimed_by", claimedBy).Msg("Unable to query for messages")
+		}
 		return nil, false
 	}
 
@@ -66,3 +86,131 @@ func (db *Gorm) Delete(id uint) error {
 	res := db.db.Unscoped().Delete(&models.Message{}, id)
 	return res.Error
 }
+
+// claimedMessage selects a message if it is still claimed by claimedBy
+func (db *Gorm) claimedMessage(id uint, claimedBy string) *gorm.DB {
+	return db.db.Model(&models.Message{}).Where("id = ? AND status = ? AND claimed_by = ?", id, models.Claimed, claimedBy)
+}
+
+func (db *Gorm) DeleteClaimed(id uint, claimedBy string) (bool, error) {
+	res := db.claimedMessage(id, claimedBy).Unscoped().Delete(&models.Message{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (db *Gorm) Requeue(id uint, claimedBy string, lastError string, nextAttemptAt time.Time) (bool, error) {
+	res := db.claimedMessage(id, claimedBy).Updates(map[string]any{
+		"status":          models.New,
+		"claimed_by":      "",
+		"next_attempt_at": nextAttemptAt,
+		"last_error":      lastError,
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (db *Gorm) DeadLetter(id uint, claimedBy string, lastError string) (bool, error) {
+	res := db.claimedMessage(id, claimedBy).Updates(map[string]any{
+		"status":     models.Dead,
+		"last_error": lastError,
+	})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (db *Gorm) Heartbeat(id uint, claimedBy string) (bool, error) {
+	res := db.claimedMessage(id, claimedBy).Update("claimed_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+func (db *Gorm) ReclaimExpired(claimedBefore time.Time) (int64, error) {
+	res := db.db.Model(&models.Message{}).
+		Where("status = ? AND claimed_at < ?", models.Claimed, claimedBefore).
+		Updates(map[string]any{
+			"status":     models.New,
+			"claimed_by": "",
+		})
+	return res.RowsAffected, res.Error
+}
+
+// queueFilter adds the conditions of filter to tx
+func queueFilter(tx *gorm.DB, filter models.QueueFilter) *gorm.DB {
+	if filter.Status != "" {
+		tx = tx.Where("status = ?", filter.Status)
+	}
+	if filter.MessageType != "" {
+		tx = tx.Where("message_type = ?", filter.MessageType)
+	}
+	if filter.DestinationID != nil {
+		tx = tx.Where("destination_id = ?", *filter.DestinationID)
+	}
+	if filter.Table != "" {
+		tx = tx.Where("destination_table = ?", filter.Table)
+	}
+	return tx
+}
+
+func (db *Gorm) ListMessages(filter models.QueueFilter, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	res := queueFilter(db.db, filter).Order("id").Limit(limit).Find(&messages)
+	return messages, res.Error
+}
+
+func (db *Gorm) GetMessage(id uint) (models.Message, bool) {
+	var message models.Message
+	res := db.db.First(&message, id)
+	if res.Error != nil {
+		if !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			log.Error().Err(res.Error).Uint("id", id).Msg("Unable to get message")
+		}
+		return message, false
+	}
+	return message, true
+}
+
+func (db *Gorm) RetryMessage(id uint) error {
+	res := db.db.Model(&models.Message{}).Where("id = ?", id).Updates(map[string]any{
+		"status":          models.New,
+		"claimed_by":      "",
+		"attempts":        0,
+		"next_attempt_at": nil,
+	})
+	return res.Error
+}
+
+func (db *Gorm) PurgeMessages(filter models.QueueFilter) (int64, error) {
+	res := queueFilter(db.db.Unscoped(), filter).Where("1 = 1").Delete(&models.Message{})
+	return res.RowsAffected, res.Error
+}
+
+func (db *Gorm) QueueStats() ([]models.QueueStats, error) {
+	var rows []struct {
+		DestinationID uint
+		MessageType   models.MessageType
+		Status        models.MessageStatus
+		Messages      int64
+		OldestID      uint
+	}
+	res := db.db.Model(&models.Message{}).
+		Select("destination_id, message_type, status, COUNT(*) AS messages, MIN(id) AS oldest_id").
+		Group("destination_id, message_type, status").
+		Order("destination_id, message_type, status").
+		Scan(&rows)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	// IDs increase with time, so the oldest message has the lowest ID. Its
+	// creation time is looked up rather than aggregated, since SQLite returns
+	// MIN(created_at) as text.
+	stats := make([]models.QueueStats, len(rows))
+	for i, row := range rows {
+		stats[i] = models.QueueStats{
+			DestinationID: row.DestinationID,
+			MessageType:   row.MessageType,
+			Status:        row.Status,
+			Messages:      row.Messages,
+		}
+		if oldest, ok := db.GetMessage(row.OldestID); ok {
+			stats[i].OldestAt = oldest.CreatedAt
+		}
+	}
+	return stats, nil
+}
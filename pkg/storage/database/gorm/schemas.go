@@ -0,0 +1,42 @@
+package gorm
+
+import (
+	"context"
+	"errors"
+
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"gorm.io/gorm"
+)
+
+func (s *Gorm) GetTableSchema(ctx context.Context, destId int64, table string) ([]dataModels.SchemaColumn, error) {
+	var schema models.TableSchema
+	res := s.db.First(&schema, "destination_id = ? AND name = ?", destId, table)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return schema.Columns, res.Error
+}
+
+func (s *Gorm) SetTableSchema(ctx context.Context, destId int64, table string, columns []dataModels.SchemaColumn) error {
+	var schema models.TableSchema
+	res := s.db.First(&schema, "destination_id = ? AND name = ?", destId, table)
+	if res.Error != nil && !errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return res.Error
+	}
+
+	schema.DestinationID = destId
+	schema.Name = table
+	schema.Columns = columns
+	return s.db.Save(&schema).Error
+}
+
+func (s *Gorm) AddSchemaChange(ctx context.Context, change *models.SchemaChange) error {
+	return s.db.Create(change).Error
+}
+
+func (s *Gorm) GetSchemaChanges(ctx context.Context, destId int64, table string) ([]models.SchemaChange, error) {
+	var changes []models.SchemaChange
+	res := s.db.Where(&models.SchemaChange{DestinationID: destId, Table: table}).Order("id").Find(&changes)
+	return changes, res.Error
+}
@@ -3,13 +3,16 @@ package models
 import (
 	"time"
 
+	dataModels "github.com/scratchdata/scratchdata/models"
 	"gorm.io/gorm"
 )
 
 type SharedQuery struct {
 	ID            string
 	Query         string
+	Params        dataModels.Params
 	DestinationID int64
+	CacheTTL      time.Duration
 	ExpiresAt     time.Time
 }
 
@@ -18,6 +21,8 @@ type ShareLink struct {
 	UUID          string `gorm:"index:idx_uuid,unique"`
 	DestinationID int64
 	Query         string
+	Params        dataModels.Params `gorm:"serializer:json"`
+	CacheTTL      time.Duration
 	ExpiresAt     time.Time
 }
 
@@ -52,18 +57,56 @@ type APIKey struct {
 	DestinationID uint
 	Destination   Destination
 	HashedAPIKey  string `gorm:"index"`
+
+	// Queries made with this key are cancelled after this many seconds. 0 uses the global limit.
+	MaxExecutionSeconds int
+}
+
+// TableSchema holds the column types declared for a table. Inserts convert
+// values to these types, and undeclared columns have their types inferred.
+type TableSchema struct {
+	gorm.Model
+	DestinationID int64                     `gorm:"index:idx_table_schema,unique"`
+	Name          string                    `gorm:"index:idx_table_schema,unique"`
+	Columns       []dataModels.SchemaColumn `gorm:"serializer:json"`
+}
+
+type SchemaChangeAction string
+
+const SchemaAddColumn SchemaChangeAction = "add_column"
+const SchemaWidenColumn SchemaChangeAction = "widen"
+const SchemaSidecarColumn SchemaChangeAction = "sidecar"
+const SchemaRejected SchemaChangeAction = "reject"
+
+// SchemaChange records a change made to a table's columns while loading data,
+// or a load which was rejected because it needed one
+type SchemaChange struct {
+	gorm.Model
+	DestinationID int64  `gorm:"index:idx_schema_change"`
+	Table         string `gorm:"index:idx_schema_change"`
+	Column        string
+	Action        SchemaChangeAction
+	OldType       string
+	NewType       string
+
+	// For sidecar columns, the column whose values did not fit
+	SourceColumn string
 }
 
 type MessageType string
 
 const InsertData MessageType = "INSERT_DATA"
 const CopyData MessageType = "COPY_DATA"
+const RunQuery MessageType = "RUN_QUERY"
 
 type MessageStatus string
 
 const New MessageStatus = "NEW"
 const Claimed MessageStatus = "CLAIMED"
 
+// Dead messages failed too many times and are no longer retried
+const Dead MessageStatus = "DEAD"
+
 type Message struct {
 	gorm.Model
 	MessageType MessageType   `gorm:"index"`
@@ -72,7 +115,124 @@ type Message struct {
 	ClaimedBy   string
 	Message     string
 
-	// For future pause/unpause
+	// Where the message's data is loaded, so that loading can be paused
 	DestinationID    uint   `gorm:"index"`
 	DestinationTable string `gorm:"index"`
+
+	// Attempts counts the times the message has been claimed. A message which
+	// failed is not claimed again before NextAttemptAt.
+	Attempts      int
+	NextAttemptAt *time.Time `gorm:"index"`
+	LastError     string
+}
+
+// Pause stops workers loading data into a destination, or into one of its
+// tables when DestinationTable is set. Data is still accepted and queued, and
+// is loaded once the pause is removed.
+type Pause struct {
+	gorm.Model
+	DestinationID    uint   `gorm:"uniqueIndex:idx_pause"`
+	DestinationTable string `gorm:"uniqueIndex:idx_pause"`
+	Reason           string
+}
+
+// TableMessage is implemented by message payloads which belong to a
+// destination, and possibly one of its tables. Enqueue records both so that
+// messages can be found by them.
+type TableMessage interface {
+	MessageDestination() (destinationID int64, table string)
+}
+
+// QueueFilter selects queued messages. Empty fields match every message.
+type QueueFilter struct {
+	Status        MessageStatus
+	MessageType   MessageType
+	DestinationID *uint
+	Table         string
+}
+
+// Empty is true if the filter matches every message
+func (f QueueFilter) Empty() bool {
+	return f.Status == "" && f.MessageType == "" && f.DestinationID == nil && f.Table == ""
+}
+
+// QueueStats counts the messages of one type and status for a destination
+type QueueStats struct {
+	DestinationID uint
+	MessageType   MessageType
+	Status        MessageStatus
+	Messages      int64
+
+	// When the oldest of these messages was enqueued
+	OldestAt time.Time
+}
+
+type QueryJobStatus string
+
+const JobQueued QueryJobStatus = "QUEUED"
+const JobRunning QueryJobStatus = "RUNNING"
+const JobSucceeded QueryJobStatus = "SUCCEEDED"
+const JobFailed QueryJobStatus = "FAILED"
+const JobCancelled QueryJobStatus = "CANCELLED"
+
+// QueryJob is a query run asynchronously by a worker. The result is
+// stored in the blob store as a Parquet file.
+type QueryJob struct {
+	gorm.Model
+	UUID          string `gorm:"index:idx_query_job_uuid,unique"`
+	DestinationID int64  `gorm:"index"`
+	Query         string
+	Params        dataModels.Params `gorm:"serializer:json"`
+	Status        QueryJobStatus    `gorm:"index"`
+	ResultKey     string
+	Rows          int64
+	Bytes         int64
+	Error         string
+	StartedAt     *time.Time
+	FinishedAt    *time.Time
+}
+
+// Finished is true once the job can no longer change
+func (j QueryJob) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// CopyJob copies a table, or the result of a query, from one destination to
+// another. The source is exported to NDJSON chunks in the blob store, which
+// are then loaded into the target one at a time. It uses the same statuses as
+// QueryJob.
+type CopyJob struct {
+	gorm.Model
+	UUID     string `gorm:"index:idx_copy_job_uuid,unique"`
+	SourceID int64  `gorm:"index"`
+	TargetID int64  `gorm:"index"`
+	Query    string
+	Params   dataModels.Params `gorm:"serializer:json"`
+	Table    string
+	Status   QueryJobStatus `gorm:"index"`
+
+	// Exported is set once every chunk is in the blob store. Until then, an
+	// interrupted job starts its export again.
+	Exported   bool
+	Rows       int64
+	LoadedRows int64
+
+	Error      string
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+func (j CopyJob) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// CopyChunk is one NDJSON file of a copy job's rows. LoadedAt is set once it
+// has been loaded into the target, so that a retried job skips it.
+type CopyChunk struct {
+	gorm.Model
+	CopyJobID uint `gorm:"index:idx_copy_chunk,unique"`
+	Number    int  `gorm:"index:idx_copy_chunk,unique"`
+	Key       string
+	Rows      int64
+	LoadedAt  *time.Time
 }
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	queueModels "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+)
+
+// testDatabases returns a static database and a gorm database backed by sqlite
+func testDatabases(t *testing.T) map[string]Database {
+	static, err := NewConnection(config.Database{Type: "static"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqlite, err := NewConnection(config.Database{Type: "sqlite", Settings: map[string]any{
+		"dsn":          filepath.Join(t.TempDir(), "test.db"),
+		"default_user": "test@example.com",
+	}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]Database{"static": static, "sqlite": sqlite}
+}
+
+func enqueueInsert(t *testing.T, db Database, destinationID int64, table string) {
+	message := queueModels.FileUploadMessage{DatabaseID: destinationID, Table: table, Key: table}
+	if _, err := db.Enqueue(models.InsertData, message); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dequeueInserts claims every insert message which is not paused and returns
+// their destination and table
+func dequeueInserts(t *testing.T, db Database) []string {
+	claimed := []string{}
+	for {
+		message, ok := db.Dequeue(models.InsertData, "test")
+		if !ok {
+			return claimed
+		}
+
+		var upload queueModels.FileUploadMessage
+		if err := json.Unmarshal([]byte(message.Message), &upload); err != nil {
+			t.Fatal(err)
+		}
+		claimed = append(claimed, fmt.Sprintf("%s@%d", upload.Table, upload.DatabaseID))
+	}
+}
+
+func assertClaimed(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v to be claimed, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected %v to be claimed, got %v", expected, got)
+		}
+	}
+}
+
+func TestPauseDestination(t *testing.T) {
+	ctx := context.Background()
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			enqueueInsert(t, db, 1, "events")
+			enqueueInsert(t, db, 1, "users")
+			enqueueInsert(t, db, 2, "events")
+
+			if _, err := db.PauseLoading(ctx, 1, "", "migrating"); err != nil {
+				t.Fatal(err)
+			}
+
+			// The paused destination's messages are older, but do not hold up destination 2
+			assertClaimed(t, dequeueInserts(t, db), "events@2")
+
+			resumed, err := db.ResumeLoading(ctx, 1, "")
+			if err != nil || !resumed {
+				t.Fatalf("Expected the destination to resume, got %v, %v", resumed, err)
+			}
+			assertClaimed(t, dequeueInserts(t, db), "events@1", "users@1")
+		})
+	}
+}
+
+func TestPauseTable(t *testing.T) {
+	ctx := context.Background()
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			enqueueInsert(t, db, 1, "events")
+			enqueueInsert(t, db, 1, "users")
+			enqueueInsert(t, db, 2, "events")
+
+			if _, err := db.PauseLoading(ctx, 1, "events", ""); err != nil {
+				t.Fatal(err)
+			}
+
+			pauses, err := db.GetPauses(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pauses) != 1 || pauses[0].DestinationTable != "events" {
+				t.Errorf("Expected the events table to be paused, got %+v", pauses)
+			}
+
+			// Only events in destination 1 is paused
+			assertClaimed(t, dequeueInserts(t, db), "users@1", "events@2")
+
+			resumed, err := db.ResumeLoading(ctx, 1, "events")
+			if err != nil || !resumed {
+				t.Fatalf("Expected the table to resume, got %v, %v", resumed, err)
+			}
+			assertClaimed(t, dequeueInserts(t, db), "events@1")
+
+			resumed, err = db.ResumeLoading(ctx, 1, "events")
+			if err != nil || resumed {
+				t.Errorf("Expected a second resume to find no pause, got %v, %v", resumed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+// claimInsert enqueues an insert and claims it as worker
+func claimInsert(t *testing.T, db Database, worker string) *models.Message {
+	enqueueInsert(t, db, 1, "events")
+	message, ok := db.Dequeue(models.InsertData, worker)
+	if !ok {
+		t.Fatal("Expected a message to be claimed")
+	}
+	return message
+}
+
+func assertStatus(t *testing.T, db Database, id uint, expected models.MessageStatus) models.Message {
+	t.Helper()
+	message, ok := db.GetMessage(id)
+	if !ok {
+		t.Fatalf("Expected message %d to exist", id)
+	}
+	if message.Status != expected {
+		t.Errorf("Expected message %d to be %s, got %s", id, expected, message.Status)
+	}
+	return message
+}
+
+func TestClaimLost(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			message := claimInsert(t, db, "a")
+
+			// a stops heartbeating, and b claims the message after it is reclaimed
+			if _, err := db.ReclaimExpired(time.Now().Add(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := db.Dequeue(models.InsertData, "b"); !ok {
+				t.Fatal("Expected the reclaimed message to be claimed again")
+			}
+
+			if ok, err := db.DeleteClaimed(message.ID, "a"); ok || err != nil {
+				t.Errorf("Expected a's delete to do nothing, got %v, %v", ok, err)
+			}
+			if ok, err := db.Requeue(message.ID, "a", "failed", time.Now()); ok || err != nil {
+				t.Errorf("Expected a's requeue to do nothing, got %v, %v", ok, err)
+			}
+			if ok, err := db.DeadLetter(message.ID, "a", "failed"); ok || err != nil {
+				t.Errorf("Expected a's dead-letter to do nothing, got %v, %v", ok, err)
+			}
+			claimed := assertStatus(t, db, message.ID, models.Claimed)
+			if claimed.ClaimedBy != "b" || claimed.LastError != "" {
+				t.Errorf("Expected the message to still be b's, got %+v", claimed)
+			}
+
+			if ok, err := db.DeleteClaimed(message.ID, "b"); !ok || err != nil {
+				t.Fatalf("Expected b's delete to succeed, got %v, %v", ok, err)
+			}
+			if _, ok := db.GetMessage(message.ID); ok {
+				t.Error("Expected the message to be deleted")
+			}
+		})
+	}
+}
+
+func TestRequeue(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			later := claimInsert(t, db, "a")
+			now := claimInsert(t, db, "a")
+
+			if ok, err := db.Requeue(later.ID, "a", "connection refused", time.Now().Add(time.Hour)); !ok || err != nil {
+				t.Fatalf("Expected the message to be requeued, got %v, %v", ok, err)
+			}
+			if ok, err := db.Requeue(now.ID, "a", "connection refused", time.Now().Add(-time.Second)); !ok || err != nil {
+				t.Fatalf("Expected the message to be requeued, got %v, %v", ok, err)
+			}
+			requeued := assertStatus(t, db, later.ID, models.New)
+			if requeued.LastError != "connection refused" || requeued.ClaimedBy != "" || requeued.NextAttemptAt == nil {
+				t.Errorf("Unexpected requeued message: %+v", requeued)
+			}
+
+			// Only the message whose next attempt is due is claimed
+			message, ok := db.Dequeue(models.InsertData, "b")
+			if !ok || message.ID != now.ID || message.Attempts != 2 {
+				t.Fatalf("Expected message %d to be claimed for its second attempt, got %+v", now.ID, message)
+			}
+			if _, ok := db.Dequeue(models.InsertData, "b"); ok {
+				t.Error("Expected the other message to wait for its next attempt")
+			}
+		})
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			message := claimInsert(t, db, "a")
+
+			if ok, err := db.DeadLetter(message.ID, "a", "cannot parse file"); !ok || err != nil {
+				t.Fatalf("Expected the message to be dead-lettered, got %v, %v", ok, err)
+			}
+			dead := assertStatus(t, db, message.ID, models.Dead)
+			if dead.LastError != "cannot parse file" {
+				t.Errorf("Expected the last error to be kept, got %q", dead.LastError)
+			}
+
+			if _, ok := db.Dequeue(models.InsertData, "b"); ok {
+				t.Error("Expected dead messages not to be claimed")
+			}
+			if reclaimed, err := db.ReclaimExpired(time.Now().Add(time.Second)); reclaimed != 0 || err != nil {
+				t.Errorf("Expected dead messages not to be reclaimed, got %d, %v", reclaimed, err)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			message := claimInsert(t, db, "a")
+			claimedAt := assertStatus(t, db, message.ID, models.Claimed).ClaimedAt
+
+			time.Sleep(10 * time.Millisecond)
+			if ok, err := db.Heartbeat(message.ID, "a"); !ok || err != nil {
+				t.Fatalf("Expected the claim to be renewed, got %v, %v", ok, err)
+			}
+			renewed := assertStatus(t, db, message.ID, models.Claimed)
+			if !renewed.ClaimedAt.After(claimedAt) {
+				t.Errorf("Expected the claim time to move from %s, got %s", claimedAt, renewed.ClaimedAt)
+			}
+
+			if ok, err := db.Heartbeat(message.ID, "b"); ok || err != nil {
+				t.Errorf("Expected another worker's heartbeat to fail, got %v, %v", ok, err)
+			}
+
+			if _, err := db.ReclaimExpired(time.Now().Add(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := db.Heartbeat(message.ID, "a"); ok || err != nil {
+				t.Errorf("Expected a heartbeat after the message was reclaimed to fail, got %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestReclaimExpired(t *testing.T) {
+	for name, db := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			message := claimInsert(t, db, "a")
+
+			// Claims newer than the cutoff are left alone
+			if reclaimed, err := db.ReclaimExpired(time.Now().Add(-time.Minute)); reclaimed != 0 || err != nil {
+				t.Fatalf("Expected nothing to be reclaimed, got %d, %v", reclaimed, err)
+			}
+			assertStatus(t, db, message.ID, models.Claimed)
+
+			if reclaimed, err := db.ReclaimExpired(time.Now().Add(time.Second)); reclaimed != 1 || err != nil {
+				t.Fatalf("Expected one message to be reclaimed, got %d, %v", reclaimed, err)
+			}
+			if reclaimed := assertStatus(t, db, message.ID, models.New); reclaimed.ClaimedBy != "" {
+				t.Errorf("Expected the claim to be cleared, got %q", reclaimed.ClaimedBy)
+			}
+
+			claimed, ok := db.Dequeue(models.InsertData, "b")
+			if !ok || claimed.ID != message.ID || claimed.Attempts != 2 {
+				t.Errorf("Expected the message to be claimed for its second attempt, got %+v", claimed)
+			}
+		})
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	dataModels "github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/config"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
 )
@@ -23,6 +26,15 @@ type StaticDatabase struct {
 	ids   uint
 	mu    sync.Mutex
 	queue map[models.MessageType][]*models.Message
+
+	jobs map[string]*models.QueryJob
+
+	copyJobs   map[string]*models.CopyJob
+	copyChunks []models.CopyChunk
+
+	schemas       map[string][]dataModels.SchemaColumn
+	schemaChanges []models.SchemaChange
+	pauses        []models.Pause
 }
 
 func NewStaticDatabase(conf config.Database, destinations []config.Destination, apiKeys []config.APIKey) (*StaticDatabase, error) {
@@ -33,6 +45,11 @@ func NewStaticDatabase(conf config.Database, destinations []config.Destination,
 		adminAPIKeys:        apiKeys,
 
 		queue: make(map[models.MessageType][]*models.Message),
+		jobs:  make(map[string]*models.QueryJob),
+
+		copyJobs: make(map[string]*models.CopyJob),
+
+		schemas: make(map[string][]dataModels.SchemaColumn),
 	}
 
 	for i, destination := range destinations {
@@ -70,7 +87,7 @@ func (db *StaticDatabase) VerifyAdminAPIKey(ctx context.Context, apiKey string)
 	return false
 }
 
-func (db *StaticDatabase) CreateShareQuery(ctx context.Context, destId int64, query string, expires time.Duration) (queryId uuid.UUID, err error) {
+func (db *StaticDatabase) CreateShareQuery(ctx context.Context, destId int64, query string, params dataModels.Params, cacheTTL time.Duration, expires time.Duration) (queryId uuid.UUID, err error) {
 	return uuid.Nil, StaticDBError
 }
 
@@ -78,13 +95,262 @@ func (db *StaticDatabase) GetShareQuery(ctx context.Context, queryId uuid.UUID)
 	return models.SharedQuery{}, false
 }
 
+func (db *StaticDatabase) CreateQueryJob(ctx context.Context, destId int64, query string, params dataModels.Params) (models.QueryJob, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job := &models.QueryJob{
+		UUID:          uuid.New().String(),
+		DestinationID: destId,
+		Query:         query,
+		Params:        params,
+		Status:        models.JobQueued,
+	}
+
+	db.ids++
+	job.ID = db.ids
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+
+	db.jobs[job.UUID] = job
+	return *job, nil
+}
+
+func (db *StaticDatabase) GetQueryJob(ctx context.Context, jobId uuid.UUID) (models.QueryJob, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job, ok := db.jobs[jobId.String()]
+	if !ok {
+		return models.QueryJob{}, false
+	}
+	return *job, true
+}
+
+func (db *StaticDatabase) UpdateQueryJob(ctx context.Context, job *models.QueryJob, expected ...models.QueryJobStatus) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.jobs[job.UUID]
+	if !ok {
+		return false, errors.New("query job not found")
+	}
+
+	for _, status := range expected {
+		if stored.Status == status {
+			job.UpdatedAt = time.Now()
+			*stored = *job
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (db *StaticDatabase) CreateCopyJob(ctx context.Context, job *models.CopyJob) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job.UUID = uuid.New().String()
+	job.Status = models.JobQueued
+
+	db.ids++
+	job.ID = db.ids
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+
+	stored := *job
+	db.copyJobs[job.UUID] = &stored
+	return nil
+}
+
+func (db *StaticDatabase) GetCopyJob(ctx context.Context, jobId uuid.UUID) (models.CopyJob, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	job, ok := db.copyJobs[jobId.String()]
+	if !ok {
+		return models.CopyJob{}, false
+	}
+	return *job, true
+}
+
+func (db *StaticDatabase) UpdateCopyJob(ctx context.Context, job *models.CopyJob, expected ...models.QueryJobStatus) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.copyJobs[job.UUID]
+	if !ok {
+		return false, errors.New("copy job not found")
+	}
+
+	for _, status := range expected {
+		if stored.Status == status {
+			job.UpdatedAt = time.Now()
+			*stored = *job
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (db *StaticDatabase) AddCopyChunk(ctx context.Context, chunk *models.CopyChunk) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.ids++
+	chunk.ID = db.ids
+	chunk.CreatedAt = time.Now()
+	db.copyChunks = append(db.copyChunks, *chunk)
+	return nil
+}
+
+func (db *StaticDatabase) GetCopyChunks(ctx context.Context, copyJobId uint) ([]models.CopyChunk, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	chunks := []models.CopyChunk{}
+	for _, chunk := range db.copyChunks {
+		if chunk.CopyJobID == copyJobId {
+			chunks = append(chunks, chunk)
+		}
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Number < chunks[j].Number })
+	return chunks, nil
+}
+
+func (db *StaticDatabase) MarkCopyChunkLoaded(ctx context.Context, chunkId uint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := range db.copyChunks {
+		if db.copyChunks[i].ID == chunkId {
+			now := time.Now()
+			db.copyChunks[i].LoadedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("copy chunk %d not found", chunkId)
+}
+
+func (db *StaticDatabase) DeleteCopyChunks(ctx context.Context, copyJobId uint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	kept := db.copyChunks[:0]
+	for _, chunk := range db.copyChunks {
+		if chunk.CopyJobID != copyJobId {
+			kept = append(kept, chunk)
+		}
+	}
+	db.copyChunks = kept
+	return nil
+}
+
+// Declared schemas are kept in memory, so they need to be set again after a restart
+func (db *StaticDatabase) GetTableSchema(ctx context.Context, destId int64, table string) ([]dataModels.SchemaColumn, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.schemas[fmt.Sprintf("%d:%s", destId, table)], nil
+}
+
+func (db *StaticDatabase) SetTableSchema(ctx context.Context, destId int64, table string, columns []dataModels.SchemaColumn) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.schemas[fmt.Sprintf("%d:%s", destId, table)] = columns
+	return nil
+}
+
+func (db *StaticDatabase) AddSchemaChange(ctx context.Context, change *models.SchemaChange) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.ids++
+	change.ID = db.ids
+	change.CreatedAt = time.Now()
+	db.schemaChanges = append(db.schemaChanges, *change)
+	return nil
+}
+
+func (db *StaticDatabase) GetSchemaChanges(ctx context.Context, destId int64, table string) ([]models.SchemaChange, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	changes := []models.SchemaChange{}
+	for _, change := range db.schemaChanges {
+		if change.DestinationID == destId && change.Table == table {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// paused is true if loading the message's data is paused. The caller must hold db.mu.
+func (db *StaticDatabase) paused(message *models.Message) bool {
+	for _, pause := range db.pauses {
+		if pause.DestinationID == message.DestinationID && (pause.DestinationTable == "" || pause.DestinationTable == message.DestinationTable) {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *StaticDatabase) PauseLoading(ctx context.Context, destId int64, table string, reason string) (models.Pause, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, pause := range db.pauses {
+		if pause.DestinationID == uint(destId) && pause.DestinationTable == table {
+			db.pauses[i].Reason = reason
+			return db.pauses[i], nil
+		}
+	}
+
+	pause := models.Pause{DestinationID: uint(destId), DestinationTable: table, Reason: reason}
+	db.ids++
+	pause.ID = db.ids
+	pause.CreatedAt = time.Now()
+	db.pauses = append(db.pauses, pause)
+	return pause, nil
+}
+
+func (db *StaticDatabase) ResumeLoading(ctx context.Context, destId int64, table string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, pause := range db.pauses {
+		if pause.DestinationID == uint(destId) && pause.DestinationTable == table {
+			db.pauses = append(db.pauses[:i], db.pauses[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (db *StaticDatabase) GetPauses(ctx context.Context, destId int64) ([]models.Pause, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pauses := []models.Pause{}
+	for _, pause := range db.pauses {
+		if pause.DestinationID == uint(destId) {
+			pauses = append(pauses, pause)
+		}
+	}
+	return pauses, nil
+}
+
 func (db *StaticDatabase) GetAPIKeyDetails(ctx context.Context, apiKey string) (models.APIKey, error) {
 	dbId, ok := db.apiKeyToDestination[apiKey]
 	if !ok {
 		return models.APIKey{}, errors.New("invalid API key")
 	}
 	rc := models.APIKey{
-		DestinationID: dbId,
+		DestinationID:       dbId,
+		MaxExecutionSeconds: db.destinations[dbId].MaxExecutionSeconds,
 	}
 	return rc, nil
 }
@@ -131,9 +397,15 @@ func (db *StaticDatabase) Enqueue(messageType models.MessageType, m any) (*model
 		Status:      models.New,
 		Message:     string(mStr),
 	}
+	if routed, ok := m.(models.TableMessage); ok {
+		destinationID, table := routed.MessageDestination()
+		message.DestinationID = uint(destinationID)
+		message.DestinationTable = table
+	}
 
 	db.ids++
 	message.ID = db.ids
+	message.CreatedAt = time.Now()
 
 	queue = append(queue, message)
 	db.queue[messageType] = queue
@@ -154,13 +426,21 @@ func (db *StaticDatabase) Dequeue(messageType models.MessageType, claimedBy stri
 		return nil, false
 	}
 
+	now := time.Now()
 	for _, message := range queue {
-		if message.Status == models.Claimed {
+		if message.Status != models.New {
+			continue
+		}
+		if message.NextAttemptAt != nil && message.NextAttemptAt.After(now) {
 			continue
 		}
-		message.ClaimedAt = time.Now()
+		if (messageType == models.InsertData || messageType == models.CopyData) && db.paused(message) {
+			continue
+		}
+		message.ClaimedAt = now
 		message.ClaimedBy = claimedBy
 		message.Status = models.Claimed
+		message.Attempts++
 
 		return message, true
 	}
@@ -172,6 +452,12 @@ func (db *StaticDatabase) Delete(id uint) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	db.deleteMessage(id)
+	return nil
+}
+
+// deleteMessage removes the message with the given ID. The caller must hold db.mu.
+func (db *StaticDatabase) deleteMessage(id uint) {
 	for k, queue := range db.queue {
 		found := -1
 		for i, message := range queue {
@@ -187,6 +473,213 @@ func (db *StaticDatabase) Delete(id uint) error {
 			break
 		}
 	}
+}
+
+// findMessage returns the queued message with the given ID. The caller must hold db.mu.
+func (db *StaticDatabase) findMessage(id uint) (*models.Message, bool) {
+	for _, queue := range db.queue {
+		for _, message := range queue {
+			if message.ID == id {
+				return message, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// claimedMessage returns the message with the given ID if it is still claimed
+// by claimedBy. The caller must hold db.mu.
+func (db *StaticDatabase) claimedMessage(id uint, claimedBy string) (*models.Message, bool) {
+	message, ok := db.findMessage(id)
+	if !ok || message.Status != models.Claimed || message.ClaimedBy != claimedBy {
+		return nil, false
+	}
+	return message, true
+}
+
+func (db *StaticDatabase) DeleteClaimed(id uint, claimedBy string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.claimedMessage(id, claimedBy); !ok {
+		return false, nil
+	}
+
+	db.deleteMessage(id)
+	return true, nil
+}
+
+func (db *StaticDatabase) Requeue(id uint, claimedBy string, lastError string, nextAttemptAt time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	message, ok := db.claimedMessage(id, claimedBy)
+	if !ok {
+		return false, nil
+	}
+
+	message.Status = models.New
+	message.ClaimedBy = ""
+	message.NextAttemptAt = &nextAttemptAt
+	message.LastError = lastError
+	return true, nil
+}
+
+func (db *StaticDatabase) DeadLetter(id uint, claimedBy string, lastError string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	message, ok := db.claimedMessage(id, claimedBy)
+	if !ok {
+		return false, nil
+	}
+
+	message.Status = models.Dead
+	message.LastError = lastError
+	return true, nil
+}
+
+func (db *StaticDatabase) Heartbeat(id uint, claimedBy string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	message, ok := db.claimedMessage(id, claimedBy)
+	if !ok {
+		return false, nil
+	}
+
+	message.ClaimedAt = time.Now()
+	return true, nil
+}
+
+func (db *StaticDatabase) ReclaimExpired(claimedBefore time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var reclaimed int64
+	for _, queue := range db.queue {
+		for _, message := range queue {
+			if message.Status == models.Claimed && message.ClaimedAt.Before(claimedBefore) {
+				message.Status = models.New
+				message.ClaimedBy = ""
+				reclaimed++
+			}
+		}
+	}
+	return reclaimed, nil
+}
+
+func queueFilterMatches(message *models.Message, filter models.QueueFilter) bool {
+	return (filter.Status == "" || message.Status == filter.Status) &&
+		(filter.MessageType == "" || message.MessageType == filter.MessageType) &&
+		(filter.DestinationID == nil || message.DestinationID == *filter.DestinationID) &&
+		(filter.Table == "" || message.DestinationTable == filter.Table)
+}
+
+func (db *StaticDatabase) ListMessages(filter models.QueueFilter, limit int) ([]models.Message, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	messages := []models.Message{}
+	for _, queue := range db.queue {
+		for _, message := range queue {
+			if queueFilterMatches(message, filter) {
+				messages = append(messages, *message)
+			}
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (db *StaticDatabase) GetMessage(id uint) (models.Message, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	message, ok := db.findMessage(id)
+	if !ok {
+		return models.Message{}, false
+	}
+	return *message, true
+}
+
+func (db *StaticDatabase) RetryMessage(id uint) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	message, ok := db.findMessage(id)
+	if !ok {
+		return fmt.Errorf("message %d not found", id)
+	}
 
+	message.Status = models.New
+	message.ClaimedBy = ""
+	message.Attempts = 0
+	message.NextAttemptAt = nil
 	return nil
 }
+
+func (db *StaticDatabase) PurgeMessages(filter models.QueueFilter) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var purged int64
+	for k, queue := range db.queue {
+		kept := make([]*models.Message, 0, len(queue))
+		for _, message := range queue {
+			if queueFilterMatches(message, filter) {
+				purged++
+			} else {
+				kept = append(kept, message)
+			}
+		}
+		db.queue[k] = kept
+	}
+	return purged, nil
+}
+
+func (db *StaticDatabase) QueueStats() ([]models.QueueStats, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	type group struct {
+		destinationID uint
+		messageType   models.MessageType
+		status        models.MessageStatus
+	}
+	groups := map[group]*models.QueueStats{}
+	for _, queue := range db.queue {
+		for _, message := range queue {
+			key := group{message.DestinationID, message.MessageType, message.Status}
+			stats, ok := groups[key]
+			if !ok {
+				stats = &models.QueueStats{DestinationID: key.destinationID, MessageType: key.messageType, Status: key.status, OldestAt: message.CreatedAt}
+				groups[key] = stats
+			}
+			stats.Messages++
+			if message.CreatedAt.Before(stats.OldestAt) {
+				stats.OldestAt = message.CreatedAt
+			}
+		}
+	}
+
+	stats := make([]models.QueueStats, 0, len(groups))
+	for _, s := range groups {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.DestinationID != b.DestinationID {
+			return a.DestinationID < b.DestinationID
+		}
+		if a.MessageType != b.MessageType {
+			return a.MessageType < b.MessageType
+		}
+		return a.Status < b.Status
+	})
+	return stats, nil
+}
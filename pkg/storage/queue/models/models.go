@@ -5,3 +5,33 @@ type FileUploadMessage struct {
 	Table      string `json:"table"`
 	Key        string `json:"key"`
 }
+
+func (m FileUploadMessage) MessageDestination() (int64, string) {
+	return m.DatabaseID, m.Table
+}
+
+type QueryJobMessage struct {
+	JobID         string `json:"job_id"`
+	DestinationID int64  `json:"destination_id"`
+
+	// The execution limit of the API key which created the job, or 0 for none
+	MaxExecutionSeconds int `json:"max_execution_seconds,omitempty"`
+	// Whether the job was created with a key which may only read
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
+func (m QueryJobMessage) MessageDestination() (int64, string) {
+	return m.DestinationID, ""
+}
+
+// CopyJobMessage names a copy job. Its destination and table are the target's,
+// so that pausing the target pauses the copy.
+type CopyJobMessage struct {
+	JobID         string `json:"job_id"`
+	DestinationID int64  `json:"destination_id"`
+	Table         string `json:"table"`
+}
+
+func (m CopyJobMessage) MessageDestination() (int64, string) {
+	return m.DestinationID, m.Table
+}
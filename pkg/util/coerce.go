@@ -0,0 +1,291 @@
+package util
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/shopspring/decimal"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Timestamps are written without a zone, in UTC, which every destination reads
+const coercedTimestampLayout = "2006-01-02 15:04:05.999999"
+const coercedDateLayout = "2006-01-02"
+
+// Layouts tried, in order, when reading timestamps and dates from strings
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+var errNotCoercible = errors.New("value cannot be converted")
+
+// CoerceNDJSONFile rewrites the declared columns of each row of an NDJSON file
+// to the JSON form of their declared type. Values which cannot be converted
+// become null. It returns the number of such values for each column.
+func CoerceNDJSONFile(path string, columns []models.SchemaColumn) (map[string]int, error) {
+	failed := map[string]int{}
+	err := rewriteNDJSONFile(path, func(row []byte) ([]byte, error) {
+		return CoerceRow(row, columns, failed)
+	})
+	return failed, err
+}
+
+// rewriteNDJSONFile replaces each non-empty line of an NDJSON file with the
+// result of rewrite. The new file is written alongside and renamed over the old one.
+func rewriteNDJSONFile(path string, rewrite func(row []byte) ([]byte, error)) error {
+	input, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+
+	reader := bufio.NewReader(input)
+	writer := bufio.NewWriter(output)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			output.Close()
+			return readErr
+		}
+
+		if len(strings.TrimSpace(string(line))) > 0 {
+			row, err := rewrite(line)
+			if err != nil {
+				output.Close()
+				return err
+			}
+			writer.Write(row)
+			writer.WriteByte('\n')
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		output.Close()
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(output.Name(), path)
+}
+
+// CoerceRow converts the declared columns of a JSON object and counts values
+// which could not be converted in failed
+func CoerceRow(row []byte, columns []models.SchemaColumn, failed map[string]int) ([]byte, error) {
+	row = []byte(strings.TrimSpace(string(row)))
+
+	for _, column := range columns {
+		path := escapeJSONPath(column.Name)
+		value := gjson.GetBytes(row, path)
+		if !value.Exists() || value.Type == gjson.Null {
+			continue
+		}
+
+		raw, err := coerceValue(value, column.Type, column.EpochMillis)
+		if err != nil {
+			failed[column.Name]++
+			raw = "null"
+		}
+
+		row, err = sjson.SetRawBytes(row, path, []byte(raw))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return row, nil
+}
+
+// escapeJSONPath escapes the characters gjson and sjson treat as path syntax
+func escapeJSONPath(key string) string {
+	var b strings.Builder
+	for _, c := range key {
+		switch c {
+		case '.', '*', '?', '|', '#', '@', '\\', '!', '=', '<', '>', '%', ':':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// CoerceValue returns the raw JSON for value converted to the declared type
+func CoerceValue(value gjson.Result, t models.ColumnType) (string, error) {
+	return coerceValue(value, t, false)
+}
+
+// coerceValue converts value to t. Numbers in timestamp and date columns are
+// read as Unix milliseconds if epochMillis is set.
+func coerceValue(value gjson.Result, t models.ColumnType, epochMillis bool) (string, error) {
+	if value.Type == gjson.Null {
+		return "null", nil
+	}
+
+	switch t.Kind {
+	case models.KindString, models.KindLowCardinality:
+		if value.Type == gjson.String {
+			return value.Raw, nil
+		}
+		return quote(value.Raw), nil
+
+	case models.KindJSON:
+		return value.Raw, nil
+
+	case models.KindInt:
+		switch value.Type {
+		case gjson.True:
+			return "1", nil
+		case gjson.False:
+			return "0", nil
+		}
+		text := scalarText(value)
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), nil
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+		return "", errNotCoercible
+
+	case models.KindFloat:
+		f, err := strconv.ParseFloat(scalarText(value), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", errNotCoercible
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+
+	case models.KindDecimal:
+		if value.Type != gjson.Number && value.Type != gjson.String {
+			return "", errNotCoercible
+		}
+		d, err := decimal.NewFromString(scalarText(value))
+		if err != nil {
+			return "", errNotCoercible
+		}
+		if t.Precision > 0 {
+			// Rows which do not fit the declared precision are rejected here,
+			// rather than failing the whole load at the destination
+			d = d.Round(int32(t.Scale))
+			if d.Abs().Truncate(0).GreaterThanOrEqual(decimal.New(1, int32(t.Precision-t.Scale))) {
+				return "", errNotCoercible
+			}
+		}
+		// Written as a string so that no destination rounds it through a float
+		return quote(d.String()), nil
+
+	case models.KindBool:
+		switch value.Type {
+		case gjson.True, gjson.False:
+			return value.Raw, nil
+		}
+		switch strings.ToLower(scalarText(value)) {
+		case "true", "t", "yes", "y", "1":
+			return "true", nil
+		case "false", "f", "no", "n", "0":
+			return "false", nil
+		}
+		return "", errNotCoercible
+
+	case models.KindTimestamp, models.KindDate:
+		ts, err := parseTimestamp(value, epochMillis)
+		if err != nil {
+			return "", err
+		}
+		if t.Kind == models.KindDate {
+			return quote(ts.Format(coercedDateLayout)), nil
+		}
+		return quote(ts.Format(coercedTimestampLayout)), nil
+
+	case models.KindUUID:
+		id, err := uuid.Parse(value.String())
+		if err != nil {
+			return "", errNotCoercible
+		}
+		return quote(id.String()), nil
+
+	case models.KindArray:
+		if !value.IsArray() {
+			return "", errNotCoercible
+		}
+
+		var b strings.Builder
+		b.WriteByte('[')
+		for i, element := range value.Array() {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			raw, err := coerceValue(element, *t.Element, epochMillis)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(raw)
+		}
+		b.WriteByte(']')
+		return b.String(), nil
+	}
+
+	return "", errNotCoercible
+}
+
+// scalarText is the trimmed text of a string, or the raw JSON of anything else
+func scalarText(value gjson.Result) string {
+	if value.Type == gjson.String {
+		return strings.TrimSpace(value.Str)
+	}
+	return value.Raw
+}
+
+func quote(s string) string {
+	return `"` + JsonEscape(s) + `"`
+}
+
+// parseTimestamp reads a string in one of timestampLayouts, or a Unix time.
+// Numbers are milliseconds if epochMillis is set. Otherwise, numbers larger
+// than 1e11 are taken to be milliseconds.
+func parseTimestamp(value gjson.Result, epochMillis bool) (time.Time, error) {
+	if value.Type == gjson.Number {
+		f := value.Float()
+		if epochMillis || math.Abs(f) >= 1e11 {
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+
+	if value.Type != gjson.String {
+		return time.Time{}, errNotCoercible
+	}
+
+	text := strings.TrimSpace(value.Str)
+	for _, layout := range timestampLayouts {
+		if ts, err := time.Parse(layout, text); err == nil {
+			return ts.UTC(), nil
+		}
+	}
+	return time.Time{}, errNotCoercible
+}
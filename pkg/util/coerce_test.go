@@ -0,0 +1,127 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/models"
+	"github.com/tidwall/gjson"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		t        string
+		expected string
+	}{
+		{`2134`, "string", `"2134"`},
+		{`"02134"`, "string", `"02134"`},
+		{`{"a": 1}`, "string", `"{\"a\": 1}"`},
+		{`"42"`, "int", `42`},
+		{`42.0`, "int", `42`},
+		{`true`, "int", `1`},
+		{`"1.5"`, "float", `1.5`},
+		{`"yes"`, "bool", `true`},
+		{`0`, "bool", `false`},
+		{`"12.340"`, "decimal(10,3)", `"12.34"`},
+		{`1e3`, "decimal(10,2)", `"1000"`},
+		{`12.345`, "decimal(6,2)", `"12.35"`},
+		{`"-9999.994"`, "decimal(6,2)", `"-9999.99"`},
+		{`"2024-01-02T03:04:05.5+01:00"`, "timestamp", `"2024-01-02 02:04:05.5"`},
+		{`"2024-01-02"`, "timestamp", `"2024-01-02 00:00:00"`},
+		{`1704164645`, "timestamp", `"2024-01-02 03:04:05"`},
+		{`1704164645123`, "timestamp", `"2024-01-02 03:04:05.123"`},
+		{`"2024-01-02 03:04:05"`, "date", `"2024-01-02"`},
+		{`"6BA7B810-9DAD-11D1-80B4-00C04FD430C8"`, "uuid", `"6ba7b810-9dad-11d1-80b4-00c04fd430c8"`},
+		{`{"a": [1]}`, "json", `{"a": [1]}`},
+		{`[1, "2", 3.0]`, "array(int)", `[1,2,3]`},
+		{`null`, "int", `null`},
+	}
+
+	for _, test := range tests {
+		columnType, err := models.ParseColumnType(test.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := CoerceValue(gjson.Parse(test.value), columnType)
+		if err != nil || got != test.expected {
+			t.Errorf("%s as %s: expected %s; got %s, %v", test.value, test.t, test.expected, got, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`"abc"`:       "int",
+		`1.5`:         "int",
+		`"maybe"`:     "bool",
+		`"yesterday"`: "timestamp",
+		`"12a"`:       "decimal",
+		`12345.6789`:  "decimal(6,2)",
+		`9999.996`:    "decimal(6,2)",
+		`1`:           "decimal(2,2)",
+		`"not-uuid"`:  "uuid",
+		`[1, "x"]`:    "array(int)",
+		`5`:           "array(int)",
+	}
+	for value, typeText := range invalid {
+		columnType, _ := models.ParseColumnType(typeText)
+		if got, err := CoerceValue(gjson.Parse(value), columnType); err == nil {
+			t.Errorf("%s as %s: expected an error; got %s", value, typeText, got)
+		}
+	}
+}
+
+func TestCoerceNDJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.ndjson")
+	err := os.WriteFile(path, []byte(`{"zip": 2134, "n": "x", "other": 1}
+{"zip": "02134", "n": 2}
+
+{"other": 3}
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := []models.SchemaColumn{
+		{Name: "zip", Type: models.ColumnType{Kind: models.KindString}},
+		{Name: "n", Type: models.ColumnType{Kind: models.KindInt}},
+	}
+
+	failed, err := CoerceNDJSONFile(path, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed["n"] != 1 || failed["zip"] != 0 {
+		t.Errorf("Unexpected failures %v", failed)
+	}
+
+	data, _ := os.ReadFile(path)
+	expected := `{"zip": "2134", "n": null, "other": 1}
+{"zip": "02134", "n": 2}
+{"other": 3}
+`
+	if string(data) != expected {
+		t.Errorf("Expected %q; got %q", expected, data)
+	}
+}
+
+func TestCoerceRowEpochMillis(t *testing.T) {
+	columns := []models.SchemaColumn{
+		{Name: "ms", Type: models.ColumnType{Kind: models.KindTimestamp}, EpochMillis: true},
+		{Name: "s", Type: models.ColumnType{Kind: models.KindTimestamp}},
+	}
+
+	tests := map[string]string{
+		`{"ms": 0, "s": 0}`:                         `{"ms": "1970-01-01 00:00:00", "s": "1970-01-01 00:00:00"}`,
+		`{"ms": 86400000, "s": 86400}`:              `{"ms": "1970-01-02 00:00:00", "s": "1970-01-02 00:00:00"}`,
+		`{"ms": 1704164645123, "s": 1704164645123}`: `{"ms": "2024-01-02 03:04:05.123", "s": "2024-01-02 03:04:05.123"}`,
+		`{"ms": "2024-01-02", "s": "2024-01-02"}`:   `{"ms": "2024-01-02 00:00:00", "s": "2024-01-02 00:00:00"}`,
+	}
+	for row, expected := range tests {
+		got, err := CoerceRow([]byte(row), columns, map[string]int{})
+		if err != nil || string(got) != expected {
+			t.Errorf("%s: expected %s; got %s, %v", row, expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// WidenJSONType returns the narrowest JSON type which holds values of both
+// types. Ints widen to floats, and anything else which differs to strings.
+func WidenJSONType(a string, b string) string {
+	switch {
+	case a == b:
+		return a
+	case (a == "int" && b == "float") || (a == "float" && b == "int"):
+		return "float"
+	default:
+		return "string"
+	}
+}
+
+// JSONValueType is the JSON type GetJSONTypes counts a value as, or "" for null
+func JSONValueType(value gjson.Result) string {
+	switch value.Type {
+	case gjson.Null:
+		return ""
+	case gjson.True, gjson.False:
+		return "bool"
+	case gjson.Number:
+		if _, err := strconv.Atoi(value.Raw); err == nil {
+			return "int"
+		}
+		return "float"
+	default:
+		return "string"
+	}
+}
+
+// SidecarColumn is a sibling of a column which holds the values whose type
+// does not fit the column's, as in price__string next to a float price column
+type SidecarColumn struct {
+	Column string
+	Type   string
+}
+
+func (c SidecarColumn) Name() string {
+	return c.Column + "__" + c.Type
+}
+
+// MoveToSidecarColumns rewrites an NDJSON file so that values which do not fit
+// the JSON type of their column move to a sidecar column. columns maps column
+// names to their current types. It returns the number of values moved into
+// each sidecar column.
+func MoveToSidecarColumns(path string, columns map[string]string) (map[SidecarColumn]int, error) {
+	moved := map[SidecarColumn]int{}
+	err := rewriteNDJSONFile(path, func(row []byte) ([]byte, error) {
+		row = []byte(strings.TrimSpace(string(row)))
+
+		for column, columnType := range columns {
+			path := escapeJSONPath(column)
+			value := gjson.GetBytes(row, path)
+
+			valueType := JSONValueType(value)
+			if !value.Exists() || valueType == "" || WidenJSONType(columnType, valueType) == columnType {
+				continue
+			}
+
+			sidecar := SidecarColumn{Column: column, Type: valueType}
+			var err error
+			row, err = sjson.SetRawBytes(row, escapeJSONPath(sidecar.Name()), []byte(value.Raw))
+			if err != nil {
+				return nil, err
+			}
+			row, err = sjson.DeleteBytes(row, path)
+			if err != nil {
+				return nil, err
+			}
+			moved[sidecar]++
+		}
+
+		return row, nil
+	})
+	return moved, err
+}
@@ -0,0 +1,53 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWidenJSONType(t *testing.T) {
+	tests := []struct{ a, b, expected string }{
+		{"int", "int", "int"},
+		{"int", "float", "float"},
+		{"float", "int", "float"},
+		{"int", "string", "string"},
+		{"bool", "int", "string"},
+		{"string", "float", "string"},
+	}
+
+	for _, test := range tests {
+		if got := WidenJSONType(test.a, test.b); got != test.expected {
+			t.Errorf("%s, %s: expected %s, got %s", test.a, test.b, test.expected, got)
+		}
+	}
+}
+
+func TestMoveToSidecarColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.ndjson")
+	input := `{"price": 1, "qty": 2}
+{"price": 1.5, "qty": "two"}
+{"price": "free", "qty": null}
+`
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := MoveToSidecarColumns(path, map[string]string{"price": "float", "qty": "int"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"price": 1, "qty": 2}
+{"price": 1.5,"qty__string":"two"}
+{ "qty": null,"price__string":"free"}
+`
+	output, _ := os.ReadFile(path)
+	if string(output) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, output)
+	}
+
+	if moved[SidecarColumn{"price", "string"}] != 1 || moved[SidecarColumn{"qty", "string"}] != 1 || len(moved) != 2 {
+		t.Errorf("unexpected counts %v", moved)
+	}
+}
@@ -0,0 +1,100 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/scratchdata/scratchdata/models"
+)
+
+// ErrInvalidParam is returned when a query's placeholders do not match its params
+var ErrInvalidParam = errors.New("invalid query parameter")
+
+// BindParams replaces each {name} placeholder outside of strings and comments
+// with the placeholder returned by bind for the named parameter. Each element
+// of a list parameter is bound separately and the list becomes a
+// parenthesized, comma-separated list for use with IN.
+//
+// Queries are returned unchanged when there are no params, so destination
+// syntax such as ClickHouse's {name:Type} is left alone.
+func BindParams(query string, params models.Params, bind func(value models.Param) string) (string, error) {
+	if len(params) == 0 {
+		return query, nil
+	}
+
+	var out strings.Builder
+	i := 0
+	for i < len(query) {
+		c := query[i]
+
+		switch {
+		case skipSQL(query, i) > i:
+			end := skipSQL(query, i)
+			out.WriteString(query[i:end])
+			i = end
+
+		case c == '{' && paramName(query[i:]) != "":
+			name := paramName(query[i:])
+			param, ok := params[name]
+			if !ok {
+				return "", fmt.Errorf("%w: missing value for %q", ErrInvalidParam, name)
+			}
+
+			if list, ok := param.Value.([]models.Param); ok {
+				if len(list) == 0 {
+					return "", fmt.Errorf("%w: %q is an empty list", ErrInvalidParam, name)
+				}
+
+				out.WriteByte('(')
+				for j, item := range list {
+					if j > 0 {
+						out.WriteString(", ")
+					}
+					out.WriteString(bind(item))
+				}
+				out.WriteByte(')')
+			} else {
+				out.WriteString(bind(param))
+			}
+			i += len(name) + 2
+
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	return out.String(), nil
+}
+
+// CheckParams returns an error wrapping ErrInvalidParam if a placeholder in query has no value
+func CheckParams(query string, params models.Params) error {
+	_, err := BindParams(query, params, func(models.Param) string { return "" })
+	return err
+}
+
+// PositionalParams binds params as $1, $2, ... placeholders for database/sql
+// drivers and returns the arguments in order
+func PositionalParams(query string, params models.Params) (string, []any, error) {
+	var args []any
+	bound, err := BindParams(query, params, func(value models.Param) string {
+		args = append(args, value.Value)
+		return fmt.Sprintf("$%d", len(args))
+	})
+	return bound, args, err
+}
+
+// paramName returns the name in a {name} placeholder at the start of s, or ""
+func paramName(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '}' && i > 1 {
+			return s[1:i]
+		}
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 1 && isSQLDigit(c))) {
+			return ""
+		}
+	}
+	return ""
+}
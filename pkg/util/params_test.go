@@ -0,0 +1,42 @@
+package util
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/models"
+)
+
+func TestPositionalParams(t *testing.T) {
+	params := models.Params{
+		"country": {Type: models.ParamString, Value: "US"},
+		"ids": {Type: models.ParamList, Value: []models.Param{
+			{Type: models.ParamInt, Value: int64(1)},
+			{Type: models.ParamInt, Value: int64(2)},
+		}},
+	}
+
+	query, args, err := PositionalParams(
+		"SELECT '{country}', {x:String} FROM t -- {country}\nWHERE country = {country} AND id IN {ids}", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "SELECT '{country}', {x:String} FROM t -- {country}\nWHERE country = $1 AND id IN ($2, $3)"
+	if query != expected {
+		t.Errorf("Expected %q; got %q", expected, query)
+	}
+	if !reflect.DeepEqual(args, []any{"US", int64(1), int64(2)}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	if _, _, err := PositionalParams("SELECT {missing}", params); !errors.Is(err, ErrInvalidParam) {
+		t.Errorf("Expected missing parameter error; got %v", err)
+	}
+
+	// Without params the query is left alone
+	if query, _, _ := PositionalParams("SELECT {missing}", nil); query != "SELECT {missing}" {
+		t.Errorf("Expected query to be unchanged; got %q", query)
+	}
+}
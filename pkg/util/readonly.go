@@ -0,0 +1,404 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrQueryNotAllowed is returned for queries which are not a single read-only statement
+var ErrQueryNotAllowed = errors.New("query not allowed")
+
+// Statements which change data or the database, or escape it, even when
+// nested inside a SELECT (e.g. Postgres/Redshift data-modifying CTEs)
+var forbiddenKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "upsert": true,
+	"create": true, "alter": true, "drop": true, "truncate": true, "rename": true,
+	"grant": true, "revoke": true, "copy": true,
+	"attach": true, "detach": true, "install": true, "pragma": true,
+}
+
+// Statements whose keywords are common column names. They are only rejected
+// where a statement can start, which within a SELECT is the body of a CTE.
+var statementKeywords = map[string]bool{
+	"merge": true, "load": true, "call": true, "import": true, "export": true,
+}
+
+// Words after which INTO is a column or alias name rather than SELECT INTO
+var nameBeforeInto = map[string]bool{
+	"select": true, "distinct": true, "all": true, "as": true,
+}
+
+// Table functions which read files, URLs or other databases
+var blockedFunctions = map[string]bool{
+	// DuckDB
+	"read_csv": true, "read_csv_auto": true, "sniff_csv": true,
+	"read_parquet": true, "parquet_scan": true, "parquet_metadata": true,
+	"parquet_schema": true, "parquet_file_metadata": true, "parquet_kv_metadata": true,
+	"read_json": true, "read_json_auto": true, "read_json_objects": true, "read_json_objects_auto": true,
+	"read_ndjson": true, "read_ndjson_auto": true, "read_ndjson_objects": true,
+	"read_text": true, "read_blob": true, "glob": true, "st_read": true,
+	"iceberg_scan": true, "iceberg_metadata": true, "iceberg_snapshots": true, "delta_scan": true,
+	"sqlite_scan": true, "sqlite_attach": true, "postgres_scan": true, "postgres_scan_pushdown": true,
+	"postgres_attach": true, "postgres_query": true, "mysql_scan": true, "mysql_query": true,
+	"query": true, "query_table": true,
+
+	// ClickHouse
+	"url": true, "urlcluster": true, "file": true, "filecluster": true,
+	"s3": true, "s3cluster": true, "gcs": true, "hdfs": true, "hdfscluster": true,
+	"azureblobstorage": true, "azureblobstoragecluster": true,
+	"remote": true, "remotesecure": true, "cluster": true, "clusterallreplicas": true,
+	"mysql": true, "postgresql": true, "sqlite": true, "jdbc": true, "odbc": true,
+	"mongodb": true, "redis": true, "executable": true, "input": true,
+	"deltalake": true, "hudi": true, "iceberg": true,
+
+	// BigQuery
+	"external_query": true,
+}
+
+// Keywords which start a clause. Used to tell when a string is in table position.
+var clauseKeywords = map[string]string{
+	"select": "select", "from": "from", "join": "from", "where": "where",
+	"group": "group", "order": "order", "having": "having", "limit": "limit",
+	"on": "on", "using": "using", "union": "select", "intersect": "select",
+	"except": "select", "qualify": "qualify", "window": "window",
+}
+
+// CheckReadOnlyQuery returns an error wrapping ErrQueryNotAllowed unless the
+// query is a single SELECT or WITH statement which does not modify data or
+// read files, URLs or other databases through table functions.
+//
+// Destinations disagree on how strings and comments are written, so the
+// query is checked under every combination of lexing rules. Any reading of
+// the query which is not read-only is rejected.
+func CheckReadOnlyQuery(query string) error {
+	for _, dialect := range sqlDialects() {
+		tokens, err := lexSQL(query, dialect)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrQueryNotAllowed, err.Error())
+		}
+
+		if err := checkReadOnlyTokens(tokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkReadOnlyTokens(tokens []sqlToken) error {
+	for len(tokens) > 0 && tokens[len(tokens)-1].is(sqlPunct, ";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	start := 0
+	for start < len(tokens) && tokens[start].is(sqlPunct, "(") {
+		start++
+	}
+	if start == len(tokens) {
+		return fmt.Errorf("%w: query is empty", ErrQueryNotAllowed)
+	}
+	if !tokens[start].is(sqlWord, "select") && !tokens[start].is(sqlWord, "with") {
+		return fmt.Errorf("%w: only SELECT and WITH statements are allowed", ErrQueryNotAllowed)
+	}
+
+	// The clause each level of parentheses is in
+	clauses := []string{""}
+
+	for i, token := range tokens {
+		var prev, next sqlToken
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		if i < len(tokens)-1 {
+			next = tokens[i+1]
+		}
+
+		switch token.kind {
+		case sqlPunct:
+			switch token.text {
+			case ";":
+				return fmt.Errorf("%w: multiple statements are not allowed", ErrQueryNotAllowed)
+			case "(":
+				clauses = append(clauses, "")
+			case ")":
+				if len(clauses) > 1 {
+					clauses = clauses[:len(clauses)-1]
+				}
+			}
+			continue
+		case sqlWord:
+			if clause, ok := clauseKeywords[token.text]; ok {
+				clauses[len(clauses)-1] = clause
+			}
+
+			if forbiddenKeywords[token.text] && !next.is(sqlPunct, "(") && !prev.is(sqlPunct, ".") {
+				return fmt.Errorf("%w: %s is not allowed", ErrQueryNotAllowed, strings.ToUpper(token.text))
+			}
+			if statementKeywords[token.text] && startsStatement(tokens, i) {
+				return fmt.Errorf("%w: %s is not allowed", ErrQueryNotAllowed, strings.ToUpper(token.text))
+			}
+			if token.text == "into" && isSelectInto(prev, next, clauses[len(clauses)-1]) {
+				return fmt.Errorf("%w: INTO is not allowed", ErrQueryNotAllowed)
+			}
+			// ClickHouse's SETTINGS name = value, which could lift the server's limits
+			if token.text == "settings" && (next.kind == sqlWord || next.kind == sqlQuotedIdent) && i+2 < len(tokens) && tokens[i+2].is(sqlPunct, "=") {
+				return fmt.Errorf("%w: SETTINGS is not allowed", ErrQueryNotAllowed)
+			}
+		}
+
+		if (token.kind == sqlWord || token.kind == sqlQuotedIdent) && next.is(sqlPunct, "(") &&
+			blockedFunctions[strings.ToLower(token.text)] {
+			return fmt.Errorf("%w: function %s is not allowed", ErrQueryNotAllowed, token.text)
+		}
+
+		// DuckDB reads files named in the FROM clause, e.g. FROM 'data.csv' or FROM "data.csv"
+		tablePosition := prev.is(sqlWord, "from") || prev.is(sqlWord, "join") ||
+			(prev.is(sqlPunct, ",") && clauses[len(clauses)-1] == "from")
+		isPath := token.kind == sqlString ||
+			(token.kind == sqlQuotedIdent && token.quote == '"' && strings.ContainsAny(token.text, `./\:`))
+		if tablePosition && isPath {
+			return fmt.Errorf("%w: reading files is not allowed", ErrQueryNotAllowed)
+		}
+	}
+
+	return nil
+}
+
+type readOnlyKey struct{}
+
+// WithReadOnly marks ctx as belonging to a request which may only read data.
+// Destinations which can enforce this on the server do so, in case a query
+// gets past CheckReadOnlyQuery.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// IsReadOnly is true if ctx was marked by WithReadOnly
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+// startsStatement is true if the token at i opens the body of a CTE, as in
+// WITH x AS (MERGE ...) or WITH x AS MATERIALIZED (MERGE ...)
+func startsStatement(tokens []sqlToken, i int) bool {
+	if i < 2 || !tokens[i-1].is(sqlPunct, "(") {
+		return false
+	}
+	return tokens[i-2].is(sqlWord, "as") || tokens[i-2].is(sqlWord, "materialized")
+}
+
+// isSelectInto is true if INTO, between prev and next, writes the result
+// somewhere: SELECT ... INTO table in the select list, or INTO OUTFILE and
+// INTO DUMPFILE in any clause. Otherwise INTO is a column or alias name.
+func isSelectInto(prev sqlToken, next sqlToken, clause string) bool {
+	if next.is(sqlWord, "outfile") || next.is(sqlWord, "dumpfile") {
+		return true
+	}
+	if clause != "select" || prev.is(sqlPunct, ".") || prev.is(sqlPunct, ",") || prev.is(sqlPunct, "(") {
+		return false
+	}
+	if prev.kind == sqlWord && nameBeforeInto[prev.text] {
+		return false
+	}
+
+	// The target is a name, which is not the next clause
+	if next.kind == sqlQuotedIdent {
+		return true
+	}
+	_, isClause := clauseKeywords[next.text]
+	return next.kind == sqlWord && !isClause
+}
+
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlQuotedIdent
+	sqlString
+	sqlNumber
+	sqlPunct
+)
+
+type sqlToken struct {
+	kind  sqlTokenKind
+	text  string
+	quote byte
+}
+
+func (t sqlToken) is(kind sqlTokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+// sqlDialect holds the lexing rules which differ between destinations
+type sqlDialect struct {
+	backslashEscapes bool // ClickHouse, BigQuery: 'it\'s'
+	nestedComments   bool // DuckDB, Postgres: /* /* */ */
+	hashComments     bool // ClickHouse: # comment
+	dollarQuotes     bool // DuckDB, Postgres: $tag$ string $tag$
+	tripleQuotes     bool // BigQuery: '''string'''
+}
+
+func sqlDialects() []sqlDialect {
+	dialects := make([]sqlDialect, 0, 32)
+	for i := 0; i < 32; i++ {
+		dialects = append(dialects, sqlDialect{
+			backslashEscapes: i&1 != 0,
+			nestedComments:   i&2 != 0,
+			hashComments:     i&4 != 0,
+			dollarQuotes:     i&8 != 0,
+			tripleQuotes:     i&16 != 0,
+		})
+	}
+	return dialects
+}
+
+// lexSQL splits a query into tokens, dropping whitespace and comments.
+// Words are lowercased. Quoted strings and identifiers hold their unescaped contents.
+func lexSQL(query string, dialect sqlDialect) ([]sqlToken, error) {
+	var tokens []sqlToken
+
+	i := 0
+	for i < len(query) {
+		c := query[i]
+
+		switch {
+		case isSQLSpace(c):
+			i++
+
+		case strings.HasPrefix(query[i:], "--") || (dialect.hashComments && c == '#'):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 1
+			}
+
+		case strings.HasPrefix(query[i:], "/*"):
+			depth := 0
+			for {
+				if i >= len(query) {
+					return nil, errors.New("unterminated comment")
+				}
+				if strings.HasPrefix(query[i:], "/*") {
+					if depth == 0 || dialect.nestedComments {
+						depth++
+					}
+					i += 2
+				} else if strings.HasPrefix(query[i:], "*/") {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+
+		case c == '\'' || c == '"' || c == '`':
+			delimiter := string(c)
+			if dialect.tripleQuotes && (c == '\'' || c == '"') && strings.HasPrefix(query[i:], strings.Repeat(delimiter, 3)) {
+				delimiter = strings.Repeat(delimiter, 3)
+			}
+
+			text, n, err := lexQuoted(query[i:], delimiter, dialect.backslashEscapes)
+			if err != nil {
+				return nil, err
+			}
+
+			kind := sqlQuotedIdent
+			if c == '\'' {
+				kind = sqlString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text, quote: c})
+			i += n
+
+		case dialect.dollarQuotes && c == '$' && dollarTag(query[i:]) != "":
+			tag := dollarTag(query[i:])
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, sqlToken{kind: sqlString, text: query[i+len(tag) : i+len(tag)+end], quote: '$'})
+			i += len(tag) + end + len(tag)
+
+		case isSQLWordChar(c) && !isSQLDigit(c):
+			start := i
+			for i < len(query) && isSQLWordChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: strings.ToLower(query[start:i])})
+
+		case isSQLDigit(c):
+			start := i
+			for i < len(query) && (isSQLWordChar(query[i]) || query[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: query[start:i]})
+
+		default:
+			tokens = append(tokens, sqlToken{kind: sqlPunct, text: string(c)})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// lexQuoted reads a quoted string or identifier starting with delimiter.
+// A doubled delimiter is an escaped delimiter. It returns the contents and the
+// number of bytes read.
+func lexQuoted(s string, delimiter string, backslashEscapes bool) (string, int, error) {
+	var text strings.Builder
+
+	i := len(delimiter)
+	for i < len(s) {
+		if backslashEscapes && s[i] == '\\' && i+1 < len(s) {
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+
+		if strings.HasPrefix(s[i:], delimiter) {
+			i += len(delimiter)
+			if len(delimiter) == 1 && strings.HasPrefix(s[i:], delimiter) {
+				text.WriteString(delimiter)
+				i++
+				continue
+			}
+			return text.String(), i, nil
+		}
+
+		text.WriteByte(s[i])
+		i++
+	}
+
+	return "", 0, errors.New("unterminated string")
+}
+
+// dollarTag returns the opening $tag$ of a dollar-quoted string, or "" if s does not start with one
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '$' {
+			return s[:i+1]
+		}
+		if !isSQLWordChar(s[i]) || (i == 1 && isSQLDigit(s[i])) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isSQLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSQLWordChar(c byte) bool {
+	return c == '_' || c == '$' || isSQLDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
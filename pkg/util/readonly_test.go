@@ -0,0 +1,71 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReadOnlyQuery(t *testing.T) {
+	allowed := []string{
+		"SELECT 1",
+		"select * from events;",
+		"  (SELECT a FROM t) UNION ALL (SELECT b FROM u)  ",
+		"WITH x AS (SELECT * FROM t) SELECT count(*) FROM x",
+		"SELECT 'drop table t; delete' AS s -- ; insert",
+		"SELECT replace(name, 'a', 'b'), t.delete FROM t WHERE x = 'it''s'",
+		"SELECT * FROM `project.dataset.table`",
+		"SELECT * FROM system.tables",
+		"SELECT * FROM a, b WHERE a.id = b.id",
+		"SELECT load, call, import FROM t WHERE export = 1",
+		"SELECT merge AS m, into FROM t ORDER BY load",
+		"SELECT a AS into, b into FROM t",
+		"SELECT DISTINCT into FROM t WHERE into > 0",
+		"SELECT count(load), max(call) FROM t GROUP BY export",
+		"WITH x AS (SELECT load FROM t) SELECT * FROM x",
+		"SELECT settings FROM t WHERE settings = 'x'",
+	}
+	for _, query := range allowed {
+		if err := CheckReadOnlyQuery(query); err != nil {
+			t.Errorf("Expected %q to be allowed; got %v", query, err)
+		}
+	}
+
+	rejected := []string{
+		"",
+		";",
+		"DROP TABLE events",
+		"SELECT 1; DROP TABLE events",
+		"SELECT 1; SELECT 2",
+		"INSERT INTO t SELECT 1",
+		"COPY (SELECT 1) TO 'out.csv'",
+		"WITH d AS (DELETE FROM t RETURNING *) SELECT * FROM d",
+		"SELECT * INTO new_table FROM t",
+		"SELECT a, b INTO TEMP new_table FROM t",
+		"SELECT * INTO \"new_table\" FROM t",
+		"SELECT * FROM t INTO OUTFILE 'out.csv'",
+		"WITH m AS (MERGE INTO t USING u ON t.id = u.id WHEN MATCHED THEN DO NOTHING) SELECT 1",
+		"WITH m AS MATERIALIZED (CALL p()) SELECT 1",
+		"LOAD httpfs",
+		"EXPORT DATABASE 'dir'",
+		"SELECT * FROM read_csv('/etc/passwd')",
+		"SELECT * FROM READ_PARQUET('s3://bucket/x.parquet')",
+		"SELECT * FROM \"read_csv\"('/etc/passwd')",
+		"SELECT * FROM url('http://example.com', CSV)",
+		"SELECT * FROM file('data.csv')",
+		"SELECT * FROM EXTERNAL_QUERY('project.us.connection', 'SELECT * FROM users')",
+		"SELECT * FROM t SETTINGS max_execution_time = 0",
+		"SELECT * FROM (SELECT * FROM t SETTINGS readonly = 0)",
+		"SELECT * FROM '/etc/passwd'",
+		"SELECT * FROM t JOIN \"data.csv\" USING (id)",
+		"SELECT * FROM t, 'data.csv'",
+		"SELECT 1 /* unterminated",
+		"SELECT 'a\\'; DROP TABLE t; --'",
+		"SELECT 1 /* /* */ ' */ ; DROP TABLE t; -- '",
+		"SELECT $$ ; $$; DROP TABLE t",
+	}
+	for _, query := range rejected {
+		if err := CheckReadOnlyQuery(query); !errors.Is(err, ErrQueryNotAllowed) {
+			t.Errorf("Expected %q to be rejected; got %v", query, err)
+		}
+	}
+}
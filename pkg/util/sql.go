@@ -2,9 +2,153 @@ package util
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
 	"strings"
 )
 
+// skipSQL returns the end of the quoted string, quoted identifier or comment
+// starting at query[i], or i if there is none. Quotes are escaped by doubling.
+func skipSQL(query string, i int) int {
+	c := query[i]
+	switch {
+	case c == '\'' || c == '"' || c == '`':
+		end := i + 1
+		for end < len(query) {
+			if query[end] == c {
+				if end+1 < len(query) && query[end+1] == c {
+					end += 2
+					continue
+				}
+				return end + 1
+			}
+			end++
+		}
+		return len(query)
+
+	case strings.HasPrefix(query[i:], "--"):
+		end := strings.IndexByte(query[i:], '\n')
+		if end < 0 {
+			return len(query)
+		}
+		return i + end
+
+	case strings.HasPrefix(query[i:], "/*"):
+		end := strings.Index(query[i+2:], "*/")
+		if end < 0 {
+			return len(query)
+		}
+		return i + 2 + end + 2
+	}
+
+	return i
+}
+
+// NormalizeQuery trims a query, removes comments and collapses whitespace
+// outside of strings so that trivially different queries compare equal
+func NormalizeQuery(query string) string {
+	query = TrimQuery(query)
+
+	var out strings.Builder
+	space := false
+	i := 0
+	for i < len(query) {
+		c := query[i]
+
+		if end := skipSQL(query, i); end > i {
+			if c == '-' || c == '/' {
+				space = true
+			} else {
+				if space && out.Len() > 0 {
+					out.WriteByte(' ')
+				}
+				space = false
+				out.WriteString(query[i:end])
+			}
+			i = end
+			continue
+		}
+
+		if isSQLSpace(c) {
+			space = true
+		} else {
+			if space && out.Len() > 0 {
+				out.WriteByte(' ')
+			}
+			space = false
+			out.WriteByte(c)
+		}
+		i++
+	}
+
+	return out.String()
+}
+
+// QueryTables returns the lowercased names of the tables a query reads from,
+// without schema or database prefixes. Names which cannot be parsed are skipped.
+func QueryTables(query string) []string {
+	tokens, err := lexSQL(query, sqlDialect{})
+	if err != nil {
+		return nil
+	}
+
+	var tables []string
+	seen := map[string]bool{}
+	clauses := []string{""}
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		if token.kind == sqlPunct {
+			switch token.text {
+			case "(":
+				clauses = append(clauses, "")
+			case ")":
+				if len(clauses) > 1 {
+					clauses = clauses[:len(clauses)-1]
+				}
+			}
+		}
+		if clause, ok := clauseKeywords[token.text]; ok && token.kind == sqlWord {
+			clauses[len(clauses)-1] = clause
+		}
+
+		if token.kind != sqlWord && token.kind != sqlQuotedIdent || i == 0 {
+			continue
+		}
+
+		prev := tokens[i-1]
+		tablePosition := prev.is(sqlWord, "from") || prev.is(sqlWord, "join") ||
+			(prev.is(sqlPunct, ",") && clauses[len(clauses)-1] == "from")
+		if !tablePosition {
+			continue
+		}
+
+		// Follow schema.table and database.schema.table to the table name
+		name := token.text
+		for i+2 < len(tokens) && tokens[i+1].is(sqlPunct, ".") &&
+			(tokens[i+2].kind == sqlWord || tokens[i+2].kind == sqlQuotedIdent) {
+			i += 2
+			name = tokens[i].text
+		}
+
+		if i+1 < len(tokens) && tokens[i+1].is(sqlPunct, "(") {
+			// Table function
+			continue
+		}
+
+		// BigQuery quotes the whole path: `project.dataset.table`
+		name = strings.ToLower(name[strings.LastIndexByte(name, '.')+1:])
+		if !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+
+	return tables
+}
+
 // Trims whitespace and trailing ; characters from sql
 func TrimQuery(query string) string {
 	trimmed := strings.TrimSpace(query)
@@ -12,6 +156,46 @@ func TrimQuery(query string) string {
 	return semi
 }
 
+// Table names are plain identifiers, optionally prefixed with a dataset or schema
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+var columnNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidTableName is true for names which are safe to use in DDL without quoting rules
+func ValidTableName(name string) bool {
+	return tableNamePattern.MatchString(name)
+}
+
+// ErrQualifiedTable is returned by destinations whose tables all live in the
+// configured database or schema, for names with a dataset or schema prefix
+var ErrQualifiedTable = errors.New("table names cannot include a schema for this destination")
+
+// CheckUnqualifiedTable returns ErrQualifiedTable if any name has a prefix.
+// Destinations quote the name as one identifier, so a.b would otherwise
+// refer to a table named "a.b".
+func CheckUnqualifiedTable(names ...string) error {
+	for _, name := range names {
+		if strings.Contains(name, ".") {
+			return fmt.Errorf("%w: %s", ErrQualifiedTable, name)
+		}
+	}
+	return nil
+}
+
+// ValidColumnName is true for plain identifiers, which every destination accepts
+func ValidColumnName(name string) bool {
+	return columnNamePattern.MatchString(name)
+}
+
+// CheckFilter returns an error wrapping ErrQueryNotAllowed unless filter is a
+// single expression which can be used as a WHERE clause
+func CheckFilter(filter string) error {
+	if strings.TrimSpace(filter) == "" {
+		return fmt.Errorf("%w: filter is empty", ErrQueryNotAllowed)
+	}
+	return CheckReadOnlyQuery("SELECT 1 FROM t WHERE (" + filter + ")")
+}
+
 // Takes a string and returns a JSON-escaped version
 func JsonEscape(i string) string {
 	b, err := json.Marshal(i)
@@ -21,3 +205,71 @@ func JsonEscape(i string) string {
 	// Trim the beginning and trailing " character
 	return string(b[1 : len(b)-1])
 }
+
+// Keywords which change which rows a query returns or in what order
+var reshapingKeywords = map[string]bool{
+	"order": true, "group": true, "limit": true, "offset": true, "fetch": true, "top": true,
+	"union": true, "intersect": true, "except": true, "join": true, "distinct": true,
+	"having": true, "qualify": true, "window": true, "sample": true, "with": true,
+}
+
+// SelectStarTable returns the table for queries of the form
+// SELECT * FROM table [WHERE ...], which return the table's columns in no
+// particular order. The name is lowercased and without schema prefixes.
+func SelectStarTable(query string) (string, bool) {
+	tokens, err := lexSQL(TrimQuery(query), sqlDialect{})
+	if err != nil || len(tokens) < 4 {
+		return "", false
+	}
+
+	if !tokens[0].is(sqlWord, "select") || !tokens[1].is(sqlPunct, "*") || !tokens[2].is(sqlWord, "from") {
+		return "", false
+	}
+
+	for _, token := range tokens {
+		if token.kind == sqlWord && reshapingKeywords[token.text] || token.is(sqlPunct, ";") {
+			return "", false
+		}
+	}
+
+	i := 3
+	for {
+		if tokens[i].kind != sqlWord && tokens[i].kind != sqlQuotedIdent {
+			return "", false
+		}
+		if i+2 < len(tokens) && tokens[i+1].is(sqlPunct, ".") {
+			i += 2
+			continue
+		}
+		break
+	}
+
+	if i+1 < len(tokens) && !tokens[i+1].is(sqlWord, "where") {
+		return "", false
+	}
+
+	name := tokens[i].text
+	return strings.ToLower(name[strings.LastIndexByte(name, '.')+1:]), true
+}
+
+// HasOrderBy is true if the query's result is sorted, that is if it has an
+// ORDER BY outside of any parentheses
+func HasOrderBy(query string) bool {
+	tokens, err := lexSQL(TrimQuery(query), sqlDialect{})
+	if err != nil {
+		return false
+	}
+
+	depth := 0
+	for i, token := range tokens {
+		switch {
+		case token.is(sqlPunct, "("):
+			depth++
+		case token.is(sqlPunct, ")"):
+			depth--
+		case depth == 0 && token.is(sqlWord, "order") && i+1 < len(tokens) && tokens[i+1].is(sqlWord, "by"):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package util
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := map[string]string{
+		"SELECT  *\n\tFROM t;":                    "SELECT * FROM t",
+		"select a -- comment\nfrom t /* note */ ": "select a from t",
+		"SELECT 'a  b',\"x  y\"  FROM t":          "SELECT 'a  b',\"x  y\" FROM t",
+		"SELECT 'it''s   here'":                   "SELECT 'it''s   here'",
+		"  /* leading */ SELECT 1":                "SELECT 1",
+	}
+
+	for query, expected := range tests {
+		if got := NormalizeQuery(query); got != expected {
+			t.Errorf("%q: expected %q; got %q", query, expected, got)
+		}
+	}
+}
+
+func TestQueryTables(t *testing.T) {
+	tests := map[string][]string{
+		"SELECT * FROM events": {"events"},
+		"SELECT * FROM db.Events e JOIN \"Users\" u ON e.id = u.id":       {"events", "users"},
+		"SELECT * FROM a, b WHERE a.x IN (SELECT x FROM c)":               {"a", "b", "c"},
+		"SELECT * FROM `project.dataset.sales`":                           {"sales"},
+		"SELECT * FROM read_csv('x.csv')":                                 nil,
+		"WITH x AS (SELECT * FROM t) SELECT * FROM x, generate_series(1)": {"t", "x"},
+	}
+
+	for query, expected := range tests {
+		if got := QueryTables(query); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%q: expected %v; got %v", query, expected, got)
+		}
+	}
+}
+
+func TestSelectStarTable(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM events":                       "events",
+		"select * from main.Events where x = 1;":     "events",
+		"SELECT * FROM `project.dataset.sales`":      "sales",
+		"SELECT a FROM events":                       "",
+		"SELECT * FROM events ORDER BY ts":           "",
+		"SELECT * FROM events e":                     "",
+		"SELECT * FROM a JOIN b ON a.id = b.id":      "",
+		"SELECT * FROM events LIMIT 10":              "",
+		"SELECT * FROM read_csv('x.csv')":            "",
+		"SELECT * FROM events WHERE id IN (1, 2, 3)": "events",
+	}
+
+	for query, expected := range tests {
+		table, ok := SelectStarTable(query)
+		if table != expected || ok != (expected != "") {
+			t.Errorf("%q: expected %q; got %q, %v", query, expected, table, ok)
+		}
+	}
+}
+
+func TestHasOrderBy(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT * FROM events ORDER BY ts":                       true,
+		"select a from t order by a desc limit 10;":              true,
+		"SELECT a FROM t UNION ALL SELECT b FROM u ORDER BY 1":   true,
+		"SELECT * FROM events":                                   false,
+		"SELECT * FROM (SELECT * FROM events ORDER BY ts) AS e":  false,
+		"SELECT row_number() OVER (ORDER BY ts) FROM events":     false,
+		"WITH x AS (SELECT * FROM t ORDER BY a) SELECT * FROM x": false,
+		"SELECT 'order by' AS s FROM events -- ORDER BY ts":      false,
+		"SELECT \"order\", \"by\" FROM events":                   false,
+	}
+
+	for query, expected := range tests {
+		if got := HasOrderBy(query); got != expected {
+			t.Errorf("%q: expected %v; got %v", query, expected, got)
+		}
+	}
+}
+
+func TestCheckFilter(t *testing.T) {
+	allowed := []string{
+		"user_id = {user_id}",
+		"email = 'a@example.com' OR email LIKE '%;%'",
+		"ts < now() - INTERVAL 30 DAY",
+	}
+	for _, filter := range allowed {
+		if err := CheckFilter(filter); err != nil {
+			t.Errorf("%q: expected no error; got %v", filter, err)
+		}
+	}
+
+	rejected := []string{
+		"",
+		"1 = 1; DROP TABLE users",
+		"1 = 1); DELETE FROM other WHERE (1 = 1",
+		"id IN (SELECT id FROM read_csv('/etc/passwd'))",
+	}
+	for _, filter := range rejected {
+		if err := CheckFilter(filter); !errors.Is(err, ErrQueryNotAllowed) {
+			t.Errorf("%q: expected ErrQueryNotAllowed; got %v", filter, err)
+		}
+	}
+}
+
+func TestValidTableName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"events":           true,
+		"dataset.events_2": true,
+		"2events":          false,
+		"a.b.c":            false,
+		`events"; drop`:    false,
+		"":                 false,
+	} {
+		if ValidTableName(name) != valid {
+			t.Errorf("%q: expected %v", name, valid)
+		}
+	}
+}
+
+func TestCheckUnqualifiedTable(t *testing.T) {
+	if err := CheckUnqualifiedTable("events", "events_2"); err != nil {
+		t.Errorf("Expected plain names to pass, got %v", err)
+	}
+	if err := CheckUnqualifiedTable("events", "main.events"); !errors.Is(err, ErrQualifiedTable) {
+		t.Errorf("Expected ErrQualifiedTable, got %v", err)
+	}
+}
@@ -3,13 +3,74 @@ package util
 import (
 	"bufio"
 	"io"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/models"
 	"github.com/tidwall/gjson"
 )
 
+// TypeDetection turns on inference of types which JSON has no syntax for.
+// Destinations enable it with their detect_types setting.
+type TypeDetection struct {
+	Enabled bool `mapstructure:"detect_types"`
+
+	// Integer columns ending with one of these suffixes, or named in
+	// EpochMillisColumns, hold Unix times in milliseconds
+	EpochMillisSuffixes []string `mapstructure:"epoch_millis_suffixes"`
+	EpochMillisColumns  []string `mapstructure:"epoch_millis_columns"`
+}
+
+// IsEpochMillis is true if column is configured to hold Unix times in milliseconds
+func (d TypeDetection) IsEpochMillis(column string) bool {
+	for _, name := range d.EpochMillisColumns {
+		if name == column {
+			return true
+		}
+	}
+	for _, suffix := range d.EpochMillisSuffixes {
+		if suffix != "" && strings.HasSuffix(column, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+\.[0-9]+$`)
+
+// detectStringType returns the detected type of a string value, or "string"
+func detectStringType(value string) string {
+	if _, err := time.Parse(coercedDateLayout, value); err == nil {
+		return "date"
+	}
+	for _, layout := range timestampLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return "timestamp"
+		}
+	}
+	if len(value) == 36 {
+		if _, err := uuid.Parse(value); err == nil {
+			return "uuid"
+		}
+	}
+	if decimalPattern.MatchString(value) {
+		return "decimal"
+	}
+	return "string"
+}
+
 func GetJSONTypes(file io.ReadSeeker) (map[string]string, error) {
+	return GetJSONTypesWithDetection(file, TypeDetection{})
+}
+
+// GetJSONTypesWithDetection infers the JSON type of each column of an NDJSON
+// file. With detection enabled, string columns whose values are all timestamps,
+// dates, UUIDs or decimals, and epoch millisecond columns, have those types.
+func GetJSONTypesWithDetection(file io.ReadSeeker, detection TypeDetection) (map[string]string, error) {
 	rc := map[string]string{}
 	typeCounts := map[string]map[string]int{}
 
@@ -35,6 +96,9 @@ func GetJSONTypes(file io.ReadSeeker) (map[string]string, error) {
 			switch value.Type {
 			case gjson.String:
 				typeCounts[k]["string"] += 1
+				if detection.Enabled {
+					typeCounts[k][detectStringType(value.Str)] += 1
+				}
 			case gjson.Null:
 				typeCounts[k]["null"] += 1
 			case gjson.False:
@@ -64,7 +128,7 @@ func GetJSONTypes(file io.ReadSeeker) (map[string]string, error) {
 
 	for colName, colTypeCounts := range typeCounts {
 		if colTypeCounts["string"] > 0 {
-			rc[colName] = "string"
+			rc[colName] = detectedType(colTypeCounts)
 			continue
 		} else if colTypeCounts["undefined"] > 0 {
 			rc[colName] = "string"
@@ -74,6 +138,9 @@ func GetJSONTypes(file io.ReadSeeker) (map[string]string, error) {
 			continue
 		} else if colTypeCounts["int"] > 0 {
 			rc[colName] = "int"
+			if detection.Enabled && detection.IsEpochMillis(colName) {
+				rc[colName] = "timestamp"
+			}
 			continue
 		} else if colTypeCounts["bool"] > 0 {
 			rc[colName] = "bool"
@@ -87,3 +154,95 @@ func GetJSONTypes(file io.ReadSeeker) (map[string]string, error) {
 
 	return rc, nil
 }
+
+// detectedType is the type of a column with string values. It is only
+// something other than "string" if every non-null value was detected as it.
+// Dates and timestamps mixed together are timestamps.
+func detectedType(counts map[string]int) string {
+	if counts["undefined"]+counts["float"]+counts["int"]+counts["bool"] > 0 {
+		return "string"
+	}
+
+	switch counts["string"] {
+	case counts["date"]:
+		return "date"
+	case counts["timestamp"] + counts["date"]:
+		return "timestamp"
+	case counts["uuid"]:
+		return "uuid"
+	case counts["decimal"]:
+		return "decimal"
+	}
+	return "string"
+}
+
+// DetectedColumnType is the column type for a JSON type which only
+// GetJSONTypesWithDetection returns
+func DetectedColumnType(jsonType string) (models.ColumnType, bool) {
+	switch jsonType {
+	case "timestamp":
+		return models.ColumnType{Kind: models.KindTimestamp}, true
+	case "date":
+		return models.ColumnType{Kind: models.KindDate}, true
+	case "uuid":
+		return models.ColumnType{Kind: models.KindUUID}, true
+	case "decimal":
+		return models.ColumnType{Kind: models.KindDecimal, Precision: models.MaxDecimalPrecision, Scale: 9}, true
+	}
+	return models.ColumnType{}, false
+}
+
+// JSONTypeForColumn maps a database column type back to the JSON type which
+// GetJSONTypes would infer for its values. Types without a JSON equivalent,
+// such as timestamps and nested types, are strings.
+func JSONTypeForColumn(databaseType string) string {
+	t := unwrapColumnType(databaseType)
+
+	switch {
+	case strings.HasPrefix(t, "DECIMAL"), strings.HasPrefix(t, "NUMERIC"), strings.HasPrefix(t, "BIGNUMERIC"):
+		return "float"
+	case strings.ContainsAny(t, "[(<"):
+		// Arrays, structs, maps, sized strings and timestamps with a precision
+		return "string"
+	case strings.HasPrefix(t, "BOOL"):
+		return "bool"
+	case strings.HasPrefix(t, "INTERVAL"), strings.HasPrefix(t, "POINT"):
+		return "string"
+	case strings.Contains(t, "INT"):
+		return "int"
+	case strings.Contains(t, "FLOAT"), strings.Contains(t, "DOUBLE"), t == "REAL":
+		return "float"
+	default:
+		return "string"
+	}
+}
+
+// DetectedTypeForColumn maps a database column type back to the type which
+// GetJSONTypesWithDetection would detect for its values, or "" if there is none
+func DetectedTypeForColumn(databaseType string) string {
+	t := unwrapColumnType(databaseType)
+
+	switch {
+	case strings.HasPrefix(t, "TIMESTAMP"), strings.HasPrefix(t, "DATETIME"):
+		return "timestamp"
+	case strings.HasPrefix(t, "DATE"):
+		return "date"
+	case t == "UUID":
+		return "uuid"
+	case strings.HasPrefix(t, "DECIMAL"), strings.HasPrefix(t, "NUMERIC"), strings.HasPrefix(t, "BIGNUMERIC"):
+		return "decimal"
+	}
+	return ""
+}
+
+// unwrapColumnType upper-cases a database type and removes ClickHouse's
+// wrappers, as in Nullable(Int64) and LowCardinality(String)
+func unwrapColumnType(databaseType string) string {
+	t := strings.ToUpper(strings.TrimSpace(databaseType))
+	for _, wrapper := range []string{"NULLABLE(", "LOWCARDINALITY("} {
+		for strings.HasPrefix(t, wrapper) && strings.HasSuffix(t, ")") {
+			t = t[len(wrapper) : len(t)-1]
+		}
+	}
+	return t
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONTypeForColumn(t *testing.T) {
+	expected := map[string]string{
+		"BIGINT":                       "int",
+		"Nullable(UInt64)":             "int",
+		"INTEGER":                      "int",
+		"double precision":             "float",
+		"Float64":                      "float",
+		"Decimal(10, 2)":               "float",
+		"NUMERIC":                      "float",
+		"BOOLEAN":                      "bool",
+		"Bool":                         "bool",
+		"VARCHAR":                      "string",
+		"character varying(256)":       "string",
+		"LowCardinality(String)":       "string",
+		"TIMESTAMP":                    "string",
+		"DateTime64(6, 'UTC')":         "string",
+		"INTERVAL":                     "string",
+		"Array(Int64)":                 "string",
+		"BIGINT[]":                     "string",
+		"STRUCT(a INTEGER, b VARCHAR)": "string",
+		"RECORD":                       "string",
+	}
+
+	for databaseType, want := range expected {
+		if got := JSONTypeForColumn(databaseType); got != want {
+			t.Errorf("%s: expected %s; got %s", databaseType, want, got)
+		}
+	}
+}
+
+func TestGetJSONTypesWithDetection(t *testing.T) {
+	input := `{"ts": "2024-01-02T03:04:05Z", "day": "2024-01-02", "id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "price": "12.50", "created_ms": 1704164645123, "latency_ms": 12, "zip": "02134"}
+{"ts": "2024-01-02", "day": null, "id": "6ba7b810-9dad-11d1-80b4-00c04fd430c9", "price": "-3.1", "created_ms": 1704164645124, "latency_ms": 15, "zip": "10001"}
+`
+	detection := TypeDetection{Enabled: true, EpochMillisColumns: []string{"created_ms"}}
+
+	types, err := GetJSONTypesWithDetection(strings.NewReader(input), detection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"ts":         "timestamp",
+		"day":        "date",
+		"id":         "uuid",
+		"price":      "decimal",
+		"created_ms": "timestamp",
+		"latency_ms": "int",
+		"zip":        "string",
+	}
+	for column, want := range expected {
+		if types[column] != want {
+			t.Errorf("%s: expected %s; got %s", column, want, types[column])
+		}
+	}
+
+	plain, err := GetJSONTypes(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain["ts"] != "string" || plain["created_ms"] != "int" {
+		t.Errorf("types should not be detected unless enabled, got %v", plain)
+	}
+}
+
+func TestDetectedTypeForColumn(t *testing.T) {
+	expected := map[string]string{
+		"TIMESTAMP":                   "timestamp",
+		"timestamp without time zone": "timestamp",
+		"DateTime64(6, 'UTC')":        "timestamp",
+		"Nullable(Date32)":            "date",
+		"DATE":                        "date",
+		"UUID":                        "uuid",
+		"DECIMAL(38,9)":               "decimal",
+		"BIGNUMERIC":                  "decimal",
+		"VARCHAR":                     "",
+		"BIGINT":                      "",
+	}
+
+	for databaseType, want := range expected {
+		if got := DetectedTypeForColumn(databaseType); got != want {
+			t.Errorf("%s: expected %q; got %q", databaseType, want, got)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package view
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/foolin/goview"
 	"github.com/go-chi/chi/v5"
 	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/storage/database"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
 	"github.com/scratchdata/scratchdata/templates"
 )
@@ -14,12 +16,27 @@ type Model struct {
 	Email string
 }
 
+// QueueModel is the queue page: the depth of each destination's queue and
+// the age of its oldest message, by message type and status
+type QueueModel struct {
+	Model
+	Rows []QueueRow
+}
+
+type QueueRow struct {
+	DestinationID uint
+	MessageType   models.MessageType
+	Status        models.MessageStatus
+	Messages      int64
+	Age           time.Duration
+}
+
 func embeddedFH(config goview.Config, tmpl string) (string, error) {
 	bytes, err := templates.Templates.ReadFile(tmpl + config.Extension)
 	return string(bytes), err
 }
 
-func New(c config.DashboardConfig, auth func(h http.Handler) http.Handler) (*chi.Mux, error) {
+func New(c config.DashboardConfig, auth func(h http.Handler) http.Handler, db database.Database) (*chi.Mux, error) {
 	r := chi.NewRouter()
 
 	// TODO: Want to be able to disable this for quick local dev
@@ -73,5 +90,45 @@ func New(c config.DashboardConfig, auth func(h http.Handler) http.Handler) (*chi
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	})
+
+	// The queue page only shows the destinations of the user's team
+	r.Get("/queue", func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value("user").(*models.User)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		owned := map[uint]bool{}
+		for _, dest := range db.GetDestinations(r.Context(), user.ID) {
+			owned[uint(dest.ID)] = true
+		}
+
+		stats, err := db.QueueStats()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		model := QueueModel{Model: loadModel(r)}
+		now := time.Now()
+		for _, s := range stats {
+			if !owned[s.DestinationID] {
+				continue
+			}
+			model.Rows = append(model.Rows, QueueRow{
+				DestinationID: s.DestinationID,
+				MessageType:   s.MessageType,
+				Status:        s.Status,
+				Messages:      s.Messages,
+				Age:           now.Sub(s.OldestAt).Round(time.Second),
+			})
+		}
+
+		err = gv.Render(w, http.StatusOK, "pages/queue/index", model)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
 	return r, nil
 }
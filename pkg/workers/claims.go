@@ -0,0 +1,67 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+const defaultVisibilityTimeout = 10 * time.Minute
+
+var errAbandoned = errors.New("message was claimed and abandoned too many times")
+
+func (w *ScratchDataWorker) visibilityTimeout() time.Duration {
+	if w.Config.VisibilityTimeoutSeconds > 0 {
+		return time.Duration(w.Config.VisibilityTimeoutSeconds) * time.Second
+	}
+	return defaultVisibilityTimeout
+}
+
+// heartbeat renews the claim on a message three times per visibility timeout
+// until stop is closed, so that long loads are not reclaimed from a live worker.
+// It closes lost if the message was reclaimed anyway.
+func (w *ScratchDataWorker) heartbeat(threadId int, item *models.Message, workerLabel string, stop <-chan struct{}, lost chan<- struct{}) {
+	ticker := time.NewTicker(w.visibilityTimeout() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			claimed, err := w.StorageServices.Database.Heartbeat(item.ID, workerLabel)
+			if err != nil {
+				log.Error().Err(err).Int("thread", threadId).Uint("message_id", item.ID).Msg("Unable to renew claim on message")
+			} else if !claimed {
+				log.Warn().Int("thread", threadId).Uint("message_id", item.ID).Msg("Message was reclaimed while it was being processed")
+				close(lost)
+				return
+			}
+		}
+	}
+}
+
+// reapAbandoned returns messages whose worker stopped sending heartbeats to the
+// queue. Every node runs one, so no single node going down stops the queue.
+func (w *ScratchDataWorker) reapAbandoned(ctx context.Context) {
+	timeout := w.visibilityTimeout()
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reclaimed, err := w.StorageServices.Database.ReclaimExpired(time.Now().Add(-timeout))
+			if err != nil {
+				log.Error().Err(err).Msg("Unable to reclaim abandoned messages")
+			} else if reclaimed > 0 {
+				log.Warn().Int64("messages", reclaimed).Msg("Returned abandoned messages to the queue")
+			}
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/storage/cache"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	models2 "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const defaultCopyChunkRows = 100_000
+
+var errCopyJobCancelled = errors.New("copy job was cancelled")
+
+// CopyChunkKey is where a chunk of a copy job's rows is stored in the blob store
+func CopyChunkKey(job models.CopyJob, number int) string {
+	return fmt.Sprintf("copy_jobs/%d/%s/%05d.ndjson", job.SourceID, job.UUID, number)
+}
+
+func (w *ScratchDataWorker) copyChunkRows() int64 {
+	if w.Config.CopyChunkRows > 0 {
+		return int64(w.Config.CopyChunkRows)
+	}
+	return defaultCopyChunkRows
+}
+
+// processCopyJob exports a copy job's source to chunks in the blob store and
+// loads them into the target. The job stays running while a failed attempt is
+// retried, and the next attempt skips the chunks which were already loaded.
+func (w *ScratchDataWorker) processCopyJob(threadId int, item *models.Message) error {
+	ctx := context.TODO()
+
+	var message models2.CopyJobMessage
+	if err := json.Unmarshal([]byte(item.Message), &message); err != nil {
+		return fmt.Errorf("%w: unable to decode message: %s", errPermanent, err)
+	}
+
+	jobId, err := uuid.Parse(message.JobID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid copy job ID: %s", errPermanent, err)
+	}
+
+	job, ok := w.StorageServices.Database.GetCopyJob(ctx, jobId)
+	if !ok || job.Finished() {
+		// Cancelled before it started
+		return nil
+	}
+
+	if job.Status == models.JobQueued {
+		now := time.Now()
+		job.Status = models.JobRunning
+		job.StartedAt = &now
+		updated, err := w.StorageServices.Database.UpdateCopyJob(ctx, &job, models.JobQueued)
+		if err != nil || !updated {
+			return err
+		}
+	}
+
+	copyCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go watchCancellation(copyCtx, cancel, func() bool {
+		current, ok := w.StorageServices.Database.GetCopyJob(copyCtx, jobId)
+		return ok && current.Status == models.JobCancelled
+	})
+
+	err = w.runCopyJob(copyCtx, threadId, &job)
+	if errors.Is(err, errCopyJobCancelled) || (err != nil && copyCtx.Err() != nil) {
+		log.Info().Int("thread", threadId).Str("job_id", job.UUID).Msg("Copy job cancelled")
+		w.cleanUpCopyJob(ctx, threadId, job)
+		return nil
+	}
+
+	if err == nil {
+		finished := time.Now()
+		job.Status = models.JobSucceeded
+		job.FinishedAt = &finished
+		job.Error = ""
+	} else {
+		job.Error = err.Error()
+		if errors.Is(err, errPermanent) || item.Attempts >= w.maxAttempts() {
+			finished := time.Now()
+			job.Status = models.JobFailed
+			job.FinishedAt = &finished
+		}
+	}
+
+	if _, updateErr := w.StorageServices.Database.UpdateCopyJob(ctx, &job, models.JobRunning); updateErr != nil {
+		log.Error().Err(updateErr).Int("thread", threadId).Str("job_id", job.UUID).Msg("Unable to update copy job")
+	}
+
+	// The chunks are only needed to resume the job
+	if job.Finished() {
+		w.cleanUpCopyJob(ctx, threadId, job)
+	}
+
+	return err
+}
+
+// runCopyJob exports the source unless that has already been done, then loads
+// each chunk which has not been loaded yet
+func (w *ScratchDataWorker) runCopyJob(ctx context.Context, threadId int, job *models.CopyJob) error {
+	if !job.Exported {
+		// Queries need not return rows in the same order each time, so an
+		// interrupted export starts again. None of its chunks were loaded.
+		if err := w.deleteCopyChunks(ctx, threadId, *job); err != nil {
+			return err
+		}
+
+		rows, err := w.exportCopyJob(ctx, threadId, *job)
+		if err != nil {
+			return err
+		}
+
+		job.Exported = true
+		job.Rows = rows
+		if err := w.saveCopyJob(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	target, err := w.destinationManager.Destination(ctx, job.TargetID)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := w.StorageServices.Database.GetCopyChunks(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+
+	err = target.CreateEmptyTable(job.Table)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.LoadedAt != nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := w.loadCopyChunk(threadId, target, *job, chunk); err != nil {
+			return err
+		}
+		if err := w.StorageServices.Database.MarkCopyChunkLoaded(ctx, chunk.ID); err != nil {
+			return err
+		}
+
+		job.LoadedRows += chunk.Rows
+		if err := w.saveCopyJob(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	if w.StorageServices.Cache != nil {
+		err = cache.InvalidateTable(w.StorageServices.Cache, job.TargetID, job.Table)
+		if err != nil {
+			log.Error().Err(err).Int("thread", threadId).Str("table", job.Table).Msg("Unable to invalidate cached queries")
+		}
+	}
+
+	return nil
+}
+
+// saveCopyJob records the job's progress, failing if it has been cancelled
+func (w *ScratchDataWorker) saveCopyJob(ctx context.Context, job *models.CopyJob) error {
+	updated, err := w.StorageServices.Database.UpdateCopyJob(ctx, job, models.JobRunning)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return errCopyJobCancelled
+	}
+	return nil
+}
+
+// exportCopyJob streams the source query as NDJSON into chunks of the
+// configured number of rows, uploading each to the blob store as it fills.
+// Rows are given a __row_id if they do not have one, so that a target with
+// dedupe_row_id set can collapse a chunk which is loaded twice. It returns the
+// number of rows exported.
+func (w *ScratchDataWorker) exportCopyJob(ctx context.Context, threadId int, job models.CopyJob) (int64, error) {
+	source, err := w.destinationManager.Destination(ctx, job.SourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	reader, writer := io.Pipe()
+	defer reader.Close()
+	go func() {
+		writer.CloseWithError(source.Query(ctx, job.Query, job.Params, dataModels.FormatNDJSON, writer))
+	}()
+
+	var total int64
+	uploaded := 0
+	chunk := &copyChunkFile{job: job, number: 1}
+	defer func() { chunk.remove() }()
+
+	lines := bufio.NewReader(reader)
+	for {
+		line, readErr := lines.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return total, readErr
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			if !gjson.GetBytes(line, "__row_id").Exists() {
+				line, err = sjson.SetBytes(line, "__row_id", w.snow.Generate().Int64())
+				if err != nil {
+					return total, err
+				}
+			}
+
+			if err := chunk.write(w.Config.DataDirectory, line); err != nil {
+				return total, err
+			}
+			total++
+
+			if chunk.rows >= w.copyChunkRows() {
+				if err := w.uploadCopyChunk(ctx, chunk); err != nil {
+					return total, err
+				}
+				uploaded++
+				chunk = &copyChunkFile{job: job, number: chunk.number + 1}
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if chunk.rows > 0 {
+		if err := w.uploadCopyChunk(ctx, chunk); err != nil {
+			return total, err
+		}
+		uploaded++
+	}
+
+	log.Debug().Int("thread", threadId).Str("job_id", job.UUID).Int64("rows", total).Int("chunks", uploaded).Msg("Exported copy job")
+	return total, nil
+}
+
+// copyChunkFile is a local file collecting the rows of one chunk
+type copyChunkFile struct {
+	job    models.CopyJob
+	number int
+	file   *os.File
+	writer *bufio.Writer
+	rows   int64
+}
+
+func (c *copyChunkFile) write(directory string, row []byte) error {
+	if c.file == nil {
+		fileName := fmt.Sprintf("copy_%s_%05d.ndjson", c.job.UUID, c.number)
+		file, err := os.Create(filepath.Join(directory, fileName))
+		if err != nil {
+			return err
+		}
+		c.file = file
+		c.writer = bufio.NewWriter(file)
+	}
+
+	c.writer.Write(row)
+	c.rows++
+	return c.writer.WriteByte('\n')
+}
+
+// remove closes and deletes the local file, once uploaded or on failure
+func (c *copyChunkFile) remove() {
+	if c.file == nil {
+		return
+	}
+	c.file.Close()
+	os.Remove(c.file.Name())
+	c.file = nil
+}
+
+func (w *ScratchDataWorker) uploadCopyChunk(ctx context.Context, chunk *copyChunkFile) error {
+	defer chunk.remove()
+
+	if err := chunk.writer.Flush(); err != nil {
+		return err
+	}
+	if _, err := chunk.file.Seek(0, 0); err != nil {
+		return err
+	}
+
+	key := CopyChunkKey(chunk.job, chunk.number)
+	if err := w.StorageServices.BlobStore.Upload(key, chunk.file); err != nil {
+		return err
+	}
+
+	return w.StorageServices.Database.AddCopyChunk(ctx, &models.CopyChunk{
+		CopyJobID: chunk.job.ID,
+		Number:    chunk.number,
+		Key:       key,
+		Rows:      chunk.rows,
+	})
+}
+
+// loadCopyChunk downloads a chunk and loads it into the target table
+func (w *ScratchDataWorker) loadCopyChunk(threadId int, target destinations.Destination, job models.CopyJob, chunk models.CopyChunk) error {
+	filePath := filepath.Join(w.Config.DataDirectory, fmt.Sprintf("copy_%s_%05d.ndjson", job.UUID, chunk.Number))
+	err := w.downloadFile(filePath, chunk.Key)
+	defer func() {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Int("thread", threadId).Str("filename", filePath).Msg("Unable to remove temp file")
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	err = target.CreateColumns(job.Table, filePath)
+	if err != nil {
+		return err
+	}
+
+	return target.InsertFromNDJsonFile(job.Table, filePath)
+}
+
+// cleanUpCopyJob deletes the chunks of a job which has finished
+func (w *ScratchDataWorker) cleanUpCopyJob(ctx context.Context, threadId int, job models.CopyJob) {
+	if err := w.deleteCopyChunks(ctx, threadId, job); err != nil {
+		log.Error().Err(err).Int("thread", threadId).Str("job_id", job.UUID).Msg("Unable to delete copy chunks")
+	}
+}
+
+// deleteCopyChunks removes a job's chunks from the blob store and the database.
+// Blobs which cannot be deleted are logged and left behind.
+func (w *ScratchDataWorker) deleteCopyChunks(ctx context.Context, threadId int, job models.CopyJob) error {
+	chunks, err := w.StorageServices.Database.GetCopyChunks(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	for _, chunk := range chunks {
+		if err := w.StorageServices.BlobStore.Delete(chunk.Key); err != nil {
+			log.Error().Err(err).Int("thread", threadId).Str("key", chunk.Key).Msg("Unable to delete copy chunk")
+		}
+	}
+
+	return w.StorageServices.Database.DeleteCopyChunks(ctx, job.ID)
+}
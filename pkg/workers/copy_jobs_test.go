@@ -0,0 +1,268 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/storage"
+	"github.com/scratchdata/scratchdata/pkg/storage/blobstore/memory"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/static"
+	models2 "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+	"github.com/tidwall/gjson"
+)
+
+// copyDestination returns rows from Query and records the rows loaded into it.
+// The load numbered failAt fails, and onInsert is called before each load.
+type copyDestination struct {
+	destinations.Destination
+	rows []string
+
+	queries  int
+	inserts  int
+	failAt   int
+	onInsert func()
+	loaded   []string
+}
+
+func (d *copyDestination) Query(ctx context.Context, query string, params dataModels.Params, format dataModels.Format, writer io.Writer) error {
+	d.queries++
+	for _, row := range d.rows {
+		if _, err := fmt.Fprintln(writer, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *copyDestination) CreateEmptyTable(table string) error { return nil }
+
+func (d *copyDestination) CreateColumns(table string, filePath string) error { return nil }
+
+func (d *copyDestination) InsertFromNDJsonFile(table string, path string) error {
+	d.inserts++
+	if d.onInsert != nil {
+		d.onInsert()
+	}
+	if d.inserts == d.failAt {
+		return errors.New("connection refused")
+	}
+
+	rows, err := readRows(path)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		d.loaded = append(d.loaded, string(row))
+	}
+	return nil
+}
+
+type testDestinations map[int64]destinations.Destination
+
+func (d testDestinations) Destination(ctx context.Context, databaseID int64) (destinations.Destination, error) {
+	dest, ok := d[databaseID]
+	if !ok {
+		return nil, fmt.Errorf("destination %d not found", databaseID)
+	}
+	return dest, nil
+}
+
+func testCopyWorker(t *testing.T, source, target *copyDestination) *ScratchDataWorker {
+	return testStorageWorker(t, testDestinations{1: source, 2: target})
+}
+
+// testStorageWorker has a static database, an in-memory blob store and the given destinations
+func testStorageWorker(t *testing.T, dests testDestinations) *ScratchDataWorker {
+	db, err := static.NewStaticDatabase(config.Database{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobStore, err := memory.NewStorage(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := testWorker(t)
+	w.Config = config.Workers{DataDirectory: t.TempDir(), CopyChunkRows: 2}
+	w.StorageServices = &storage.Services{Database: db, BlobStore: blobStore}
+	w.destinationManager = dests
+	return w
+}
+
+// startCopyJob creates a job copying the source's rows into the events table
+// of the target, and the message a worker would dequeue for it
+func startCopyJob(t *testing.T, w *ScratchDataWorker) (models.CopyJob, *models.Message) {
+	job := models.CopyJob{SourceID: 1, TargetID: 2, Query: "SELECT * FROM events", Table: "events"}
+	if err := w.StorageServices.Database.CreateCopyJob(context.Background(), &job); err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := json.Marshal(models2.CopyJobMessage{JobID: job.UUID, DestinationID: job.TargetID, Table: job.Table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job, &models.Message{Message: string(message), Attempts: 1}
+}
+
+func getCopyJob(t *testing.T, w *ScratchDataWorker, job models.CopyJob) models.CopyJob {
+	job, ok := w.StorageServices.Database.GetCopyJob(context.Background(), uuid.MustParse(job.UUID))
+	if !ok {
+		t.Fatal("Copy job not found")
+	}
+	return job
+}
+
+func assertChunksDeleted(t *testing.T, w *ScratchDataWorker, job models.CopyJob) {
+	chunks, err := w.StorageServices.Database.GetCopyChunks(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 0 {
+		t.Errorf("Expected chunks to be deleted, got %d", len(chunks))
+	}
+
+	for number := 1; number <= 3; number++ {
+		err := w.StorageServices.BlobStore.Download(CopyChunkKey(job, number), &bufferAt{})
+		if err == nil {
+			t.Errorf("Expected chunk %d to be deleted from the blob store", number)
+		}
+	}
+}
+
+// bufferAt collects a download from the blob store
+type bufferAt struct {
+	data []byte
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(b.data) {
+		b.data = append(b.data, make([]byte, end-len(b.data))...)
+	}
+	return copy(b.data[off:], p), nil
+}
+
+var copyRows = []string{`{"a":1}`, `{"a":2,"__row_id":7}`, `{"a":3}`, `{"a":4}`, `{"a":5}`}
+
+func TestExportCopyJobChunks(t *testing.T) {
+	source := &copyDestination{rows: copyRows}
+	w := testCopyWorker(t, source, &copyDestination{})
+	job, _ := startCopyJob(t, w)
+
+	rows, err := w.exportCopyJob(context.Background(), 0, job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 5 {
+		t.Errorf("Expected 5 rows to be exported, got %d", rows)
+	}
+
+	chunks, err := w.StorageServices.Database.GetCopyChunks(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int64{2, 2, 1}
+	if len(chunks) != len(expected) {
+		t.Fatalf("Expected %d chunks, got %d", len(expected), len(chunks))
+	}
+
+	for i, chunk := range chunks {
+		if chunk.Number != i+1 || chunk.Rows != expected[i] || chunk.Key != CopyChunkKey(job, i+1) {
+			t.Errorf("Unexpected chunk %d: %+v", i, chunk)
+		}
+
+		var blob bufferAt
+		if err := w.StorageServices.BlobStore.Download(chunk.Key, &blob); err != nil {
+			t.Fatal(err)
+		}
+		count := int64(0)
+		gjson.ForEachLine(string(blob.data), func(row gjson.Result) bool {
+			count++
+			if !row.Get("__row_id").Exists() {
+				t.Errorf("Expected a __row_id in %s", row.Raw)
+			}
+			if row.Get("a").Int() == 2 && row.Get("__row_id").Int() != 7 {
+				t.Errorf("Expected the existing __row_id to be kept, got %s", row.Raw)
+			}
+			return true
+		})
+		if count != chunk.Rows {
+			t.Errorf("Expected %d rows in chunk %d, got %d", chunk.Rows, chunk.Number, count)
+		}
+	}
+}
+
+func TestCopyJobResumesAfterFailedLoad(t *testing.T) {
+	source := &copyDestination{rows: copyRows}
+	target := &copyDestination{failAt: 2}
+	w := testCopyWorker(t, source, target)
+	job, item := startCopyJob(t, w)
+
+	if err := w.processCopyJob(0, item); err == nil {
+		t.Fatal("Expected the first attempt to fail")
+	}
+
+	job = getCopyJob(t, w, job)
+	if job.Status != models.JobRunning || !job.Exported || job.LoadedRows != 2 {
+		t.Errorf("Unexpected job after a failed load: %+v", job)
+	}
+
+	item.Attempts++
+	if err := w.processCopyJob(0, item); err != nil {
+		t.Fatal(err)
+	}
+
+	job = getCopyJob(t, w, job)
+	if job.Status != models.JobSucceeded || job.Rows != 5 || job.LoadedRows != 5 || job.Error != "" {
+		t.Errorf("Unexpected job after resuming: %+v", job)
+	}
+	if source.queries != 1 {
+		t.Errorf("Expected the source to be exported once, got %d", source.queries)
+	}
+	if len(target.loaded) != 5 {
+		t.Errorf("Expected each row to be loaded once, got %v", target.loaded)
+	}
+
+	assertChunksDeleted(t, w, job)
+}
+
+func TestCopyJobCancelled(t *testing.T) {
+	source := &copyDestination{rows: copyRows}
+	target := &copyDestination{}
+	w := testCopyWorker(t, source, target)
+	job, item := startCopyJob(t, w)
+
+	// Cancel the job while the first chunk is loading, as the API does
+	target.onInsert = func() {
+		if target.inserts != 1 {
+			return
+		}
+		cancelled := getCopyJob(t, w, job)
+		cancelled.Status = models.JobCancelled
+		if _, err := w.StorageServices.Database.UpdateCopyJob(context.Background(), &cancelled, models.JobRunning); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.processCopyJob(0, item); err != nil {
+		t.Fatal(err)
+	}
+
+	job = getCopyJob(t, w, job)
+	if job.Status != models.JobCancelled {
+		t.Errorf("Expected the job to stay cancelled, got %s", job.Status)
+	}
+	if target.inserts != 1 {
+		t.Errorf("Expected loading to stop after the cancelled chunk, got %d loads", target.inserts)
+	}
+
+	assertChunksDeleted(t, w, job)
+}
@@ -0,0 +1,194 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	models2 "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+// QueryJobResultKey is where the Parquet result of a query job is stored in the blob store
+func QueryJobResultKey(job models.QueryJob) string {
+	return fmt.Sprintf("query_jobs/%d/%s.parquet", job.DestinationID, job.UUID)
+}
+
+// processQueryJob runs a query job and uploads its result. Query errors are
+// recorded on the job rather than returned, since retrying will not help.
+func (w *ScratchDataWorker) processQueryJob(threadId int, item *models.Message) error {
+	ctx := context.TODO()
+
+	var message models2.QueryJobMessage
+	if err := json.Unmarshal([]byte(item.Message), &message); err != nil {
+		return fmt.Errorf("%w: unable to decode message: %s", errPermanent, err)
+	}
+
+	jobId, err := uuid.Parse(message.JobID)
+	if err != nil {
+		return fmt.Errorf("%w: invalid query job ID %q: %s", errPermanent, message.JobID, err)
+	}
+
+	job, ok := w.StorageServices.Database.GetQueryJob(ctx, jobId)
+	if !ok || job.Finished() {
+		// Cancelled before it started
+		return nil
+	}
+
+	// A running job was claimed by a worker which stopped before finishing it,
+	// and the message was reclaimed, so the query is run again
+	if job.Status == models.JobQueued {
+		now := time.Now()
+		job.Status = models.JobRunning
+		job.StartedAt = &now
+		updated, err := w.StorageServices.Database.UpdateQueryJob(ctx, &job, models.JobQueued)
+		if err != nil || !updated {
+			return err
+		}
+	}
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if message.ReadOnly {
+		queryCtx = util.WithReadOnly(queryCtx)
+	}
+	if timeout := w.queryJobTimeout(message); timeout > 0 {
+		queryCtx, cancel = context.WithTimeout(queryCtx, timeout)
+		defer cancel()
+	}
+	go w.watchQueryJob(queryCtx, cancel, jobId)
+
+	rows, size, err := w.runQueryJob(queryCtx, threadId, job)
+	if errors.Is(queryCtx.Err(), context.DeadlineExceeded) {
+		err = errors.New("query exceeded the maximum execution time")
+	}
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	if err != nil {
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = models.JobSucceeded
+		job.ResultKey = QueryJobResultKey(job)
+		job.Rows = rows
+		job.Bytes = size
+	}
+
+	updated, updateErr := w.StorageServices.Database.UpdateQueryJob(ctx, &job, models.JobRunning)
+	if updateErr != nil {
+		return updateErr
+	}
+
+	if !updated && err == nil {
+		// The job was cancelled while running, so nobody will download the result
+		if err := w.StorageServices.BlobStore.Delete(QueryJobResultKey(job)); err != nil {
+			log.Error().Err(err).Str("job_id", job.UUID).Msg("Unable to delete cancelled query result")
+		}
+	}
+
+	return nil
+}
+
+// queryJobTimeout is the smaller of the worker's execution limit and that of
+// the API key which created the job. 0 means no limit.
+func (w *ScratchDataWorker) queryJobTimeout(message models2.QueryJobMessage) time.Duration {
+	seconds := w.Config.MaxExecutionSeconds
+	if message.MaxExecutionSeconds > 0 && (seconds <= 0 || message.MaxExecutionSeconds < seconds) {
+		seconds = message.MaxExecutionSeconds
+	}
+
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// queryJobPollInterval is how often a running job is checked for cancellation
+const queryJobPollInterval = 2 * time.Second
+
+// watchQueryJob calls cancel if the job is cancelled through the API while it
+// runs, so the destination stops the query. It returns once ctx is done.
+func (w *ScratchDataWorker) watchQueryJob(ctx context.Context, cancel context.CancelFunc, jobId uuid.UUID) {
+	watchCancellation(ctx, cancel, func() bool {
+		job, ok := w.StorageServices.Database.GetQueryJob(ctx, jobId)
+		return ok && job.Status == models.JobCancelled
+	})
+}
+
+// watchCancellation polls cancelled and calls cancel once it returns true.
+// It returns once ctx is done.
+func watchCancellation(ctx context.Context, cancel context.CancelFunc, cancelled func() bool) {
+	ticker := time.NewTicker(queryJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if cancelled() {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// runQueryJob writes the query result to a local Parquet file and uploads it
+func (w *ScratchDataWorker) runQueryJob(ctx context.Context, threadId int, job models.QueryJob) (int64, int64, error) {
+	destination, err := w.destinationManager.Destination(ctx, job.DestinationID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	filePath := filepath.Join(w.Config.DataDirectory, fmt.Sprintf("query_job_%s.parquet", job.UUID))
+	f, err := os.Create(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer func() {
+		f.Close()
+		if err := os.Remove(filePath); err != nil {
+			log.Error().Err(err).Int("thread", threadId).Str("filename", filePath).Msg("Unable to remove temp file")
+		}
+	}()
+
+	err = destination.Query(ctx, job.Query, job.Params, dataModels.FormatParquet, f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The row count is in the Parquet footer. Closing the reader would close f.
+	parquetReader, err := file.NewParquetReader(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	rows := parquetReader.NumRows()
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return 0, 0, err
+	}
+
+	err = w.StorageServices.BlobStore.Upload(QueryJobResultKey(job), f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rows, info.Size(), nil
+}
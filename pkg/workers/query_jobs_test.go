@@ -0,0 +1,112 @@
+package workers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/destinations/rowencoder"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	models2 "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+)
+
+// queryDestination returns three rows of __row_id as Parquet
+type queryDestination struct {
+	destinations.Destination
+	queries int
+}
+
+func (d *queryDestination) Query(ctx context.Context, query string, params dataModels.Params, format dataModels.Format, writer io.Writer) error {
+	d.queries++
+	encoder, err := rowencoder.New(format, writer, []rowencoder.Column{{Name: "__row_id", Type: rowencoder.Int64}})
+	if err != nil {
+		return err
+	}
+	for i := int64(1); i <= 3; i++ {
+		if err := encoder.Write([]any{i}); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+func TestProcessQueryJobReclaimed(t *testing.T) {
+	dest := &queryDestination{}
+	w := testStorageWorker(t, testDestinations{1: dest})
+	ctx := context.Background()
+
+	job, err := w.StorageServices.Database.CreateQueryJob(ctx, 1, "SELECT * FROM events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker which started the job stopped before it finished
+	job.Status = models.JobRunning
+	if _, err := w.StorageServices.Database.UpdateQueryJob(ctx, &job, models.JobQueued); err != nil {
+		t.Fatal(err)
+	}
+
+	message, err := json.Marshal(models2.QueryJobMessage{JobID: job.UUID, DestinationID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.processQueryJob(0, &models.Message{Message: string(message), Attempts: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, ok := w.StorageServices.Database.GetQueryJob(ctx, uuid.MustParse(job.UUID))
+	if !ok {
+		t.Fatal("Query job not found")
+	}
+	if job.Status != models.JobSucceeded || job.Rows != 3 || job.ResultKey != QueryJobResultKey(job) {
+		t.Errorf("Expected the reclaimed job to run again, got %+v", job)
+	}
+	if dest.queries != 1 {
+		t.Errorf("Expected one query, got %d", dest.queries)
+	}
+	if err := w.StorageServices.BlobStore.Download(job.ResultKey, &bufferAt{}); err != nil {
+		t.Errorf("Expected the result to be uploaded: %v", err)
+	}
+}
+
+func TestQueryJobTimeout(t *testing.T) {
+	tests := []struct {
+		worker   int
+		key      int
+		expected time.Duration
+	}{
+		{0, 0, 0},
+		{30, 0, 30 * time.Second},
+		{0, 10, 10 * time.Second},
+		{30, 10, 10 * time.Second},
+		{10, 30, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		w := &ScratchDataWorker{Config: config.Workers{MaxExecutionSeconds: test.worker}}
+		message := models2.QueryJobMessage{MaxExecutionSeconds: test.key}
+
+		if got := w.queryJobTimeout(message); got != test.expected {
+			t.Errorf("worker %d, key %d: expected %s; got %s", test.worker, test.key, test.expected, got)
+		}
+	}
+}
+
+func TestProcessQueryJobInvalidMessage(t *testing.T) {
+	w := testStorageWorker(t, testDestinations{})
+
+	// Neither will work on a retry, so they are dead-lettered
+	for _, message := range []string{`{"job_id":`, `{"job_id": "not-a-uuid"}`} {
+		err := w.processQueryJob(0, &models.Message{Message: message, Attempts: 1})
+		if !errors.Is(err, errPermanent) {
+			t.Errorf("%s: expected a permanent error, got %v", message, err)
+		}
+	}
+}
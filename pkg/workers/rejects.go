@@ -0,0 +1,264 @@
+package workers
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// rejectedRow is a row which could not be loaded on its own
+type rejectedRow struct {
+	data []byte
+	err  error
+}
+
+// loadFile inserts a file into table. If the load fails, rows which are not
+// valid JSON are set aside. A few single rows are then loaded as a probe: if
+// none of them load, the problem is likely the destination rather than the
+// data, so the error is returned and nothing is rejected. Otherwise the rest
+// are split in half and loaded again, until the rows which fail on their own
+// are found. Those are written to the table's rejects table.
+func (w *ScratchDataWorker) loadFile(threadId int, destination destinations.Destination, table string, key string, filePath string) error {
+	loadErr := destination.InsertFromNDJsonFile(table, filePath)
+	if loadErr == nil {
+		return nil
+	}
+	log.Warn().Err(loadErr).Int("thread", threadId).Str("table", table).Str("key", key).Msg("Unable to load file, looking for rows to reject")
+
+	rows, err := readRows(filePath)
+	if err != nil {
+		return err
+	}
+
+	valid := [][]byte{}
+	rejects := []rejectedRow{}
+	for _, row := range rows {
+		if gjson.ValidBytes(row) {
+			valid = append(valid, row)
+		} else {
+			rejects = append(rejects, rejectedRow{data: row, err: errInvalidJSON})
+		}
+	}
+
+	loaded := 0
+	if len(valid) > 0 {
+		if len(rejects) > 0 {
+			loadErr, err = loadRows(destination, table, filePath, valid)
+			if err != nil {
+				return err
+			}
+		}
+
+		if loadErr == nil {
+			loaded = len(valid)
+		} else {
+			loaded, valid, err = probe(destination, table, filePath, valid)
+			if err != nil {
+				return err
+			}
+			if loaded == 0 {
+				return loadErr
+			}
+
+			if len(valid) > 0 {
+				loadErr, err = loadRows(destination, table, filePath, valid)
+				if err != nil {
+					return err
+				}
+			}
+			if loadErr == nil {
+				loaded += len(valid)
+			} else {
+				n, failed, err := w.bisect(destination, table, filePath, valid, loadErr)
+				if err != nil {
+					return err
+				}
+				loaded += n
+				rejects = append(rejects, failed...)
+			}
+		}
+	}
+
+	log.Warn().Int("thread", threadId).Str("table", table).Str("key", key).Int("rows", len(rejects)).Msg("Rejected rows which could not be loaded")
+	err = w.writeRejects(destination, table, key, filePath, rejects)
+	if err != nil && loaded > 0 {
+		// Retrying the file would load its good rows twice
+		log.Error().Err(err).Int("thread", threadId).Str("table", table).Str("key", key).Int("rows", len(rejects)).Msg("Unable to write rejected rows, they have been dropped")
+		return nil
+	}
+	return err
+}
+
+// Single rows loaded by probe before deciding that the destination is failing
+const maxProbeRows = 8
+
+// probe loads up to maxProbeRows single rows, spread across rows, until one
+// loads. It returns the number loaded, which is 0 or 1, and the rows which
+// are left to load.
+func probe(destination destinations.Destination, table string, filePath string, rows [][]byte) (int, [][]byte, error) {
+	step := max(len(rows)/maxProbeRows, 1)
+	for i, probed := 0, 0; i < len(rows) && probed < maxProbeRows; i, probed = i+step, probed+1 {
+		loadErr, err := loadRows(destination, table, filePath, rows[i:i+1])
+		if err != nil {
+			return 0, rows, err
+		}
+		if loadErr == nil {
+			remaining := append(append([][]byte{}, rows[:i]...), rows[i+1:]...)
+			return 1, remaining, nil
+		}
+	}
+	return 0, rows, nil
+}
+
+var errInvalidJSON = errors.New("invalid JSON")
+
+// bisect loads each half of rows, splitting again those which fail, and
+// returns the number of rows loaded and those which failed on their own.
+// loadErr is the error from loading all of rows together.
+func (w *ScratchDataWorker) bisect(destination destinations.Destination, table string, filePath string, rows [][]byte, loadErr error) (int, []rejectedRow, error) {
+	if len(rows) == 1 {
+		return 0, []rejectedRow{{data: rows[0], err: loadErr}}, nil
+	}
+
+	loaded := 0
+	rejects := []rejectedRow{}
+	middle := len(rows) / 2
+	for _, half := range [][][]byte{rows[:middle], rows[middle:]} {
+		halfErr, err := loadRows(destination, table, filePath, half)
+		if err != nil {
+			return loaded, rejects, err
+		}
+		if halfErr == nil {
+			loaded += len(half)
+			continue
+		}
+
+		n, failed, err := w.bisect(destination, table, filePath, half, halfErr)
+		if err != nil {
+			return loaded, rejects, err
+		}
+		loaded += n
+		rejects = append(rejects, failed...)
+	}
+
+	return loaded, rejects, nil
+}
+
+// loadRows writes rows to a file next to filePath and loads it. It returns the
+// error from the destination separately from errors writing the file, which
+// say nothing about the rows.
+func loadRows(destination destinations.Destination, table string, filePath string, rows [][]byte) (loadErr error, err error) {
+	part, err := writeRows(filePath, rows)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(part)
+
+	return destination.InsertFromNDJsonFile(table, part), nil
+}
+
+// writeRejects inserts rejected rows into the rejects table, creating it if needed
+func (w *ScratchDataWorker) writeRejects(destination destinations.Destination, table string, key string, filePath string, rejects []rejectedRow) error {
+	if len(rejects) == 0 {
+		return nil
+	}
+
+	rejectedAt := time.Now().UTC().Format("2006-01-02 15:04:05.999999")
+	rows := make([][]byte, len(rejects))
+	for i, reject := range rejects {
+		row := []byte("{}")
+		for _, field := range []struct {
+			name  string
+			value any
+		}{
+			{"__row_id", w.snow.Generate().Int64()},
+			{"rejected_at", rejectedAt},
+			{"error", reject.err.Error()},
+			{"source_key", key},
+			{"data", string(reject.data)},
+		} {
+			var err error
+			row, err = sjson.SetBytes(row, field.name, field.value)
+			if err != nil {
+				return err
+			}
+		}
+		rows[i] = row
+	}
+
+	rejectsTable := dataModels.RejectsTable(table)
+	if err := destination.CreateEmptyTable(rejectsTable); err != nil {
+		return err
+	}
+	if err := destination.CreateDeclaredColumns(rejectsTable, dataModels.RejectsColumns); err != nil {
+		return err
+	}
+
+	loadErr, err := loadRows(destination, rejectsTable, filePath, rows)
+	if err != nil {
+		return err
+	}
+	return loadErr
+}
+
+// readRows returns the non-empty lines of an NDJSON file
+func readRows(filePath string) ([][]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rows := [][]byte{}
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			rows = append(rows, line)
+		}
+
+		if readErr == io.EOF {
+			return rows, nil
+		}
+	}
+}
+
+// writeRows writes rows to a new file alongside filePath and returns its name
+func writeRows(filePath string, rows [][]byte) (string, error) {
+	part, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.part")
+	if err != nil {
+		return "", err
+	}
+
+	writer := bufio.NewWriter(part)
+	for _, row := range rows {
+		writer.Write(row)
+		writer.WriteByte('\n')
+	}
+
+	if err := writer.Flush(); err != nil {
+		part.Close()
+		os.Remove(part.Name())
+		return "", err
+	}
+	if err := part.Close(); err != nil {
+		os.Remove(part.Name())
+		return "", err
+	}
+	return part.Name(), nil
+}
@@ -0,0 +1,143 @@
+package workers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/util"
+	"github.com/tidwall/gjson"
+)
+
+// rejectingDestination fails to load files into events with a row containing
+// "bad". It fails every load when down is set, and loads into the rejects
+// table when rejectsDown is set.
+type rejectingDestination struct {
+	destinations.Destination
+	down        bool
+	rejectsDown bool
+
+	inserts int
+	loaded  map[string][]string
+}
+
+func (d *rejectingDestination) CreateEmptyTable(table string) error { return nil }
+
+func (d *rejectingDestination) CreateDeclaredColumns(table string, columns []dataModels.SchemaColumn) error {
+	return nil
+}
+
+func (d *rejectingDestination) InsertFromNDJsonFile(table string, path string) error {
+	d.inserts++
+	if d.down || (d.rejectsDown && table == dataModels.RejectsTable("events")) {
+		return errors.New("connection refused")
+	}
+
+	rows, err := readRows(path)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if table == "events" && (strings.Contains(string(row), "bad") || !gjson.ValidBytes(row)) {
+			return errors.New("cannot parse row")
+		}
+	}
+	for _, row := range rows {
+		d.loaded[table] = append(d.loaded[table], string(row))
+	}
+	return nil
+}
+
+func writeTestFile(t *testing.T, rows ...string) string {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	if err := os.WriteFile(path, []byte(strings.Join(rows, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testWorker(t *testing.T) *ScratchDataWorker {
+	snow, err := util.NewSnowflakeGenerator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ScratchDataWorker{snow: snow}
+}
+
+func TestLoadFileBisect(t *testing.T) {
+	path := writeTestFile(t, `{"a":1}`, `{"a":"bad"}`, `{"a":3}`, `{"a":4}`, `{"a":5}`, `{"a":6}`, `{"a":"bad"}`, `{"a":8}`)
+	dest := &rejectingDestination{loaded: map[string][]string{}}
+
+	if err := testWorker(t).loadFile(0, dest, "events", "key", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.loaded["events"]) != 6 {
+		t.Errorf("Expected 6 rows to load, got %v", dest.loaded["events"])
+	}
+	rejects := dest.loaded[dataModels.RejectsTable("events")]
+	if len(rejects) != 2 {
+		t.Fatalf("Expected 2 rejected rows, got %v", rejects)
+	}
+	for _, reject := range rejects {
+		row := gjson.Parse(reject)
+		if row.Get("data").String() != `{"a":"bad"}` || row.Get("error").String() != "cannot parse row" || row.Get("source_key").String() != "key" {
+			t.Errorf("Unexpected rejected row %s", reject)
+		}
+	}
+}
+
+func TestLoadFileInvalidJSON(t *testing.T) {
+	path := writeTestFile(t, `{"a":1}`, `{"a":`, `{"a":3}`)
+	dest := &rejectingDestination{loaded: map[string][]string{}}
+
+	if err := testWorker(t).loadFile(0, dest, "events", "key", path); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dest.loaded["events"]) != 2 {
+		t.Errorf("Expected 2 rows to load, got %v", dest.loaded["events"])
+	}
+	rejects := dest.loaded[dataModels.RejectsTable("events")]
+	if len(rejects) != 1 || gjson.Get(rejects[0], "error").String() != errInvalidJSON.Error() {
+		t.Errorf("Expected the invalid row to be rejected, got %v", rejects)
+	}
+}
+
+func TestLoadFileDestinationDown(t *testing.T) {
+	rows := make([]string, 1000)
+	for i := range rows {
+		rows[i] = `{"a":1}`
+	}
+	path := writeTestFile(t, rows...)
+	dest := &rejectingDestination{down: true, loaded: map[string][]string{}}
+
+	if err := testWorker(t).loadFile(0, dest, "events", "key", path); err == nil {
+		t.Fatal("Expected the load error to be returned")
+	}
+
+	// The whole file, then the probes, rather than bisecting to every row
+	if dest.inserts > 1+maxProbeRows {
+		t.Errorf("Expected at most %d inserts, got %d", 1+maxProbeRows, dest.inserts)
+	}
+	if len(dest.loaded) != 0 {
+		t.Errorf("Expected nothing to load or be rejected, got %v", dest.loaded)
+	}
+}
+
+func TestLoadFileRejectsWriteFails(t *testing.T) {
+	path := writeTestFile(t, `{"a":1}`, `{"a":"bad"}`, `{"a":3}`)
+	dest := &rejectingDestination{rejectsDown: true, loaded: map[string][]string{}}
+
+	// The good rows have loaded, so retrying the file would load them again
+	if err := testWorker(t).loadFile(0, dest, "events", "key", path); err != nil {
+		t.Fatal(err)
+	}
+	if len(dest.loaded["events"]) != 2 {
+		t.Errorf("Expected 2 rows to load, got %v", dest.loaded["events"])
+	}
+}
@@ -0,0 +1,70 @@
+package workers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+const defaultMaxAttempts = 5
+const defaultRetryBase = 10 * time.Second
+const defaultRetryMax = time.Hour
+
+// errPermanent marks failures which retrying cannot fix, such as a message
+// which cannot be decoded. These messages are dead-lettered straight away.
+var errPermanent = errors.New("permanent failure")
+
+func (w *ScratchDataWorker) maxAttempts() int {
+	if w.Config.MaxAttempts > 0 {
+		return w.Config.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// retryDelay is the wait before retrying a message which has failed the given
+// number of times. It doubles with each attempt, up to the configured maximum.
+func (w *ScratchDataWorker) retryDelay(attempts int) time.Duration {
+	base := defaultRetryBase
+	if w.Config.RetryBaseSeconds > 0 {
+		base = time.Duration(w.Config.RetryBaseSeconds) * time.Second
+	}
+	max := defaultRetryMax
+	if w.Config.RetryMaxSeconds > 0 {
+		max = time.Duration(w.Config.RetryMaxSeconds) * time.Second
+	}
+
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
+
+// handleFailure returns a failed message to the queue after a backoff, or
+// dead-letters it once it has used all of its attempts. Neither happens if
+// the message has been reclaimed from workerLabel.
+func (w *ScratchDataWorker) handleFailure(threadId int, workerLabel string, item *models.Message, err error) {
+	logger := log.With().Int("thread", threadId).Uint("message_id", item.ID).Int("attempts", item.Attempts).Logger()
+
+	if errors.Is(err, errPermanent) || item.Attempts >= w.maxAttempts() {
+		logger.Error().Err(err).Str("message", item.Message).Msg("Unable to process message, moving it to the dead-letter queue")
+		claimed, dlqErr := w.StorageServices.Database.DeadLetter(item.ID, workerLabel, err.Error())
+		if dlqErr != nil {
+			logger.Error().Err(dlqErr).Msg("Unable to dead-letter message")
+		} else if !claimed {
+			logger.Warn().Msg("Message was reclaimed, so it was not dead-lettered")
+		}
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(w.retryDelay(item.Attempts))
+	logger.Warn().Err(err).Time("next_attempt_at", nextAttemptAt).Msg("Unable to process message, will retry")
+	claimed, requeueErr := w.StorageServices.Database.Requeue(item.ID, workerLabel, err.Error(), nextAttemptAt)
+	if requeueErr != nil {
+		logger.Error().Err(requeueErr).Msg("Unable to requeue message")
+	} else if !claimed {
+		logger.Warn().Msg("Message was reclaimed, so it was not requeued")
+	}
+}
@@ -0,0 +1,155 @@
+package workers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scratchdata/scratchdata/pkg/config"
+	"github.com/scratchdata/scratchdata/pkg/storage"
+	"github.com/scratchdata/scratchdata/pkg/storage/database"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+func TestRetryDelay(t *testing.T) {
+	w := &ScratchDataWorker{Config: config.Workers{RetryBaseSeconds: 10, RetryMaxSeconds: 60}}
+
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 60 * time.Second, 60 * time.Second}
+	for i, want := range expected {
+		if got := w.retryDelay(i + 1); got != want {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+
+	defaults := &ScratchDataWorker{}
+	if got := defaults.retryDelay(100); got != defaultRetryMax {
+		t.Errorf("expected the delay to be capped at %s, got %s", defaultRetryMax, got)
+	}
+}
+
+// testQueueWorkers returns workers with a static database and a gorm database
+// backed by sqlite, which retry each message up to three times
+func testQueueWorkers(t *testing.T) map[string]*ScratchDataWorker {
+	static, err := database.NewConnection(config.Database{Type: "static"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := database.NewConnection(config.Database{Type: "sqlite", Settings: map[string]any{
+		"dsn":          filepath.Join(t.TempDir(), "test.db"),
+		"default_user": "test@example.com",
+	}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workers := map[string]*ScratchDataWorker{}
+	for name, db := range map[string]database.Database{"static": static, "sqlite": sqlite} {
+		workers[name] = &ScratchDataWorker{
+			Config:          config.Workers{MaxAttempts: 3, RetryBaseSeconds: 60},
+			StorageServices: &storage.Services{Database: db},
+		}
+	}
+	return workers
+}
+
+// claimMessage enqueues a message and claims it as the given attempt
+func claimMessage(t *testing.T, db database.Database, attempts int) *models.Message {
+	message, err := db.Enqueue(models.InsertData, map[string]any{"table": "events"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < attempts; i++ {
+		if _, ok := db.Dequeue(models.InsertData, "test"); !ok {
+			t.Fatal("Expected a message")
+		}
+		if _, err := db.ReclaimExpired(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, ok := db.Dequeue(models.InsertData, "test")
+	if !ok || item.ID != message.ID || item.Attempts != attempts {
+		t.Fatalf("Expected message %d to be claimed for attempt %d, got %+v", message.ID, attempts, item)
+	}
+	return item
+}
+
+func TestHandleFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		expected models.MessageStatus
+	}{
+		{"retried", 1, errors.New("connection refused"), models.New},
+		{"last attempt", 3, errors.New("connection refused"), models.Dead},
+		{"permanent", 1, fmt.Errorf("%w: unable to decode message", errPermanent), models.Dead},
+	}
+
+	for name, w := range testQueueWorkers(t) {
+		db := w.StorageServices.Database
+		for _, test := range tests {
+			t.Run(name+"/"+test.name, func(t *testing.T) {
+				item := claimMessage(t, db, test.attempts)
+				w.handleFailure(0, "test", item, test.err)
+
+				message, ok := db.GetMessage(item.ID)
+				if !ok || message.Status != test.expected || message.LastError != test.err.Error() {
+					t.Fatalf("Expected the message to be %s with its error, got %+v", test.expected, message)
+				}
+				if test.expected == models.New {
+					if message.NextAttemptAt == nil || time.Until(*message.NextAttemptAt) < 50*time.Second {
+						t.Errorf("Expected the retry to wait for the backoff, got %v", message.NextAttemptAt)
+					}
+					if _, ok := db.Dequeue(models.InsertData, "test"); ok {
+						t.Error("Expected the message not to be claimed before its next attempt")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestProcessAbandoned(t *testing.T) {
+	for name, w := range testQueueWorkers(t) {
+		t.Run(name, func(t *testing.T) {
+			db := w.StorageServices.Database
+
+			// Each worker which claimed it stopped before finishing, so it is
+			// dead-lettered without being processed again
+			item := claimMessage(t, db, 4)
+			w.process(0, "test", item)
+
+			message, ok := db.GetMessage(item.ID)
+			if !ok || message.Status != models.Dead || message.LastError != errAbandoned.Error() {
+				t.Errorf("Expected the abandoned message to be dead-lettered, got %+v", message)
+			}
+		})
+	}
+}
+
+func TestHandleFailureReclaimed(t *testing.T) {
+	for name, w := range testQueueWorkers(t) {
+		t.Run(name, func(t *testing.T) {
+			db := w.StorageServices.Database
+			item := claimMessage(t, db, 3)
+
+			// Another worker claimed the message after this one's claim expired
+			if _, err := db.ReclaimExpired(time.Now().Add(time.Second)); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := db.Dequeue(models.InsertData, "other"); !ok {
+				t.Fatal("Expected the message to be claimed again")
+			}
+
+			w.handleFailure(0, "test", item, errors.New("connection refused"))
+
+			message, _ := db.GetMessage(item.ID)
+			if message.Status != models.Claimed || message.ClaimedBy != "other" || message.LastError != "" {
+				t.Errorf("Expected the message to be left to the other worker, got %+v", message)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	"github.com/scratchdata/scratchdata/pkg/util"
+)
+
+// loadSettings are the destination settings which change how files are loaded
+type loadSettings struct {
+	SchemaEvolution    string `mapstructure:"schema_evolution"`
+	util.TypeDetection `mapstructure:",squash"`
+}
+
+func (w *ScratchDataWorker) loadSettings(ctx context.Context, destinationID int64) (*loadSettings, error) {
+	creds, err := w.StorageServices.Database.GetDestinationCredentials(ctx, destinationID)
+	if err != nil {
+		return nil, err
+	}
+	return util.ConfigToStruct[loadSettings](creds.Settings), nil
+}
+
+// detectColumnTypes finds columns of timestamps, dates, UUIDs and decimals.
+// Their values are converted like declared columns, and new ones are created
+// with the destination's native type. Existing columns are only converted if
+// they already have the detected type. It returns the converted columns.
+func (w *ScratchDataWorker) detectColumnTypes(ctx context.Context, threadId int, destinationID int64, table string, destination destinations.Destination, filePath string, detection util.TypeDetection, declared []dataModels.SchemaColumn) ([]dataModels.SchemaColumn, error) {
+	columns, err := destination.Columns(table)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]string{}
+	for _, column := range columns {
+		existing[column.Name] = util.DetectedTypeForColumn(column.Type)
+	}
+
+	input, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	inferred, err := util.GetJSONTypesWithDetection(input, detection)
+	input.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	detected := []dataModels.SchemaColumn{}
+	created := []dataModels.SchemaColumn{}
+	for _, name := range sortedKeys(inferred) {
+		columnType, ok := util.DetectedColumnType(inferred[name])
+		if !ok || isDeclared(declared, name) {
+			continue
+		}
+
+		current, exists := existing[name]
+		if exists && current != inferred[name] {
+			continue
+		}
+
+		column := dataModels.SchemaColumn{Name: name, Type: columnType}
+		column.EpochMillis = columnType.Kind == dataModels.KindTimestamp && detection.IsEpochMillis(name)
+		detected = append(detected, column)
+		if !exists {
+			created = append(created, column)
+		}
+	}
+
+	if len(detected) == 0 {
+		return detected, nil
+	}
+
+	failed, err := util.CoerceNDJSONFile(filePath, detected)
+	if err != nil {
+		return nil, err
+	}
+	for column, count := range failed {
+		log.Warn().Int("thread", threadId).Str("table", table).Str("column", column).Int("values", count).Msg("Values did not match the detected type and were set to null")
+	}
+
+	err = destination.CreateDeclaredColumns(table, created)
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range created {
+		w.recordSchemaChange(ctx, threadId, models.SchemaChange{DestinationID: destinationID, Table: table, Column: column.Name, Action: models.SchemaAddColumn, NewType: column.Type.String()})
+	}
+
+	return detected, nil
+}
+
+// evolveSchema compares the types of the file's values with the table's columns.
+// Where values do not fit, it follows the policy: it leaves them as they are,
+// widens the column, moves the values to sidecar columns in the file, or fails.
+// Declared and detected columns are skipped, as their values have already been
+// converted.
+//
+// Widened columns and rejections are recorded straight away. Columns which
+// will be added by CreateColumns are returned, to be recorded once they exist.
+func (w *ScratchDataWorker) evolveSchema(ctx context.Context, threadId int, destinationID int64, table string, destination destinations.Destination, filePath string, policy dataModels.SchemaPolicy, declared []dataModels.SchemaColumn) ([]models.SchemaChange, error) {
+	columns, err := destination.Columns(table)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]string{}
+	for _, column := range columns {
+		existing[column.Name] = column.JSONType
+	}
+	for _, column := range declared {
+		delete(existing, column.Name)
+	}
+
+	input, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	inferred, err := util.GetJSONTypes(input)
+	input.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	added := []models.SchemaChange{}
+	sidecars := map[string]string{}
+	for _, name := range sortedKeys(inferred) {
+		jsonType := inferred[name]
+		current, ok := existing[name]
+		if !ok {
+			if !isDeclared(declared, name) {
+				added = append(added, models.SchemaChange{DestinationID: destinationID, Table: table, Column: name, Action: models.SchemaAddColumn, NewType: jsonType})
+			}
+			continue
+		}
+
+		widened := util.WidenJSONType(current, jsonType)
+		if current == "" || widened == current {
+			continue
+		}
+
+		if policy == dataModels.SchemaPolicyNone {
+			continue
+		}
+
+		change := models.SchemaChange{DestinationID: destinationID, Table: table, Column: name, OldType: current, NewType: widened}
+
+		if policy == dataModels.SchemaPolicyReject {
+			change.Action = models.SchemaRejected
+			w.recordSchemaChange(ctx, threadId, change)
+			// The file will not fit on a retry either, so it is dead-lettered
+			// once rather than rejected again on every attempt
+			return nil, fmt.Errorf("%w: column %q of table %q is %s but the file has %s values", errPermanent, name, table, current, jsonType)
+		}
+
+		if policy == dataModels.SchemaPolicyWiden {
+			err := destination.WidenColumn(table, name, widened)
+			if err == nil {
+				change.Action = models.SchemaWidenColumn
+				w.recordSchemaChange(ctx, threadId, change)
+				continue
+			}
+			if !errors.Is(err, errors.ErrUnsupported) {
+				return nil, err
+			}
+			log.Info().Int("thread", threadId).Str("table", table).Str("column", name).Str("type", widened).Msg("Destination cannot widen column, using a sidecar column")
+		}
+
+		sidecars[name] = current
+	}
+
+	if len(sidecars) == 0 {
+		return added, nil
+	}
+
+	moved, err := util.MoveToSidecarColumns(filePath, sidecars)
+	if err != nil {
+		return nil, err
+	}
+	for sidecar, count := range moved {
+		log.Debug().Int("thread", threadId).Str("table", table).Str("column", sidecar.Name()).Int("values", count).Msg("Moved values to sidecar column")
+		if _, ok := existing[sidecar.Name()]; !ok {
+			added = append(added, models.SchemaChange{
+				DestinationID: destinationID,
+				Table:         table,
+				Column:        sidecar.Name(),
+				Action:        models.SchemaSidecarColumn,
+				OldType:       sidecars[sidecar.Column],
+				NewType:       sidecar.Type,
+				SourceColumn:  sidecar.Column,
+			})
+		}
+	}
+
+	return added, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isDeclared(declared []dataModels.SchemaColumn, name string) bool {
+	for _, column := range declared {
+		if column.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSchemaChange adds a change to the table's history. A failure to record
+// it is logged rather than failing the load, since the change has been made.
+func (w *ScratchDataWorker) recordSchemaChange(ctx context.Context, threadId int, change models.SchemaChange) {
+	err := w.StorageServices.Database.AddSchemaChange(ctx, &change)
+	if err != nil {
+		log.Error().Err(err).Int("thread", threadId).Str("table", change.Table).Str("column", change.Column).Str("action", string(change.Action)).Msg("Unable to record schema change")
+	}
+}
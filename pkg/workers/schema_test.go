@@ -0,0 +1,76 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dataModels "github.com/scratchdata/scratchdata/models"
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+)
+
+// intColumnDestination has an events table with an int column a
+type intColumnDestination struct {
+	destinations.Destination
+}
+
+func (d *intColumnDestination) Columns(table string) ([]dataModels.Column, error) {
+	return []dataModels.Column{{Name: "a", Type: "BIGINT", JSONType: "int"}}, nil
+}
+
+func TestEvolveSchemaRejectIsPermanent(t *testing.T) {
+	dest := &intColumnDestination{}
+	w := testStorageWorker(t, testDestinations{1: dest})
+	db := w.StorageServices.Database
+	ctx := context.Background()
+
+	if _, err := db.Enqueue(models.InsertData, map[string]any{"table": "events"}); err != nil {
+		t.Fatal(err)
+	}
+	item, ok := db.Dequeue(models.InsertData, "test")
+	if !ok {
+		t.Fatal("Expected a message")
+	}
+
+	path := writeTestFile(t, `{"a": "x"}`)
+	_, err := w.evolveSchema(ctx, 0, 1, "events", dest, path, dataModels.SchemaPolicyReject, nil)
+	if !errors.Is(err, errPermanent) {
+		t.Fatalf("Expected a permanent error, got %v", err)
+	}
+
+	// The first attempt dead-letters the message, so the rejection is recorded once
+	w.handleFailure(0, "test", item, err)
+
+	message, ok := db.GetMessage(item.ID)
+	if !ok || message.Status != models.Dead {
+		t.Errorf("Expected the message to be dead-lettered, got %+v", message)
+	}
+	changes, err := db.GetSchemaChanges(ctx, 1, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Action != models.SchemaRejected || changes[0].Column != "a" {
+		t.Errorf("Expected one rejection, got %+v", changes)
+	}
+}
+
+func TestEvolveSchemaNoneChangesNothing(t *testing.T) {
+	dest := &intColumnDestination{}
+	w := testStorageWorker(t, testDestinations{1: dest})
+	ctx := context.Background()
+
+	path := writeTestFile(t, `{"a": "x"}`)
+	added, err := w.evolveSchema(ctx, 0, 1, "events", dest, path, dataModels.SchemaPolicyNone, nil)
+	if err != nil || len(added) != 0 {
+		t.Fatalf("Expected no changes, got %+v, %v", added, err)
+	}
+
+	changes, err := w.StorageServices.Database.GetSchemaChanges(ctx, 1, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no recorded changes, got %+v", changes)
+	}
+}
@@ -3,25 +3,39 @@ package workers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/bwmarrin/snowflake"
 	"github.com/scratchdata/scratchdata/pkg/config"
 	"github.com/scratchdata/scratchdata/pkg/storage"
+	"github.com/scratchdata/scratchdata/pkg/storage/cache"
+	"github.com/scratchdata/scratchdata/pkg/util"
 
 	"github.com/rs/zerolog/log"
+	dataModels "github.com/scratchdata/scratchdata/models"
 	"github.com/scratchdata/scratchdata/pkg/destinations"
 	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
 	models2 "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
 )
 
+// destinationGetter returns the destination for a database ID. It is
+// implemented by destinations.DestinationManager.
+type destinationGetter interface {
+	Destination(ctx context.Context, databaseID int64) (destinations.Destination, error)
+}
+
 type ScratchDataWorker struct {
 	Config             config.Workers
 	StorageServices    *storage.Services
-	destinationManager *destinations.DestinationManager
+	destinationManager destinationGetter
+
+	// Generates __row_id for rejected rows
+	snow *snowflake.Node
 }
 
 func (w *ScratchDataWorker) Start(ctx context.Context, threadId int) {
@@ -30,26 +44,13 @@ func (w *ScratchDataWorker) Start(ctx context.Context, threadId int) {
 	hostname, _ := os.Hostname()
 	workerLabel := fmt.Sprintf("%s-%d", hostname, threadId)
 
-	for {
-		item, ok := w.StorageServices.Database.Dequeue(models.InsertData, workerLabel)
+	for poll := 0; ; poll++ {
+		item, ok := w.dequeue(workerLabel, poll)
 
 		if !ok {
 			time.Sleep(1 * time.Second)
 		} else {
-			message, err := w.messageToStruct([]byte(item.Message))
-			if err != nil {
-				log.Error().Err(err).Int("thread", threadId).Str("message", item.Message).Msg("Unable to decode message")
-			}
-
-			err = w.processMessage(threadId, message)
-			if err == nil {
-				deleteErr := w.StorageServices.Database.Delete(item.ID)
-				if deleteErr != nil {
-					log.Error().Err(deleteErr).Uint("message_id", item.ID).Msg("Unable to delete message from queue")
-				}
-			} else {
-				log.Error().Err(err).Int("thread", threadId).Interface("message", message).Msg("Unable to process message")
-			}
+			w.process(threadId, workerLabel, item)
 		}
 
 		select {
@@ -61,6 +62,74 @@ func (w *ScratchDataWorker) Start(ctx context.Context, threadId int) {
 	}
 }
 
+// process handles a claimed message, renewing the claim until it is done
+func (w *ScratchDataWorker) process(threadId int, workerLabel string, item *models.Message) {
+	// Claimed before without finishing, which happens when it crashes the worker
+	if item.Attempts > w.maxAttempts() {
+		w.handleFailure(threadId, workerLabel, item, errAbandoned)
+		return
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	lost := make(chan struct{})
+	go w.heartbeat(threadId, item, workerLabel, stop, lost)
+
+	var err error
+	switch item.MessageType {
+	case models.RunQuery:
+		err = w.processQueryJob(threadId, item)
+	case models.CopyData:
+		err = w.processCopyJob(threadId, item)
+	default:
+		err = w.processInsert(threadId, item)
+	}
+
+	// The message is another worker's now, and that worker will finish it
+	select {
+	case <-lost:
+		log.Warn().Err(err).Int("thread", threadId).Uint("message_id", item.ID).Msg("Leaving reclaimed message to its new worker")
+		return
+	default:
+	}
+
+	if err == nil {
+		claimed, deleteErr := w.StorageServices.Database.DeleteClaimed(item.ID, workerLabel)
+		if deleteErr != nil {
+			log.Error().Err(deleteErr).Uint("message_id", item.ID).Msg("Unable to delete message from queue")
+		} else if !claimed {
+			log.Warn().Uint("message_id", item.ID).Msg("Message was reclaimed, so it was not deleted")
+		}
+	} else {
+		w.handleFailure(threadId, workerLabel, item, err)
+	}
+}
+
+// Message types handled by the workers
+var messageTypes = []models.MessageType{models.InsertData, models.RunQuery, models.CopyData}
+
+// dequeue claims a message of any type. Each poll starts with the next type in
+// turn, so that a backlog of one type does not hold up the others.
+func (w *ScratchDataWorker) dequeue(workerLabel string, poll int) (*models.Message, bool) {
+	for i := range messageTypes {
+		messageType := messageTypes[(poll+i)%len(messageTypes)]
+		item, ok := w.StorageServices.Database.Dequeue(messageType, workerLabel)
+		if ok {
+			return item, true
+		}
+	}
+	return nil, false
+}
+
+func (w *ScratchDataWorker) processInsert(threadId int, item *models.Message) error {
+	message, err := w.messageToStruct([]byte(item.Message))
+	if err != nil {
+		return fmt.Errorf("%w: unable to decode message: %s", errPermanent, err)
+	}
+
+	return w.processMessage(threadId, message)
+}
+
 func (w *ScratchDataWorker) processMessage(threadId int, message models2.FileUploadMessage) error {
 	destination, err := w.destinationManager.Destination(context.TODO(), message.DatabaseID)
 	if err != nil {
@@ -72,6 +141,11 @@ func (w *ScratchDataWorker) processMessage(threadId int, message models2.FileUpl
 	filePath := filepath.Join(w.Config.DataDirectory, fileName)
 
 	err = w.downloadFile(filePath, message.Key)
+	defer func() {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Int("thread", threadId).Str("filename", filePath).Msg("Unable to remove temp file")
+		}
+	}()
 	if err != nil {
 		return err
 	}
@@ -81,35 +155,79 @@ func (w *ScratchDataWorker) processMessage(threadId int, message models2.FileUpl
 		return err
 	}
 
-	file, err := os.Open(filePath)
-
+	settings, err := w.loadSettings(context.TODO(), message.DatabaseID)
 	if err != nil {
 		return err
 	}
-
-	err = destination.CreateColumns(message.Table, filePath)
+	policy, err := dataModels.ParseSchemaPolicy(settings.SchemaEvolution)
 	if err != nil {
 		return err
 	}
 
-	_, err = file.Seek(0, 0)
+	// Declared columns are converted to their types. The rest are inferred below.
+	schema, err := w.StorageServices.Database.GetTableSchema(context.TODO(), message.DatabaseID, message.Table)
 	if err != nil {
 		return err
 	}
+	if len(schema) > 0 {
+		// Columns configured as epoch milliseconds are read as such, even if
+		// their declaration does not say so
+		coerced := make([]dataModels.SchemaColumn, len(schema))
+		for i, column := range schema {
+			column.EpochMillis = column.EpochMillis || settings.TypeDetection.IsEpochMillis(column.Name)
+			coerced[i] = column
+		}
+
+		failed, err := util.CoerceNDJSONFile(filePath, coerced)
+		if err != nil {
+			return err
+		}
+		for column, count := range failed {
+			log.Warn().Int("thread", threadId).Str("table", message.Table).Str("column", column).Int("values", count).Msg("Values did not match the declared type and were set to null")
+		}
+
+		err = destination.CreateDeclaredColumns(message.Table, schema)
+		if err != nil {
+			return err
+		}
+	}
+
+	if settings.TypeDetection.Enabled {
+		detected, err := w.detectColumnTypes(context.TODO(), threadId, message.DatabaseID, message.Table, destination, filePath, settings.TypeDetection, schema)
+		if err != nil {
+			return err
+		}
+		schema = append(schema, detected...)
+	}
 
-	err = destination.InsertFromNDJsonFile(message.Table, filePath)
+	// Values which do not fit existing columns widen them or move to sidecar columns
+	added, err := w.evolveSchema(context.TODO(), threadId, message.DatabaseID, message.Table, destination, filePath, policy, schema)
 	if err != nil {
 		return err
 	}
 
-	err = file.Close()
+	err = destination.CreateColumns(message.Table, filePath)
 	if err != nil {
-		log.Error().Err(err).Int("thread", threadId).Str("filename", filePath).Msg("Unable to close temp file")
+		return err
+	}
+	for _, change := range added {
+		w.recordSchemaChange(context.TODO(), threadId, change)
 	}
 
-	err = os.Remove(filePath)
+	// Rows which cannot be loaded go to the table's rejects table
+	err = w.loadFile(threadId, destination, message.Table, message.Key, filePath)
 	if err != nil {
-		log.Error().Err(err).Int("thread", threadId).Str("filename", filePath).Msg("Unable to remove temp file")
+		return err
+	}
+
+	// Cached query results for this table and its rejects no longer include all of their data
+	if w.StorageServices.Cache != nil {
+		for _, table := range []string{message.Table, dataModels.RejectsTable(message.Table)} {
+			err = cache.InvalidateTable(w.StorageServices.Cache, message.DatabaseID, table)
+			if err != nil {
+				log.Error().Err(err).Int("thread", threadId).Str("table", table).Msg("Unable to invalidate cached queries")
+			}
+		}
 	}
 
 	return nil
@@ -129,6 +247,7 @@ func (w *ScratchDataWorker) downloadFile(path string, key string) error {
 
 	err = w.StorageServices.BlobStore.Download(key, file)
 	if err != nil {
+		file.Close()
 		return err
 	}
 
@@ -142,13 +261,22 @@ func RunWorkers(ctx context.Context, config config.Workers, storageServices *sto
 		return
 	}
 
+	snow, err := util.NewSnowflakeGenerator()
+	if err != nil {
+		log.Error().Err(err).Msg("Unable to create ID generator for workers")
+		return
+	}
+
 	workers := &ScratchDataWorker{
 		Config:             config,
 		StorageServices:    storageServices,
 		destinationManager: destinationManager,
+		snow:               snow,
 	}
 
 	log.Debug().Msg("Starting Workers")
+	go workers.reapAbandoned(ctx)
+
 	var wg sync.WaitGroup
 	i := 0
 	for i = 0; i < config.Count; i++ {
@@ -0,0 +1,64 @@
+package workers
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/scratchdata/scratchdata/pkg/destinations"
+	"github.com/scratchdata/scratchdata/pkg/storage/database/models"
+	models2 "github.com/scratchdata/scratchdata/pkg/storage/queue/models"
+)
+
+func TestDequeueRotatesTypes(t *testing.T) {
+	w := testStorageWorker(t, testDestinations{})
+	db := w.StorageServices.Database
+
+	// A backlog of inserts, queued before the query and the copy
+	for _, messageType := range []models.MessageType{models.InsertData, models.InsertData, models.InsertData, models.RunQuery, models.CopyData} {
+		if _, err := db.Enqueue(messageType, map[string]any{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []models.MessageType{models.InsertData, models.RunQuery, models.CopyData, models.InsertData, models.InsertData}
+	for poll, want := range expected {
+		item, ok := w.dequeue("test", poll)
+		if !ok || item.MessageType != want {
+			t.Fatalf("poll %d: expected a %s message, got %+v", poll, want, item)
+		}
+	}
+	if _, ok := w.dequeue("test", len(expected)); ok {
+		t.Error("Expected the queue to be empty")
+	}
+}
+
+// failingTableDestination cannot create tables
+type failingTableDestination struct {
+	destinations.Destination
+}
+
+func (d *failingTableDestination) CreateEmptyTable(table string) error {
+	return errors.New("connection refused")
+}
+
+func TestProcessMessageRemovesFileOnFailure(t *testing.T) {
+	w := testStorageWorker(t, testDestinations{1: &failingTableDestination{}})
+	if err := w.StorageServices.BlobStore.Upload("data/1/events/file.ndjson", strings.NewReader(`{"a": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := w.processMessage(0, models2.FileUploadMessage{DatabaseID: 1, Table: "events", Key: "data/1/events/file.ndjson"})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	files, err := os.ReadDir(w.Config.DataDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected the temp file to be removed, got %v", files)
+	}
+}